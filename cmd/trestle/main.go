@@ -1,15 +1,27 @@
 package main
 
 import (
+	"fmt"
 	"github.com/lucasl0st/trestle/internal"
 	"github.com/lucasl0st/trestle/pkg"
+	"log/slog"
+	"net"
+	"net/netip"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
 const configEnv = "CONFIG"
 const defaultConfigPath = "config.yaml"
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "genkey" {
+		genKey()
+		return
+	}
+
 	configPath := os.Getenv(configEnv)
 	if configPath == "" {
 		configPath = defaultConfigPath
@@ -20,43 +32,545 @@ func main() {
 		panic(err)
 	}
 
-	var listeners []internal.Listener
+	switches := map[string]internal.Switch{}
+	listeners := map[string]internal.Listener{}
+	dhcpServers := map[string]internal.DHCPServer{}
+	// switch and port name -> end of a patch whose other end was already added
+	patchEnds := map[[2]string]internal.Port{}
 
 	for _, s := range cfg.Switches {
-		sw := internal.NewSwitch(s.Name)
-		l, err := internal.NewListener(s.Listener.Hostname, s.Listener.Port, s.MTU, s.NetworkMTU, sw)
+		privateKey, err := pkg.DecodeKey(s.PrivateKey)
+		if err != nil {
+			panic(err)
+		}
+
+		sw, err := internal.NewSwitch(internal.SwitchConfig{
+			Name:         s.Name,
+			MACAgingTime: s.MACAgingTime,
+			MaxMACs:      s.MaxMACs,
+			Mirror: internal.MirrorConfig{
+				Enabled:     s.Mirror.Enabled,
+				MonitorPort: s.Mirror.Monitor,
+				Ports:       s.Mirror.Ports,
+				VLANs:       s.Mirror.VLANs,
+				Direction:   internal.MirrorDirection(s.Mirror.Direction),
+			},
+			Capture: internal.CaptureConfig{
+				Directory:      s.Capture.Directory,
+				Ports:          s.Capture.Ports,
+				MaxFileSize:    s.Capture.MaxFileSize,
+				RotateInterval: s.Capture.RotateInterval,
+				MaxFiles:       s.Capture.MaxFiles,
+				SnapLength:     s.Capture.SnapLength,
+			},
+			Neighbor: internal.NeighborConfig{
+				Inspection:     s.Neighbor.Inspection,
+				Suppression:    s.Neighbor.Suppression,
+				BindingTimeout: s.Neighbor.BindingTimeout,
+			},
+			DHCPSnooping: s.DHCPSnooping,
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		l, err := internal.NewListener(internal.ListenerConfig{
+			Hostname:          s.Listener.Hostname,
+			Port:              s.Listener.Port,
+			MTU:               s.MTU,
+			NetworkMTU:        s.NetworkMTU,
+			PrivateKey:        privateKey,
+			AcceptUnknown:     s.Listener.AcceptUnknown,
+			KeepaliveInterval: s.Listener.KeepaliveInterval,
+			PeerTimeout:       s.Listener.PeerTimeout,
+			SplitHorizon:      s.SplitHorizon,
+		}, sw)
 		if err != nil {
 			panic(err)
 		}
 
 		for _, p := range s.Ports {
+			portConfig := internal.PortConfig{
+				SuppressBroadcast:      p.FloodSuppression.Broadcast,
+				SuppressMulticast:      p.FloodSuppression.Multicast,
+				SuppressUnknownUnicast: p.FloodSuppression.UnknownUnicast,
+				MaxMACs:                p.MaxMACs,
+				VLANMode:               internal.VLANMode(p.VLAN.Mode),
+				PVID:                   p.VLAN.PVID,
+				AllowedVLANs:           p.VLAN.Allowed,
+				Queue: internal.QueueConfig{
+					Size:              p.Queue.Size,
+					DropPolicy:        internal.DropPolicy(p.Queue.DropPolicy),
+					REDMinThreshold:   p.Queue.REDMinThreshold,
+					REDMaxThreshold:   p.Queue.REDMaxThreshold,
+					REDMaxProbability: p.Queue.REDMaxProbability,
+				},
+				QoS: internal.QoSConfig{
+					Trust:           internal.QoSTrust(p.QoS.Trust),
+					DefaultPriority: p.QoS.DefaultPriority,
+					Classes:         p.QoS.Classes,
+					Scheduler:       internal.Scheduler(p.QoS.Scheduler),
+					Weights:         p.QoS.Weights,
+				},
+				IngressLimit: internal.RateLimit{
+					Rate:  p.RateLimit.Ingress,
+					Burst: p.RateLimit.IngressBurst,
+				},
+				EgressLimit: internal.RateLimit{
+					Rate:  p.RateLimit.Egress,
+					Burst: p.RateLimit.EgressBurst,
+				},
+				StormControl: internal.StormControl{
+					Broadcast:      p.StormControl.Broadcast,
+					Multicast:      p.StormControl.Multicast,
+					UnknownUnicast: p.StormControl.UnknownUnicast,
+				},
+				IngressACL: acl(p.ACL.Ingress),
+				EgressACL:  acl(p.ACL.Egress),
+				Security: internal.PortSecurity{
+					StickyMACs: p.Security.StickyMACs,
+					Violation:  internal.ViolationAction(p.Security.Violation),
+					Recovery:   p.Security.Recovery,
+				},
+				DHCPTrusted: p.DHCPTrusted,
+			}
+
+			for _, mac := range p.Security.AllowedMACs {
+				allowed, _ := net.ParseMAC(mac)
+				portConfig.Security.AllowedMACs = append(portConfig.Security.AllowedMACs, allowed)
+			}
+
+			for _, rule := range p.QoS.Rules {
+				portConfig.QoS.Rules = append(portConfig.QoS.Rules, internal.QoSRule{
+					EtherType:  rule.EtherType,
+					IPProtocol: rule.IPProtocol,
+					Port:       rule.Port,
+					Priority:   rule.Priority,
+				})
+			}
+
 			if p.TAPNIC.Name != "" {
 				i, err := internal.NewTAPNIC(p.TAPNIC.Name, s.MTU)
 				if err != nil {
 					panic(err)
 				}
 
-				sw.AddPort(i)
+				sw.AddPort(i, portConfig)
+				continue
+			}
+
+			if p.TUNNIC.Name != "" {
+				i, err := internal.NewTUNNIC(tunNICConfig(p.TUNNIC, s.MTU))
+				if err != nil {
+					panic(err)
+				}
+
+				sw.AddPort(i, portConfig)
 				continue
 			}
 
-			err = l.Connect(p.Peer.Hostname, p.Peer.Port)
+			if p.Patch.Name != "" {
+				end, ok := patchEnds[[2]string{s.Name, p.Patch.Name}]
+				if ok {
+					delete(patchEnds, [2]string{s.Name, p.Patch.Name})
+				} else {
+					remote := remotePatch(cfg, p.Patch)
+					end, patchEnds[[2]string{p.Patch.Switch, p.Patch.Port}] = internal.NewPatch(patchConfig(p.Patch), patchConfig(remote))
+				}
+
+				sw.AddPort(end, portConfig)
+				continue
+			}
+
+			publicKey, err := pkg.DecodeKey(p.Peer.PublicKey)
+			if err != nil {
+				panic(err)
+			}
+
+			var presharedKey [pkg.KeySize]byte
+			if p.Peer.PresharedKey != "" {
+				presharedKey, err = pkg.DecodeKey(p.Peer.PresharedKey)
+				if err != nil {
+					panic(err)
+				}
+			}
+
+			err = l.AddPeer(p.Peer.Name, publicKey, presharedKey, portConfig)
+			if err != nil {
+				panic(err)
+			}
+
+			if p.Peer.Hostname == "" {
+				continue
+			}
+
+			err = l.Connect(p.Peer.Name, p.Peer.Hostname, p.Peer.Port)
 			if err != nil {
 				panic(err)
 			}
 		}
 
-		listeners = append(listeners, l)
+		if s.DHCPServer.Enabled {
+			server, err := internal.NewDHCPServer(dhcpServerConfig(s.DHCPServer))
+			if err != nil {
+				panic(err)
+			}
+
+			sw.AddPort(server, internal.PortConfig{
+				VLANMode:    internal.VLANModeAccess,
+				PVID:        s.DHCPServer.VLAN,
+				DHCPTrusted: true,
+			})
+
+			dhcpServers[s.Name] = server
+		}
+
+		switches[s.Name] = sw
+		listeners[s.Name] = l
+	}
+
+	for _, r := range cfg.Routers {
+		router, err := internal.NewRouter(routerConfig(r))
+		if err != nil {
+			panic(err)
+		}
+
+		for i, port := range router.Interfaces() {
+			switches[r.Interfaces[i].Switch].AddPort(port, internal.PortConfig{
+				VLANMode: internal.VLANModeAccess,
+				PVID:     r.Interfaces[i].VLAN,
+			})
+		}
 	}
 
+	var wg sync.WaitGroup
+
 	for _, listener := range listeners {
+		wg.Add(1)
 		go func() {
-			err = listener.Listen()
+			defer wg.Done()
+
+			err := listener.Listen()
 			if err != nil {
 				panic(err)
 			}
 		}()
 	}
 
-	select {}
+	go logStatus(switches, listeners, dhcpServers)
+	go toggleMirroring(switches, cfg)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	sig := <-signals
+	slog.Info("shutting down", "signal", sig.String())
+
+	for name, l := range listeners {
+		err = l.Close()
+		if err != nil {
+			slog.Error("failed to close listener", "switch", name, "error", err)
+		}
+	}
+
+	for name, sw := range switches {
+		err = sw.Close()
+		if err != nil {
+			slog.Error("failed to close switch", "switch", name, "error", err)
+		}
+	}
+
+	wg.Wait()
+}
+
+// dhcpServerConfig converts a validated dhcp server of the config
+func dhcpServerConfig(d pkg.DHCPServer) internal.DHCPServerConfig {
+	cfg := internal.DHCPServerConfig{
+		Domain:    d.Domain,
+		LeaseTime: d.LeaseTime,
+		LeaseFile: d.LeaseFile,
+		RouterAdvertisement: internal.RouterAdvertisementConfig{
+			Interval:       d.RouterAdvertisement.Interval,
+			RouterLifetime: d.RouterAdvertisement.RouterLifetime,
+		},
+	}
+
+	if d.MAC != "" {
+		cfg.MAC, _ = net.ParseMAC(d.MAC)
+	}
+
+	if d.Address != "" {
+		cfg.Address, _ = netip.ParsePrefix(d.Address)
+	}
+
+	if d.Router != "" {
+		cfg.Router, _ = netip.ParseAddr(d.Router)
+	}
+
+	for _, pool := range d.Pools {
+		start, _ := netip.ParseAddr(pool.Start)
+		end, _ := netip.ParseAddr(pool.End)
+		cfg.Pools = append(cfg.Pools, internal.DHCPPool{Start: start, End: end})
+	}
+
+	for _, r := range d.Reservations {
+		mac, _ := net.ParseMAC(r.MAC)
+		ip, _ := netip.ParseAddr(r.IP)
+		cfg.Reservations = append(cfg.Reservations, internal.DHCPReservation{MAC: mac, IP: ip})
+	}
+
+	for _, dns := range d.DNS {
+		ip, _ := netip.ParseAddr(dns)
+		cfg.DNS = append(cfg.DNS, ip)
+	}
+
+	for _, p := range d.RouterAdvertisement.Prefixes {
+		prefix, _ := netip.ParsePrefix(p)
+		cfg.RouterAdvertisement.Prefixes = append(cfg.RouterAdvertisement.Prefixes, prefix)
+	}
+
+	for _, dns := range d.RouterAdvertisement.DNS {
+		ip, _ := netip.ParseAddr(dns)
+		cfg.RouterAdvertisement.DNS = append(cfg.RouterAdvertisement.DNS, ip)
+	}
+
+	return cfg
+}
+
+// tunNICConfig converts a validated tunnic of the config
+func tunNICConfig(t pkg.TUNNIC, mtu uint16) internal.TUNNICConfig {
+	cfg := internal.TUNNICConfig{Name: t.Name, MTU: mtu}
+
+	if t.MAC != "" {
+		cfg.MAC, _ = net.ParseMAC(t.MAC)
+	}
+
+	for _, a := range t.Addresses {
+		address, _ := netip.ParsePrefix(a)
+		cfg.Addresses = append(cfg.Addresses, address)
+	}
+
+	for _, g := range t.Gateways {
+		gateway, _ := netip.ParseAddr(g)
+		cfg.Gateways = append(cfg.Gateways, gateway)
+	}
+
+	return cfg
+}
+
+// remotePatch returns the patch at the other end of a validated patch
+func remotePatch(cfg *pkg.Config, patch pkg.Patch) pkg.Patch {
+	for _, s := range cfg.Switches {
+		if s.Name != patch.Switch {
+			continue
+		}
+
+		for _, p := range s.Ports {
+			if p.Patch.Name == patch.Port {
+				return p.Patch
+			}
+		}
+	}
+
+	return pkg.Patch{}
+}
+
+func patchConfig(p pkg.Patch) internal.PatchConfig {
+	cfg := internal.PatchConfig{Name: p.Name}
+
+	for _, t := range p.VLANTranslation {
+		cfg.VLANTranslation = append(cfg.VLANTranslation, internal.VLANTranslation{Local: t.Local, Remote: t.Remote})
+	}
+
+	return cfg
+}
+
+// routerConfig converts a validated router of the config
+func routerConfig(r pkg.Router) internal.RouterConfig {
+	cfg := internal.RouterConfig{Name: r.Name}
+
+	for _, i := range r.Interfaces {
+		iface := internal.RouterInterfaceConfig{Name: i.PortName(r.Name)}
+
+		if i.MAC != "" {
+			iface.MAC, _ = net.ParseMAC(i.MAC)
+		}
+
+		for _, a := range i.Addresses {
+			address, _ := netip.ParsePrefix(a)
+			iface.Addresses = append(iface.Addresses, address)
+		}
+
+		cfg.Interfaces = append(cfg.Interfaces, iface)
+	}
+
+	for _, route := range r.Routes {
+		prefix, _ := netip.ParsePrefix(route.Prefix)
+		via, _ := netip.ParseAddr(route.Via)
+		cfg.Routes = append(cfg.Routes, internal.Route{Prefix: prefix.Masked(), Via: via})
+	}
+
+	return cfg
+}
+
+// acl converts a validated ACL of the config
+func acl(a pkg.ACL) internal.ACL {
+	result := internal.ACL{DefaultAction: internal.ACLAction(a.DefaultAction)}
+
+	for _, r := range a.Rules {
+		rule := internal.ACLRule{
+			Action:          internal.ACLAction(r.Action),
+			EtherType:       r.EtherType,
+			VLAN:            r.VLAN,
+			Protocol:        r.Protocol,
+			SourcePort:      r.SourcePort,
+			DestinationPort: r.DestinationPort,
+		}
+
+		if r.SourceMAC != "" {
+			rule.SourceMAC, _ = net.ParseMAC(r.SourceMAC)
+		}
+
+		if r.DestinationMAC != "" {
+			rule.DestinationMAC, _ = net.ParseMAC(r.DestinationMAC)
+		}
+
+		if r.SourceIP != "" {
+			rule.SourceNet, _ = pkg.ParseIPNet(r.SourceIP)
+		}
+
+		if r.DestinationIP != "" {
+			rule.DestinationNet, _ = pkg.ParseIPNet(r.DestinationIP)
+		}
+
+		result.Rules = append(result.Rules, rule)
+	}
+
+	return result
+}
+
+// logStatus logs the status of all switches, peers and dhcp leases whenever SIGUSR1 is received
+func logStatus(switches map[string]internal.Switch, listeners map[string]internal.Listener, dhcpServers map[string]internal.DHCPServer) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+
+	for range c {
+		for switchName, sw := range switches {
+			status := sw.Status()
+			slog.Info("switch status",
+				"switch", switchName,
+				"macs", status.MACs,
+				"macMoves", status.MACMoves,
+				"macLimitExceeded", status.MACLimitExceeded,
+				"bindings", status.Bindings,
+				"neighborDrops", status.NeighborDrops,
+				"neighborReplies", status.NeighborReplies,
+				"dhcpDrops", status.DHCPDrops,
+			)
+
+			for _, binding := range sw.Bindings() {
+				slog.Info("binding status",
+					"switch", switchName,
+					"vlan", binding.VLAN,
+					"ip", binding.IP.String(),
+					"mac", binding.MAC.String(),
+					"portId", binding.PortId,
+					"source", binding.Source,
+					"lastSeen", binding.LastSeen,
+					"expires", binding.Expires,
+				)
+			}
+
+			for _, port := range status.Ports {
+				slog.Info("port status",
+					"switch", switchName,
+					"portId", port.Id,
+					"port", port.Name,
+					"queued", port.Queued,
+					"drops", port.Drops,
+					"ingressRateDrops", port.IngressRateDrops,
+					"egressRateDrops", port.EgressRateDrops,
+					"stormDrops", port.StormDrops,
+					"ingressACLDrops", port.IngressACLDrops,
+					"egressACLDrops", port.EgressACLDrops,
+					"securityViolations", port.SecurityViolations,
+					"shutdown", port.Shutdown,
+				)
+
+				for _, class := range port.Classes {
+					slog.Info("port class status",
+						"switch", switchName,
+						"portId", port.Id,
+						"port", port.Name,
+						"class", class.Class,
+						"queued", class.Queued,
+						"enqueued", class.Enqueued,
+						"sent", class.Sent,
+						"drops", class.Drops,
+					)
+				}
+			}
+		}
+
+		for switchName, l := range listeners {
+			for _, status := range l.Status() {
+				slog.Info("peer status",
+					"switch", switchName,
+					"peer", status.Name,
+					"addr", status.Address,
+					"state", status.State,
+					"nextAttempt", status.NextAttempt,
+					"received", status.Statistics.Received,
+					"replayed", status.Statistics.Replayed,
+					"reordered", status.Statistics.Reordered,
+					"lost", status.Statistics.Lost,
+					"dropped", status.Statistics.Dropped,
+				)
+			}
+		}
+
+		for switchName, server := range dhcpServers {
+			for _, lease := range server.Leases() {
+				slog.Info("dhcp lease status",
+					"switch", switchName,
+					"mac", lease.MAC,
+					"ip", lease.IP.String(),
+					"expires", lease.Expires,
+				)
+			}
+		}
+	}
+}
+
+// toggleMirroring enables or disables port mirroring of all switches with a monitor port whenever SIGUSR2 is received
+func toggleMirroring(switches map[string]internal.Switch, cfg *pkg.Config) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR2)
+
+	for range c {
+		for _, s := range cfg.Switches {
+			if s.Mirror.Monitor == "" {
+				continue
+			}
+
+			sw := switches[s.Name]
+			sw.SetMirroring(!sw.Mirroring())
+			slog.Info("toggled mirroring", "switch", s.Name, "enabled", sw.Mirroring(), "monitor", s.Mirror.Monitor)
+		}
+	}
+}
+
+func genKey() {
+	privateKey, err := internal.GenerateKey()
+	if err != nil {
+		panic(err)
+	}
+
+	publicKey, err := internal.PublicKey(privateKey)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("private_key: %s\n", pkg.EncodeKey(privateKey))
+	fmt.Printf("public_key: %s\n", pkg.EncodeKey(publicKey))
 }
@@ -3,15 +3,15 @@ module github.com/lucasl0st/trestle
 go 1.22
 
 require (
+	github.com/go-yaml/yaml v2.1.0+incompatible
 	github.com/milosgajdos/tenus v0.0.3
 	github.com/songgao/packets v0.0.0-20160404182456-549a10cd4091
 	github.com/songgao/water v0.0.0-20200317203138-2b4b6d7c09d8
+	golang.org/x/crypto v0.26.0
 	google.golang.org/protobuf v1.34.2
 )
 
 require (
 	github.com/docker/libcontainer v2.2.1+incompatible // indirect
-	github.com/go-yaml/yaml v2.1.0+incompatible // indirect
-	github.com/google/uuid v1.6.0 // indirect
 	golang.org/x/sys v0.24.0 // indirect
 )
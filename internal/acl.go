@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"bytes"
+	"net"
+	"sync/atomic"
+)
+
+type ACLAction string
+
+const (
+	ACLAllow ACLAction = "allow"
+	ACLDeny  ACLAction = "deny"
+)
+
+// ACLRule matches frames by their headers, fields that are not set match everything
+type ACLRule struct {
+	Action ACLAction
+
+	SourceMAC      net.HardwareAddr
+	DestinationMAC net.HardwareAddr
+	EtherType      uint16
+	VLAN           uint16
+
+	SourceNet       *net.IPNet
+	DestinationNet  *net.IPNet
+	Protocol        uint8
+	SourcePort      uint16
+	DestinationPort uint16
+}
+
+// ACL is an ordered list of rules, the action of the first matching rule is applied to a frame
+type ACL struct {
+	Rules []ACLRule
+	// DefaultAction is applied to frames no rule matches, allow if empty
+	DefaultAction ACLAction
+}
+
+// aclCounters are the amounts of frames denied by the ACLs of a port
+type aclCounters struct {
+	ingress atomic.Uint64
+	egress  atomic.Uint64
+}
+
+// allows returns whether a frame switched in a VLAN is allowed by the ACL
+func (a ACL) allows(frame []byte, vlan uint16, info frameInfo) bool {
+	for _, rule := range a.Rules {
+		if rule.matches(frame, vlan, info) {
+			return rule.Action != ACLDeny
+		}
+	}
+
+	return a.DefaultAction != ACLDeny
+}
+
+func (r ACLRule) matches(frame []byte, vlan uint16, info frameInfo) bool {
+	if r.SourceMAC != nil && !bytes.Equal(r.SourceMAC, frame[6:12]) {
+		return false
+	}
+
+	if r.DestinationMAC != nil && !bytes.Equal(r.DestinationMAC, frame[0:6]) {
+		return false
+	}
+
+	if r.EtherType != 0 && r.EtherType != info.etherType {
+		return false
+	}
+
+	if r.VLAN != 0 && r.VLAN != vlan {
+		return false
+	}
+
+	if (r.SourceNet != nil || r.DestinationNet != nil || r.Protocol != 0) && !info.ip {
+		return false
+	}
+
+	if r.SourceNet != nil && !r.SourceNet.Contains(info.sourceIP) {
+		return false
+	}
+
+	if r.DestinationNet != nil && !r.DestinationNet.Contains(info.destinationIP) {
+		return false
+	}
+
+	// deny rules match packets whose protocol or ports could not be parsed, rules fail closed
+	if r.Protocol != 0 && r.Protocol != info.protocol {
+		return info.incomplete && info.protocol == 0 && r.Action == ACLDeny
+	}
+
+	if (r.SourcePort != 0 || r.DestinationPort != 0) && !info.l4 {
+		return info.incomplete && r.Action == ACLDeny
+	}
+
+	if r.SourcePort != 0 && r.SourcePort != info.sourcePort {
+		return false
+	}
+
+	if r.DestinationPort != 0 && r.DestinationPort != info.destinationPort {
+		return false
+	}
+
+	return true
+}
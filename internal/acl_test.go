@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"github.com/songgao/packets/ethernet"
+	"net"
+	"testing"
+)
+
+func testNet(s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return ipNet
+}
+
+func TestACLAllows(t *testing.T) {
+	denySSH := ACL{Rules: []ACLRule{{Action: ACLDeny, Protocol: ipProtocolTCP, DestinationPort: 22}}}
+	denyTCP := ACL{Rules: []ACLRule{{Action: ACLDeny, Protocol: ipProtocolTCP}}}
+	onlyDNS := ACL{
+		Rules:         []ACLRule{{Action: ACLAllow, Protocol: ipProtocolUDP, DestinationPort: 53}},
+		DefaultAction: ACLDeny,
+	}
+
+	ssh := testTransport(ipProtocolTCP, 1000, 22)
+	dns := testTransport(ipProtocolUDP, 1000, 53)
+
+	tests := []struct {
+		name    string
+		acl     ACL
+		frame   ethernet.Frame
+		vlan    uint16
+		allowed bool
+	}{
+		{
+			name:    "empty acl",
+			frame:   testIPv4Frame(ipProtocolTCP, ssh),
+			allowed: true,
+		},
+		{
+			name:    "default deny",
+			acl:     ACL{DefaultAction: ACLDeny},
+			frame:   testIPv4Frame(ipProtocolTCP, ssh),
+			allowed: false,
+		},
+		{
+			name:    "first matching rule",
+			acl:     ACL{Rules: []ACLRule{{Action: ACLAllow, SourceNet: testNet("192.0.2.0/24")}, denySSH.Rules[0]}},
+			frame:   testIPv4Frame(ipProtocolTCP, ssh),
+			allowed: true,
+		},
+		{
+			name:    "mac",
+			acl:     ACL{Rules: []ACLRule{{Action: ACLDeny, SourceMAC: testMAC("02:00:00:00:00:0a")}}},
+			frame:   testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0a"),
+			allowed: false,
+		},
+		{
+			name:    "vlan",
+			acl:     ACL{Rules: []ACLRule{{Action: ACLDeny, VLAN: 20}}},
+			frame:   testIPv4Frame(ipProtocolTCP, ssh),
+			vlan:    10,
+			allowed: true,
+		},
+		{
+			name:    "destination net",
+			acl:     ACL{Rules: []ACLRule{{Action: ACLDeny, DestinationNet: testNet("2001:db8::/64")}}},
+			frame:   testIPv6Frame(ipProtocolUDP, dns),
+			allowed: false,
+		},
+		{
+			name:    "ipv4 port",
+			acl:     denySSH,
+			frame:   testIPv4Frame(ipProtocolTCP, ssh),
+			allowed: false,
+		},
+		{
+			name:    "other port",
+			acl:     denySSH,
+			frame:   testIPv4Frame(ipProtocolTCP, testTransport(ipProtocolTCP, 1000, 443)),
+			allowed: true,
+		},
+		{
+			name:    "protocol without ports",
+			acl:     denySSH,
+			frame:   testIPv4Frame(ipProtocolICMP, make([]byte, 8)),
+			allowed: true,
+		},
+		{
+			name:    "ipv4 later fragment",
+			acl:     denySSH,
+			frame:   testFragment(testIPv4Frame(ipProtocolTCP, ssh), 185),
+			allowed: false,
+		},
+		{
+			name:    "ipv6 port",
+			acl:     denySSH,
+			frame:   testIPv6Frame(ipProtocolTCP, ssh),
+			allowed: false,
+		},
+		{
+			name:    "ipv6 port behind hop-by-hop header",
+			acl:     denySSH,
+			frame:   testIPv6Frame(ipProtocolHopByHop, concat(testExtensionHeader(ipProtocolTCP), ssh)),
+			allowed: false,
+		},
+		{
+			name: "ipv6 port behind extension headers",
+			acl:  denySSH,
+			frame: testIPv6Frame(ipProtocolDestination, concat(
+				testExtensionHeader(ipProtocolRouting),
+				testExtensionHeader(ipProtocolFragment),
+				testFragmentHeader(ipProtocolTCP, 0),
+				ssh,
+			)),
+			allowed: false,
+		},
+		{
+			name:    "ipv6 later fragment",
+			acl:     denySSH,
+			frame:   testIPv6Frame(ipProtocolFragment, concat(testFragmentHeader(ipProtocolTCP, 10), make([]byte, 16))),
+			allowed: false,
+		},
+		{
+			name:    "ipv6 truncated extension header",
+			acl:     denyTCP,
+			frame:   testIPv6Frame(ipProtocolHopByHop, []byte{ipProtocolTCP, 1, 0, 0, 0, 0, 0, 0}),
+			allowed: false,
+		},
+		{
+			name:    "double tagged",
+			acl:     denySSH,
+			frame:   testStacked(testIPv4Frame(ipProtocolTCP, ssh), vlanTPID),
+			allowed: false,
+		},
+		{
+			name:    "allow rule",
+			acl:     onlyDNS,
+			frame:   testIPv6Frame(ipProtocolHopByHop, concat(testExtensionHeader(ipProtocolUDP), dns)),
+			allowed: true,
+		},
+		{
+			name:    "allow rule does not match unknown ports",
+			acl:     onlyDNS,
+			frame:   testIPv6Frame(ipProtocolFragment, concat(testFragmentHeader(ipProtocolUDP, 10), make([]byte, 16))),
+			allowed: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allowed := test.acl.allows(test.frame, test.vlan, parseFrame(test.frame))
+			if allowed != test.allowed {
+				t.Fatalf("allowed is %t, expected %t", allowed, test.allowed)
+			}
+		})
+	}
+}
+
+func TestSwitchIngressACL(t *testing.T) {
+	sw := newTestSwitch(t, SwitchConfig{})
+	a, b := newTestPort("a"), newTestPort("b")
+	sw.AddPort(a, PortConfig{IngressACL: ACL{Rules: []ACLRule{{Action: ACLDeny, Protocol: ipProtocolTCP, DestinationPort: 22}}}})
+	sw.AddPort(b, PortConfig{})
+
+	ssh := testTransport(ipProtocolTCP, 1000, 22)
+
+	a.in <- testIPv6Frame(ipProtocolHopByHop, concat(testExtensionHeader(ipProtocolTCP), ssh))
+	expectFrame(t, b, false)
+
+	a.in <- testIPv6Frame(ipProtocolTCP, testTransport(ipProtocolTCP, 1000, 443))
+	expectFrame(t, b, true)
+}
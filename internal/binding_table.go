@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"net"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+)
+
+type BindingSource string
+
+const (
+	// BindingSourceARP are bindings snooped from ARP packets
+	BindingSourceARP BindingSource = "arp"
+	// BindingSourceND are bindings snooped from neighbor discovery packets
+	BindingSourceND BindingSource = "nd"
+	// BindingSourceDHCP are leases snooped from DHCP acknowledgements of trusted servers
+	BindingSourceDHCP BindingSource = "dhcp"
+)
+
+// Binding is an IP address bound to a hardware address in a VLAN
+type Binding struct {
+	VLAN     uint16
+	IP       netip.Addr
+	MAC      net.HardwareAddr
+	PortId   uint
+	Source   BindingSource
+	LastSeen time.Time
+	// Expires is the time the binding is removed at, bindings without expiry are removed with their port,
+	// leases expire with their lease time
+	Expires time.Time
+}
+
+type bindingKey struct {
+	vlan uint16
+	ip   netip.Addr
+}
+
+// bindingTable is a thread-safe table of IP to hardware address bindings
+type bindingTable struct {
+	sync.RWMutex
+
+	bindings map[bindingKey]Binding
+}
+
+func newBindingTable() *bindingTable {
+	return &bindingTable{
+		bindings: map[bindingKey]Binding{},
+	}
+}
+
+func (t *bindingTable) lookup(vlan uint16, ip netip.Addr) (Binding, bool) {
+	t.RLock()
+	defer t.RUnlock()
+
+	b, ok := t.bindings[bindingKey{vlan: vlan, ip: ip}]
+	if ok && !b.Expires.IsZero() && time.Now().After(b.Expires) {
+		return Binding{}, false
+	}
+
+	return b, ok
+}
+
+// set adds or refreshes a binding
+func (t *bindingTable) set(b Binding) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.bindings[bindingKey{vlan: b.VLAN, ip: b.IP}] = b
+}
+
+func (t *bindingTable) delete(vlan uint16, ip netip.Addr) {
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.bindings, bindingKey{vlan: vlan, ip: ip})
+}
+
+// list returns all bindings sorted by VLAN and IP
+func (t *bindingTable) list() []Binding {
+	t.RLock()
+	defer t.RUnlock()
+
+	bindings := make([]Binding, 0, len(t.bindings))
+	for _, b := range t.bindings {
+		bindings = append(bindings, b)
+	}
+
+	sort.Slice(bindings, func(i, j int) bool {
+		if bindings[i].VLAN != bindings[j].VLAN {
+			return bindings[i].VLAN < bindings[j].VLAN
+		}
+
+		return bindings[i].IP.Less(bindings[j].IP)
+	})
+
+	return bindings
+}
+
+// removePort removes all bindings of hosts on portId
+func (t *bindingTable) removePort(portId uint) {
+	t.Lock()
+	defer t.Unlock()
+
+	for key, b := range t.bindings {
+		if b.PortId == portId {
+			delete(t.bindings, key)
+		}
+	}
+}
+
+// expire removes all expired bindings and returns their amount
+func (t *bindingTable) expire() int {
+	t.Lock()
+	defer t.Unlock()
+
+	now := time.Now()
+	expired := 0
+
+	for key, b := range t.bindings {
+		if !b.Expires.IsZero() && now.After(b.Expires) {
+			delete(t.bindings, key)
+			expired++
+		}
+	}
+
+	return expired
+}
+
+func (t *bindingTable) size() int {
+	t.RLock()
+	defer t.RUnlock()
+
+	return len(t.bindings)
+}
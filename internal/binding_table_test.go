@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestBindingTable(t *testing.T) {
+	table := newBindingTable()
+	now := time.Now()
+
+	bindings := []Binding{
+		{VLAN: 2, IP: netip.MustParseAddr("10.0.0.1"), PortId: 1},
+		{VLAN: 1, IP: netip.MustParseAddr("10.0.0.2"), PortId: 2},
+		{VLAN: 1, IP: netip.MustParseAddr("10.0.0.1"), PortId: 1, Expires: now.Add(time.Minute)},
+		{VLAN: 1, IP: netip.MustParseAddr("10.0.0.3"), PortId: 2, Expires: now.Add(-time.Second)},
+	}
+
+	for _, b := range bindings {
+		table.set(b)
+	}
+
+	tests := []struct {
+		name  string
+		vlan  uint16
+		ip    string
+		found bool
+	}{
+		{name: "without expiry", vlan: 1, ip: "10.0.0.2", found: true},
+		{name: "not expired", vlan: 1, ip: "10.0.0.1", found: true},
+		{name: "expired", vlan: 1, ip: "10.0.0.3"},
+		{name: "other vlan", vlan: 2, ip: "10.0.0.2"},
+		{name: "unknown", vlan: 1, ip: "10.0.0.4"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, found := table.lookup(test.vlan, netip.MustParseAddr(test.ip))
+			if found != test.found {
+				t.Fatalf("found is %t, expected %t", found, test.found)
+			}
+		})
+	}
+
+	// bindings are sorted by VLAN and IP
+	list := table.list()
+	expected := []Binding{bindings[2], bindings[1], bindings[3], bindings[0]}
+	if len(list) != len(expected) {
+		t.Fatalf("table lists %d bindings, expected %d", len(list), len(expected))
+	}
+
+	for i, b := range list {
+		if b.VLAN != expected[i].VLAN || b.IP != expected[i].IP {
+			t.Fatalf("binding %d is %d %s, expected %d %s", i, b.VLAN, b.IP, expected[i].VLAN, expected[i].IP)
+		}
+	}
+
+	expired := table.expire()
+	if expired != 1 || table.size() != 3 {
+		t.Fatalf("expired %d bindings with %d left, expected 1 expired and 3 left", expired, table.size())
+	}
+
+	table.removePort(1)
+	if table.size() != 1 {
+		t.Fatalf("%d bindings are left after removing the port, expected 1", table.size())
+	}
+
+	table.delete(1, netip.MustParseAddr("10.0.0.2"))
+	if table.size() != 0 {
+		t.Fatal("binding was not deleted")
+	}
+}
@@ -0,0 +1,272 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/lucasl0st/trestle/internal/util"
+	"github.com/songgao/packets/ethernet"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	pcapngSectionHeaderBlock    = 0x0a0d0d0a
+	pcapngInterfaceBlock        = 0x00000001
+	pcapngEnhancedPacketBlock   = 0x00000006
+	pcapngByteOrderMagic        = 0x1a2b3c4d
+	pcapngLinkTypeEthernet      = 1
+	pcapngOptionEnd             = 0
+	pcapngOptionApplication     = 4
+	pcapngOptionInterfaceName   = 2
+	pcapngOptionDescription     = 3
+	pcapngOptionTimeResolution  = 9
+	pcapngOptionPacketFlags     = 2
+	pcapngTimeResolutionNanosec = 9
+)
+
+const defaultSnapLength = 65535
+
+type captureDirection uint32
+
+// directions as defined by the pcapng packet flags
+const (
+	captureInbound  captureDirection = 1
+	captureOutbound captureDirection = 2
+)
+
+// CaptureConfig is the capture of the frames received and sent by the ports of a switch into pcapng files
+type CaptureConfig struct {
+	// Directory is the directory the capture files are written to, capturing is disabled if empty
+	Directory string
+	// Ports are the names of the captured ports, all ports if empty
+	Ports []string
+	// MaxFileSize is the size in bytes after which a new file is started, 0 is unlimited
+	MaxFileSize int64
+	// RotateInterval is the duration after which a new file is started, 0 is unlimited
+	RotateInterval time.Duration
+	// MaxFiles is the amount of files kept, older files are removed, 0 is unlimited
+	MaxFiles int
+	// SnapLength is the maximum amount of bytes captured of each frame
+	SnapLength int
+}
+
+// capture is a thread-safe pcapng writer, every port is an interface of the capture file
+type capture struct {
+	sync.Mutex
+
+	switchName string
+	cfg        CaptureConfig
+
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	// portId -> interface id in the current file
+	interfaces map[uint]uint32
+	files      []string
+
+	// failures is the amount of frames that could not be written, a full disk fails every frame
+	failures uint64
+	errorLog *util.LogLimiter
+}
+
+func newCapture(switchName string, cfg CaptureConfig) (*capture, error) {
+	if cfg.Directory == "" {
+		return nil, nil
+	}
+
+	if cfg.SnapLength == 0 {
+		cfg.SnapLength = defaultSnapLength
+	}
+
+	c := &capture{
+		switchName: switchName,
+		cfg:        cfg,
+		errorLog:   util.NewLogLimiter(logInterval),
+	}
+
+	err := c.rotate()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// write writes a frame received on or sent to a port to the capture file, captures are nil if disabled
+func (c *capture) write(portId uint, portName string, frame ethernet.Frame, direction captureDirection) {
+	if c == nil {
+		return
+	}
+
+	if len(c.cfg.Ports) > 0 && !slices.Contains(c.cfg.Ports, portName) {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+
+	if c.file == nil ||
+		c.cfg.MaxFileSize > 0 && c.size >= c.cfg.MaxFileSize ||
+		c.cfg.RotateInterval > 0 && now.Sub(c.openedAt) >= c.cfg.RotateInterval {
+		err := c.rotate()
+		if err != nil {
+			c.fail("failed to rotate capture file", err)
+			return
+		}
+	}
+
+	interfaceId, ok := c.interfaces[portId]
+	if !ok {
+		interfaceId = uint32(len(c.interfaces))
+
+		err := c.writeBlock(interfaceBlock(portId, portName, c.cfg.SnapLength))
+		if err != nil {
+			c.fail("failed to write capture file", err)
+			return
+		}
+
+		c.interfaces[portId] = interfaceId
+	}
+
+	err := c.writeBlock(packetBlock(interfaceId, now, frame, c.cfg.SnapLength, direction))
+	if err != nil {
+		c.fail("failed to write capture file", err)
+	}
+}
+
+// fail counts a frame that could not be captured, the caller must hold the lock
+func (c *capture) fail(message string, err error) {
+	c.failures++
+
+	if c.errorLog.Allow() {
+		slog.Error(message, "switch", c.switchName, "failures", c.failures, "error", err)
+	}
+}
+
+// rotate closes the current file and starts a new one, removing the oldest files above the maximum
+func (c *capture) rotate() error {
+	if c.file != nil {
+		err := c.file.Close()
+		c.file = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	path := filepath.Join(c.cfg.Directory, fmt.Sprintf("%s-%s.pcapng", c.switchName, now.Format("20060102-150405.000000")))
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+
+	c.file = file
+	c.size = 0
+	c.openedAt = now
+	c.interfaces = map[uint]uint32{}
+	c.files = append(c.files, path)
+
+	for c.cfg.MaxFiles > 0 && len(c.files) > c.cfg.MaxFiles {
+		err = os.Remove(c.files[0])
+		if err != nil && !os.IsNotExist(err) {
+			slog.Error("failed to remove capture file", "switch", c.switchName, "path", c.files[0], "error", err)
+		}
+
+		c.files = c.files[1:]
+	}
+
+	slog.Info("started capture file", "switch", c.switchName, "path", path)
+	return c.writeBlock(sectionHeaderBlock())
+}
+
+func (c *capture) writeBlock(block []byte) error {
+	n, err := c.file.Write(block)
+	c.size += int64(n)
+	return err
+}
+
+func (c *capture) close() error {
+	if c == nil {
+		return nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.file == nil {
+		return nil
+	}
+
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+func sectionHeaderBlock() []byte {
+	body := binary.LittleEndian.AppendUint32(nil, pcapngByteOrderMagic)
+	body = binary.LittleEndian.AppendUint16(body, 1)
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	// the section length is not known in advance
+	body = binary.LittleEndian.AppendUint64(body, 0xffffffffffffffff)
+	body = appendOption(body, pcapngOptionApplication, []byte("trestle"))
+	body = appendOption(body, pcapngOptionEnd, nil)
+
+	return block(pcapngSectionHeaderBlock, body)
+}
+
+func interfaceBlock(portId uint, portName string, snapLength int) []byte {
+	body := binary.LittleEndian.AppendUint16(nil, pcapngLinkTypeEthernet)
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, uint32(snapLength))
+	body = appendOption(body, pcapngOptionInterfaceName, []byte(portName))
+	body = appendOption(body, pcapngOptionDescription, []byte(fmt.Sprintf("port %d", portId)))
+	body = appendOption(body, pcapngOptionTimeResolution, []byte{pcapngTimeResolutionNanosec})
+	body = appendOption(body, pcapngOptionEnd, nil)
+
+	return block(pcapngInterfaceBlock, body)
+}
+
+func packetBlock(interfaceId uint32, t time.Time, frame ethernet.Frame, snapLength int, direction captureDirection) []byte {
+	captured := frame[:min(len(frame), snapLength)]
+	timestamp := uint64(t.UnixNano())
+
+	body := binary.LittleEndian.AppendUint32(nil, interfaceId)
+	body = binary.LittleEndian.AppendUint32(body, uint32(timestamp>>32))
+	body = binary.LittleEndian.AppendUint32(body, uint32(timestamp))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(captured)))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(frame)))
+	body = appendPadded(body, captured)
+	body = appendOption(body, pcapngOptionPacketFlags, binary.LittleEndian.AppendUint32(nil, uint32(direction)))
+	body = appendOption(body, pcapngOptionEnd, nil)
+
+	return block(pcapngEnhancedPacketBlock, body)
+}
+
+// block frames a block body with its type and total length
+func block(blockType uint32, body []byte) []byte {
+	length := uint32(len(body) + 12)
+
+	b := binary.LittleEndian.AppendUint32(nil, blockType)
+	b = binary.LittleEndian.AppendUint32(b, length)
+	b = append(b, body...)
+	return binary.LittleEndian.AppendUint32(b, length)
+}
+
+func appendOption(b []byte, code uint16, value []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(value)))
+	return appendPadded(b, value)
+}
+
+// appendPadded appends data padded to 32 bits
+func appendPadded(b []byte, data []byte) []byte {
+	b = append(b, data...)
+	return append(b, make([]byte, (4-len(data)%4)%4)...)
+}
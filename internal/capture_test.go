@@ -0,0 +1,247 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+type testBlock struct {
+	blockType uint32
+	body      []byte
+}
+
+// readBlocks splits pcapng data into its blocks, it fails the test if the data is not framed correctly
+func readBlocks(t *testing.T, data []byte) []testBlock {
+	t.Helper()
+
+	var blocks []testBlock
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatalf("%d bytes left after the last block", len(data))
+		}
+
+		length := binary.LittleEndian.Uint32(data[4:8])
+		if length%4 != 0 || int(length) > len(data) || binary.LittleEndian.Uint32(data[length-4:length]) != length {
+			t.Fatalf("block length %d is invalid", length)
+		}
+
+		blocks = append(blocks, testBlock{blockType: binary.LittleEndian.Uint32(data[:4]), body: data[8 : length-4]})
+		data = data[length:]
+	}
+
+	return blocks
+}
+
+func TestSectionHeaderBlock(t *testing.T) {
+	blocks := readBlocks(t, sectionHeaderBlock())
+	if len(blocks) != 1 || blocks[0].blockType != pcapngSectionHeaderBlock {
+		t.Fatal("section header block is invalid")
+	}
+
+	if binary.LittleEndian.Uint32(blocks[0].body[:4]) != pcapngByteOrderMagic {
+		t.Fatal("byte order magic is invalid")
+	}
+}
+
+func TestPacketBlock(t *testing.T) {
+	frame := testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0a")
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		frame      []byte
+		snapLength int
+		captured   int
+	}{
+		{name: "whole frame", frame: frame, snapLength: defaultSnapLength, captured: len(frame)},
+		{name: "padded frame", frame: frame[:59], snapLength: defaultSnapLength, captured: 59},
+		{name: "snap length", frame: frame, snapLength: 14, captured: 14},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blocks := readBlocks(t, packetBlock(3, now, test.frame, test.snapLength, captureOutbound))
+			if len(blocks) != 1 || blocks[0].blockType != pcapngEnhancedPacketBlock {
+				t.Fatal("enhanced packet block is invalid")
+			}
+
+			body := blocks[0].body
+			interfaceId := binary.LittleEndian.Uint32(body[0:4])
+			timestamp := uint64(binary.LittleEndian.Uint32(body[4:8]))<<32 | uint64(binary.LittleEndian.Uint32(body[8:12]))
+			captured := binary.LittleEndian.Uint32(body[12:16])
+			length := binary.LittleEndian.Uint32(body[16:20])
+
+			if interfaceId != 3 || timestamp != uint64(now.UnixNano()) {
+				t.Fatalf("block has interface %d and timestamp %d, expected 3 and %d", interfaceId, timestamp, now.UnixNano())
+			}
+
+			if int(captured) != test.captured || int(length) != len(test.frame) {
+				t.Fatalf("block captured %d of %d bytes, expected %d of %d", captured, length, test.captured, len(test.frame))
+			}
+
+			if !bytes.Equal(body[20:20+captured], test.frame[:test.captured]) {
+				t.Fatal("captured bytes differ from the frame")
+			}
+
+			options := body[20+(captured+3)/4*4:]
+			code := binary.LittleEndian.Uint16(options[0:2])
+			flags := binary.LittleEndian.Uint32(options[4:8])
+			if code != pcapngOptionPacketFlags || captureDirection(flags) != captureOutbound {
+				t.Fatalf("block has option %d with flags %d, expected packet flags with outbound direction", code, flags)
+			}
+		})
+	}
+}
+
+// captureFiles returns the blocks of the capture files in a directory
+func captureFiles(t *testing.T, directory string) [][]testBlock {
+	t.Helper()
+
+	paths, err := filepath.Glob(filepath.Join(directory, "*.pcapng"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files [][]testBlock
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files = append(files, readBlocks(t, data))
+	}
+
+	return files
+}
+
+func TestCapture(t *testing.T) {
+	directory := t.TempDir()
+
+	c, err := newCapture("test", CaptureConfig{Directory: directory, Ports: []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0a")
+	c.write(1, "a", frame, captureInbound)
+	c.write(2, "b", frame, captureOutbound)
+	c.write(1, "a", frame, captureOutbound)
+	c.write(3, "c", frame, captureInbound)
+
+	err = c.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := captureFiles(t, directory)
+	if len(files) != 1 {
+		t.Fatalf("capture wrote %d files, expected 1", len(files))
+	}
+
+	// every captured port is an interface, frames of ports that are not captured are skipped
+	var types []uint32
+	for _, b := range files[0] {
+		types = append(types, b.blockType)
+	}
+
+	expected := []uint32{
+		pcapngSectionHeaderBlock,
+		pcapngInterfaceBlock,
+		pcapngEnhancedPacketBlock,
+		pcapngInterfaceBlock,
+		pcapngEnhancedPacketBlock,
+		pcapngEnhancedPacketBlock,
+	}
+
+	if !slices.Equal(types, expected) {
+		t.Fatalf("capture file has blocks %v, expected %v", types, expected)
+	}
+
+	if binary.LittleEndian.Uint32(files[0][5].body[0:4]) != 0 {
+		t.Fatal("second frame of port a was not written to its interface")
+	}
+}
+
+func TestCaptureRotation(t *testing.T) {
+	frame := testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0a")
+
+	tests := []struct {
+		name string
+		cfg  CaptureConfig
+		// expire moves the start of the current file into the past after every write
+		expire bool
+		files  int
+	}{
+		{
+			name:  "max file size",
+			cfg:   CaptureConfig{MaxFileSize: 1},
+			files: 5,
+		},
+		{
+			name:  "max files",
+			cfg:   CaptureConfig{MaxFileSize: 1, MaxFiles: 2},
+			files: 2,
+		},
+		{
+			name:   "rotate interval",
+			cfg:    CaptureConfig{RotateInterval: time.Minute},
+			expire: true,
+			files:  4,
+		},
+		{
+			name:  "unlimited",
+			cfg:   CaptureConfig{},
+			files: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.cfg.Directory = t.TempDir()
+
+			c, err := newCapture("test", test.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for range 4 {
+				c.write(1, "a", frame, captureInbound)
+
+				if test.expire {
+					c.openedAt = c.openedAt.Add(-time.Minute)
+				}
+			}
+
+			err = c.close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c.failures != 0 {
+				t.Fatalf("capture failed to write %d frames", c.failures)
+			}
+
+			files := captureFiles(t, test.cfg.Directory)
+			if len(files) != test.files {
+				t.Fatalf("capture wrote %d files, expected %d", len(files), test.files)
+			}
+
+			// every file starts with its own section header and interfaces
+			for _, blocks := range files {
+				if blocks[0].blockType != pcapngSectionHeaderBlock {
+					t.Fatal("capture file does not start with a section header block")
+				}
+
+				if len(blocks) > 1 && blocks[1].blockType != pcapngInterfaceBlock {
+					t.Fatal("frame was written before its interface")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+)
+
+const (
+	dhcpServerPort   = 67
+	dhcpClientPort   = 68
+	dhcpv6ServerPort = 547
+	dhcpv6ClientPort = 546
+
+	udpHeaderSize = 8
+
+	bootpMinSize    = 240
+	bootpRequest    = 1
+	bootpReply      = 2
+	dhcpMagicCookie = 0x63825363
+	// dhcpFlagBroadcast is set by clients that can not receive unicast replies before they are configured
+	dhcpFlagBroadcast = 0x8000
+
+	dhcpOptionPad         = 0
+	dhcpOptionSubnetMask  = 1
+	dhcpOptionRouter      = 3
+	dhcpOptionDNS         = 6
+	dhcpOptionDomainName  = 15
+	dhcpOptionRequestedIP = 50
+	dhcpOptionLeaseTime   = 51
+	dhcpOptionMessageType = 53
+	dhcpOptionServerID    = 54
+	dhcpOptionRenewalTime = 58
+	dhcpOptionRebindTime  = 59
+	dhcpOptionEnd         = 255
+
+	dhcpDiscover = 1
+	dhcpOffer    = 2
+	dhcpRequest  = 3
+	dhcpDecline  = 4
+	dhcpAck      = 5
+	dhcpNak      = 6
+	dhcpRelease  = 7
+	dhcpInform   = 8
+
+	dhcpInfiniteLease = 0xffffffff
+)
+
+// dhcpMessage are the fields of a DHCPv4 message used by snooping and the server
+type dhcpMessage struct {
+	op          byte
+	messageType byte
+	xid         uint32
+	flags       uint16
+	clientIP    netip.Addr
+	yourIP      netip.Addr
+	relayIP     netip.Addr
+	requestedIP netip.Addr
+	serverID    netip.Addr
+	clientMAC   net.HardwareAddr
+	leaseTime   uint32
+}
+
+// udpPayload returns the UDP payload of an untagged frame
+func udpPayload(frame []byte, info frameInfo) ([]byte, bool) {
+	if !info.l4 || info.protocol != ipProtocolUDP {
+		return nil, false
+	}
+
+	if len(frame) < info.transportOffset+udpHeaderSize {
+		return nil, false
+	}
+
+	return frame[info.transportOffset+udpHeaderSize:], true
+}
+
+func parseDHCP(payload []byte) (dhcpMessage, bool) {
+	if len(payload) < bootpMinSize || binary.BigEndian.Uint32(payload[236:240]) != dhcpMagicCookie {
+		return dhcpMessage{}, false
+	}
+
+	// only ethernet hardware addresses are supported
+	if payload[1] != arpHardwareEth || payload[2] != 6 {
+		return dhcpMessage{}, false
+	}
+
+	m := dhcpMessage{
+		op:        payload[0],
+		xid:       binary.BigEndian.Uint32(payload[4:8]),
+		flags:     binary.BigEndian.Uint16(payload[10:12]),
+		clientIP:  netip.AddrFrom4([4]byte(payload[12:16])),
+		yourIP:    netip.AddrFrom4([4]byte(payload[16:20])),
+		relayIP:   netip.AddrFrom4([4]byte(payload[24:28])),
+		clientMAC: net.HardwareAddr(payload[28:34]),
+	}
+
+	options := payload[bootpMinSize:]
+	for len(options) > 0 && options[0] != dhcpOptionEnd {
+		if options[0] == dhcpOptionPad {
+			options = options[1:]
+			continue
+		}
+
+		if len(options) < 2 || len(options) < 2+int(options[1]) {
+			break
+		}
+
+		value := options[2 : 2+int(options[1])]
+
+		switch {
+		case options[0] == dhcpOptionMessageType && len(value) == 1:
+			m.messageType = value[0]
+		case options[0] == dhcpOptionRequestedIP && len(value) == 4:
+			m.requestedIP = netip.AddrFrom4([4]byte(value))
+		case options[0] == dhcpOptionServerID && len(value) == 4:
+			m.serverID = netip.AddrFrom4([4]byte(value))
+		case options[0] == dhcpOptionLeaseTime && len(value) == 4:
+			m.leaseTime = binary.BigEndian.Uint32(value)
+		}
+
+		options = options[2+len(value):]
+	}
+
+	return m, m.messageType != 0
+}
@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DHCPLease is an address leased to a client, leases without hardware address are declined addresses
+type DHCPLease struct {
+	MAC     string     `json:"mac"`
+	IP      netip.Addr `json:"ip"`
+	Expires time.Time  `json:"expires"`
+
+	// offered is set until the client requested the address, offers are never persisted
+	offered bool
+}
+
+func (l DHCPLease) expired(now time.Time) bool {
+	return now.After(l.Expires)
+}
+
+// dhcpLeaseTable is a thread-safe table of DHCP leases that is persisted to a file
+type dhcpLeaseTable struct {
+	sync.Mutex
+
+	// file is the path leases are persisted to, leases are only kept in memory if empty
+	file string
+	// ip -> lease
+	leases map[netip.Addr]DHCPLease
+}
+
+// newDHCPLeaseTable loads the unexpired leases of the file if it exists
+func newDHCPLeaseTable(file string) (*dhcpLeaseTable, error) {
+	t := &dhcpLeaseTable{
+		file:   file,
+		leases: map[netip.Addr]DHCPLease{},
+	}
+
+	if file == "" {
+		return t, nil
+	}
+
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var leases []DHCPLease
+	err = json.Unmarshal(b, &leases)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, lease := range leases {
+		if !lease.expired(now) {
+			t.leases[lease.IP] = lease
+		}
+	}
+
+	return t, nil
+}
+
+// lookup returns the unexpired lease of an address
+func (t *dhcpLeaseTable) lookup(ip netip.Addr) (DHCPLease, bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	lease, ok := t.leases[ip]
+	if !ok || lease.expired(time.Now()) {
+		return DHCPLease{}, false
+	}
+
+	return lease, true
+}
+
+// lookupMAC returns the unexpired lease of a client
+func (t *dhcpLeaseTable) lookupMAC(mac string) (DHCPLease, bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	now := time.Now()
+	for _, lease := range t.leases {
+		if lease.MAC == mac && !lease.expired(now) {
+			return lease, true
+		}
+	}
+
+	return DHCPLease{}, false
+}
+
+// offer holds an address for a client until it requests it, removing other leases of the client
+func (t *dhcpLeaseTable) offer(lease DHCPLease) {
+	t.Lock()
+	defer t.Unlock()
+
+	lease.offered = true
+	t.add(lease)
+}
+
+// set adds or refreshes a bound lease, removing other leases of the client, and persists the table
+func (t *dhcpLeaseTable) set(lease DHCPLease) error {
+	t.Lock()
+	defer t.Unlock()
+
+	lease.offered = false
+	t.add(lease)
+
+	return t.save()
+}
+
+// add adds a lease and removes other leases of its client, the caller must hold the lock
+func (t *dhcpLeaseTable) add(lease DHCPLease) {
+	for ip, l := range t.leases {
+		if lease.MAC != "" && l.MAC == lease.MAC {
+			delete(t.leases, ip)
+		}
+	}
+
+	t.leases[lease.IP] = lease
+}
+
+func (t *dhcpLeaseTable) delete(ip netip.Addr) error {
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.leases, ip)
+	return t.save()
+}
+
+// list returns all unexpired leases sorted by IP
+func (t *dhcpLeaseTable) list() []DHCPLease {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.unexpired()
+}
+
+func (t *dhcpLeaseTable) unexpired() []DHCPLease {
+	now := time.Now()
+	leases := make([]DHCPLease, 0, len(t.leases))
+
+	for ip, lease := range t.leases {
+		if lease.expired(now) {
+			delete(t.leases, ip)
+			continue
+		}
+
+		leases = append(leases, lease)
+	}
+
+	sort.Slice(leases, func(i, j int) bool {
+		return leases[i].IP.Less(leases[j].IP)
+	})
+
+	return leases
+}
+
+// save writes the unexpired bound leases to a temporary file that replaces the lease file, the caller must hold the lock
+func (t *dhcpLeaseTable) save() error {
+	if t.file == "" {
+		return nil
+	}
+
+	// offers are not restored after a restart, the client requests its address again
+	leases := []DHCPLease{}
+	for _, lease := range t.unexpired() {
+		if !lease.offered {
+			leases = append(leases, lease)
+		}
+	}
+
+	b, err := json.MarshalIndent(leases, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := t.file + ".tmp"
+
+	err = os.WriteFile(tmp, b, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, t.file)
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDHCPLeaseTablePersistence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "leases.json")
+
+	table, err := newDHCPLeaseTable(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	bound := DHCPLease{MAC: "02:00:00:00:00:01", IP: netip.MustParseAddr("10.0.0.100"), Expires: now.Add(time.Hour)}
+	declined := DHCPLease{IP: netip.MustParseAddr("10.0.0.101"), Expires: now.Add(time.Hour)}
+
+	for _, lease := range []DHCPLease{bound, declined, {MAC: "02:00:00:00:00:03", IP: netip.MustParseAddr("10.0.0.103"), Expires: now.Add(-time.Second)}} {
+		err = table.set(lease)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	table.offer(DHCPLease{MAC: "02:00:00:00:00:02", IP: netip.MustParseAddr("10.0.0.102"), Expires: now.Add(time.Minute)})
+
+	// offers are not saved on their own, refreshing the bound lease saves the table with the offer
+	err = table.set(bound)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// expired leases and offers are not persisted
+	loaded, err := newDHCPLeaseTable(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leases := loaded.list()
+	if len(leases) != 2 || leases[0].IP != bound.IP || leases[0].MAC != bound.MAC || leases[1].IP != declined.IP {
+		t.Fatalf("loaded leases %+v, expected the bound and declined lease", leases)
+	}
+
+	err = loaded.delete(bound.IP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err = newDHCPLeaseTable(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded.list()) != 1 {
+		t.Fatal("deleted lease was persisted")
+	}
+}
+
+func TestNewDHCPLeaseTable(t *testing.T) {
+	directory := t.TempDir()
+
+	corrupt := filepath.Join(directory, "corrupt.json")
+	err := os.WriteFile(corrupt, []byte("["), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		file  string
+		valid bool
+	}{
+		{name: "in memory", file: "", valid: true},
+		{name: "missing file", file: filepath.Join(directory, "missing.json"), valid: true},
+		{name: "corrupt file", file: corrupt},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := newDHCPLeaseTable(test.file)
+			if test.valid && err != nil {
+				t.Fatalf("failed to load leases with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("loaded invalid leases")
+			}
+		})
+	}
+}
+
+func TestDHCPLeaseTableClientHasOneLease(t *testing.T) {
+	table, err := newDHCPLeaseTable("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expires := time.Now().Add(time.Hour)
+	table.offer(DHCPLease{MAC: "02:00:00:00:00:01", IP: netip.MustParseAddr("10.0.0.100"), Expires: expires})
+
+	err = table.set(DHCPLease{MAC: "02:00:00:00:00:01", IP: netip.MustParseAddr("10.0.0.101"), Expires: expires})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, ok := table.lookup(netip.MustParseAddr("10.0.0.100"))
+	if ok {
+		t.Fatal("offer was kept after the client leased another address")
+	}
+
+	lease, ok := table.lookupMAC("02:00:00:00:00:01")
+	if !ok || lease.IP != netip.MustParseAddr("10.0.0.101") || lease.offered {
+		t.Fatalf("lease of client is %+v", lease)
+	}
+}
@@ -0,0 +1,494 @@
+package internal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/songgao/packets/ethernet"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+type DHCPServer interface {
+	Port
+	// Leases returns the unexpired leases sorted by IP
+	Leases() []DHCPLease
+}
+
+const (
+	defaultDHCPServerName = "dhcp"
+	defaultLeaseTime      = time.Hour
+	// offerTimeout is the duration an offered address is held for the client
+	offerTimeout = time.Minute
+
+	dhcpServerQueueSize = 64
+	dhcpTTL             = 64
+	// bootpReplySize is the minimum size of BOOTP messages relay agents and old clients accept
+	bootpReplySize = 300
+)
+
+// MaxDNSServers is the maximum amount of announced DNS servers, the DHCP option holds at most 63 addresses
+const MaxDNSServers = 63
+
+// DHCPServerConfig is a DHCPv4 server and IPv6 router advertisement daemon attached to a switch as a virtual port
+type DHCPServerConfig struct {
+	// Name is the name of the port, dhcp if empty
+	Name string
+	// MAC is the hardware address of the server, a random locally administered address if empty
+	MAC net.HardwareAddr
+	// Address is the address of the server and the subnet of the clients, DHCPv4 is disabled if invalid
+	Address netip.Prefix
+	// Pools are the ranges of addresses leased to clients without reservation
+	Pools []DHCPPool
+	// Reservations are addresses always leased to the same client, they do not need to be part of a pool
+	Reservations []DHCPReservation
+	// Router is the default gateway announced to clients, none is announced if invalid
+	Router netip.Addr
+	// DNS are the DNS servers announced to clients, at most MaxDNSServers
+	DNS    []netip.Addr
+	Domain string
+	// LeaseTime is the duration of leases, 1 hour if 0
+	LeaseTime time.Duration
+	// LeaseFile persists the leases across restarts, leases are only kept in memory if empty
+	LeaseFile string
+	// RouterAdvertisement announces IPv6 prefixes for stateless address autoconfiguration
+	RouterAdvertisement RouterAdvertisementConfig
+}
+
+// DHCPPool is an inclusive range of addresses
+type DHCPPool struct {
+	Start netip.Addr
+	End   netip.Addr
+}
+
+func (p DHCPPool) contains(ip netip.Addr) bool {
+	return p.Start.Compare(ip) <= 0 && ip.Compare(p.End) <= 0
+}
+
+// DHCPReservation is a static lease of a client
+type DHCPReservation struct {
+	MAC net.HardwareAddr
+	IP  netip.Addr
+}
+
+type dhcpServer struct {
+	name      string
+	mac       net.HardwareAddr
+	cfg       DHCPServerConfig
+	linkLocal netip.Addr
+
+	leases *dhcpLeaseTable
+	// mac -> reserved ip
+	reservations map[string]netip.Addr
+	// reserved ip -> mac
+	reservedIPs map[netip.Addr]string
+
+	frames chan ethernet.Frame
+	done   chan struct{}
+	once   sync.Once
+}
+
+func NewDHCPServer(cfg DHCPServerConfig) (DHCPServer, error) {
+	if cfg.Name == "" {
+		cfg.Name = defaultDHCPServerName
+	}
+
+	if cfg.LeaseTime == 0 {
+		cfg.LeaseTime = defaultLeaseTime
+	}
+
+	if cfg.RouterAdvertisement.Interval == 0 {
+		cfg.RouterAdvertisement.Interval = defaultRouterAdvertisementInterval
+	}
+
+	if len(cfg.DNS) > MaxDNSServers || len(cfg.RouterAdvertisement.DNS) > MaxDNSServers {
+		return nil, fmt.Errorf("more than %d dns servers", MaxDNSServers)
+	}
+
+	mac := cfg.MAC
+	if mac == nil {
+		var err error
+		mac, err = randomMAC()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	leases, err := newDHCPLeaseTable(cfg.LeaseFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load leases with error: %v", err)
+	}
+
+	s := &dhcpServer{
+		name:         cfg.Name,
+		mac:          mac,
+		cfg:          cfg,
+		linkLocal:    linkLocalAddr(mac),
+		leases:       leases,
+		reservations: map[string]netip.Addr{},
+		reservedIPs:  map[netip.Addr]string{},
+		frames:       make(chan ethernet.Frame, dhcpServerQueueSize),
+		done:         make(chan struct{}),
+	}
+
+	for _, r := range cfg.Reservations {
+		s.reservations[r.MAC.String()] = r.IP
+		s.reservedIPs[r.IP] = r.MAC.String()
+	}
+
+	// announcing the address lets the switch learn the hardware address of the server
+	if s.dhcpEnabled() {
+		s.send(arpReplyFrame(s.mac, cfg.Address.Addr(), broadcastMac, cfg.Address.Addr()))
+	}
+
+	if len(cfg.RouterAdvertisement.Prefixes) > 0 {
+		go s.advertise()
+	}
+
+	slog.Info("started dhcp server", "port", s.name, "mac", s.mac.String(), "address", cfg.Address.String(), "leases", len(leases.list()))
+	return s, nil
+}
+
+func (s *dhcpServer) dhcpEnabled() bool {
+	return s.cfg.Address.IsValid()
+}
+
+func (s *dhcpServer) Name() string {
+	return s.name
+}
+
+// Write handles a frame sent to the server by the switch
+func (s *dhcpServer) Write(frame ethernet.Frame) error {
+	if len(frame) < ethernetHeaderSize {
+		return nil
+	}
+
+	info := parseFrame(frame)
+	if info.stacked {
+		return nil
+	}
+
+	p, ok := parseNeighborPacket(frame, info)
+	if ok {
+		s.answerNeighbor(p)
+		return nil
+	}
+
+	if info.etherType == etherTypeIPv6 && info.protocol == ipProtocolICMPv6 && !info.extended {
+		s.answerRouterSolicitation(frame)
+		return nil
+	}
+
+	if !s.dhcpEnabled() || !info.l4 || info.destinationPort != dhcpServerPort {
+		return nil
+	}
+
+	payload, ok := udpPayload(frame, info)
+	if !ok {
+		return nil
+	}
+
+	m, ok := parseDHCP(payload)
+	if !ok || m.op != bootpRequest {
+		return nil
+	}
+
+	// relayed requests are for other subnets
+	if !m.relayIP.IsUnspecified() {
+		return nil
+	}
+
+	s.handleDHCP(m)
+	return nil
+}
+
+// Read returns the next frame sent by the server
+func (s *dhcpServer) Read() (ethernet.Frame, error) {
+	select {
+	case frame := <-s.frames:
+		return frame, nil
+	case <-s.done:
+		return nil, errors.New("dhcp server closed")
+	}
+}
+
+func (s *dhcpServer) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+
+	return nil
+}
+
+func (s *dhcpServer) Leases() []DHCPLease {
+	return s.leases.list()
+}
+
+// send queues a frame to be read by the switch, frames are dropped if the switch does not keep up
+func (s *dhcpServer) send(frame ethernet.Frame) {
+	select {
+	case s.frames <- frame:
+	default:
+	}
+}
+
+func (s *dhcpServer) answerNeighbor(p neighborPacket) {
+	if !p.request || p.senderMAC == nil || p.gratuitous {
+		return
+	}
+
+	switch {
+	case p.source == BindingSourceARP && s.dhcpEnabled() && p.targetIP == s.cfg.Address.Addr():
+		s.send(arpReplyFrame(s.mac, p.targetIP, p.senderMAC, p.senderIP))
+	case p.source == BindingSourceND && p.targetIP == s.linkLocal && !p.senderIP.IsUnspecified():
+		s.send(neighborAdvertisementFrame(s.mac, p.targetIP, p.senderMAC, p.senderIP))
+	}
+}
+
+func (s *dhcpServer) handleDHCP(m dhcpMessage) {
+	mac := m.clientMAC.String()
+
+	switch m.messageType {
+	case dhcpDiscover:
+		ip, ok := s.address(mac, m.requestedIP)
+		if !ok {
+			slog.Warn("no dhcp address available", "port", s.name, "mac", mac)
+			return
+		}
+
+		// the offered address is held for the client without persisting it
+		_, leased := s.leases.lookup(ip)
+		if !leased {
+			s.leases.offer(DHCPLease{MAC: mac, IP: ip, Expires: time.Now().Add(offerTimeout)})
+		}
+
+		s.reply(m, dhcpOffer, ip)
+	case dhcpRequest:
+		// the client accepted the offer of another server
+		if m.serverID.IsValid() && m.serverID != s.cfg.Address.Addr() {
+			return
+		}
+
+		ip := m.requestedIP
+		if !ip.IsValid() {
+			ip = m.clientIP
+		}
+
+		if !s.acceptable(mac, ip) {
+			slog.Info("declined dhcp request", "port", s.name, "mac", mac, "ip", ip.String())
+			s.reply(m, dhcpNak, netip.Addr{})
+			return
+		}
+
+		err := s.leases.set(DHCPLease{MAC: mac, IP: ip, Expires: time.Now().Add(s.cfg.LeaseTime)})
+		if err != nil {
+			slog.Error("failed to save dhcp leases", "port", s.name, "error", err)
+		}
+
+		slog.Info("leased dhcp address", "port", s.name, "mac", mac, "ip", ip.String(), "leaseTime", s.cfg.LeaseTime)
+		s.reply(m, dhcpAck, ip)
+	case dhcpRelease:
+		lease, ok := s.leases.lookup(m.clientIP)
+		if !ok || lease.MAC != mac {
+			return
+		}
+
+		err := s.leases.delete(m.clientIP)
+		if err != nil {
+			slog.Error("failed to save dhcp leases", "port", s.name, "error", err)
+		}
+
+		slog.Info("released dhcp address", "port", s.name, "mac", mac, "ip", m.clientIP.String())
+	case dhcpDecline:
+		lease, ok := s.leases.lookup(m.requestedIP)
+		if !ok || lease.MAC != mac {
+			return
+		}
+
+		// the address is used by another host, it is not leased until the lease time passed
+		err := s.leases.set(DHCPLease{IP: m.requestedIP, Expires: time.Now().Add(s.cfg.LeaseTime)})
+		if err != nil {
+			slog.Error("failed to save dhcp leases", "port", s.name, "error", err)
+		}
+
+		slog.Warn("dhcp address declined by client", "port", s.name, "mac", mac, "ip", m.requestedIP.String())
+	case dhcpInform:
+		s.reply(m, dhcpAck, netip.Addr{})
+	}
+}
+
+// address returns the address offered to a client: its reservation, its current lease, the requested address
+// or the first free address of the pools
+func (s *dhcpServer) address(mac string, requested netip.Addr) (netip.Addr, bool) {
+	reserved, ok := s.reservations[mac]
+	if ok {
+		return reserved, true
+	}
+
+	lease, ok := s.leases.lookupMAC(mac)
+	if ok {
+		return lease.IP, true
+	}
+
+	if requested.IsValid() && s.available(mac, requested) {
+		return requested, true
+	}
+
+	for _, pool := range s.cfg.Pools {
+		for ip := pool.Start; ip.IsValid() && pool.contains(ip); ip = ip.Next() {
+			if s.available(mac, ip) {
+				return ip, true
+			}
+		}
+	}
+
+	return netip.Addr{}, false
+}
+
+// acceptable returns whether a client may use an address it requested
+func (s *dhcpServer) acceptable(mac string, ip netip.Addr) bool {
+	reserved, ok := s.reservations[mac]
+	if ok {
+		return ip == reserved
+	}
+
+	return s.available(mac, ip)
+}
+
+// available returns whether an address of the pools is neither reserved nor leased to another client
+func (s *dhcpServer) available(mac string, ip netip.Addr) bool {
+	if !ip.Is4() || ip == s.cfg.Address.Addr() || ip == s.cfg.Router {
+		return false
+	}
+
+	// the network and broadcast address of the subnet are never leased
+	subnet := s.cfg.Address.Masked()
+	if !subnet.Contains(ip) || ip == subnet.Addr() || ip == broadcastAddr(subnet) {
+		return false
+	}
+
+	inPool := false
+	for _, pool := range s.cfg.Pools {
+		if pool.contains(ip) {
+			inPool = true
+			break
+		}
+	}
+
+	if !inPool {
+		return false
+	}
+
+	if _, reserved := s.reservedIPs[ip]; reserved {
+		return false
+	}
+
+	lease, leased := s.leases.lookup(ip)
+	return !leased || lease.MAC == mac
+}
+
+// reply sends a DHCP reply to a client, yourIP is the leased address and invalid for NAKs and INFORMs
+func (s *dhcpServer) reply(m dhcpMessage, messageType byte, yourIP netip.Addr) {
+	serverIP := s.cfg.Address.Addr()
+
+	bootp := make([]byte, bootpMinSize, bootpReplySize)
+	bootp[0] = bootpReply
+	bootp[1] = arpHardwareEth
+	bootp[2] = 6
+	binary.BigEndian.PutUint32(bootp[4:8], m.xid)
+	binary.BigEndian.PutUint16(bootp[10:12], m.flags)
+	if messageType == dhcpAck {
+		copy(bootp[12:16], m.clientIP.AsSlice())
+	}
+	if yourIP.IsValid() {
+		copy(bootp[16:20], yourIP.AsSlice())
+	}
+	copy(bootp[28:34], m.clientMAC)
+	binary.BigEndian.PutUint32(bootp[236:240], dhcpMagicCookie)
+
+	bootp = append(bootp, dhcpOptionMessageType, 1, messageType)
+	bootp = append(bootp, dhcpOptionServerID, 4)
+	bootp = append(bootp, serverIP.AsSlice()...)
+
+	if messageType != dhcpNak {
+		if yourIP.IsValid() {
+			leaseTime := uint32(s.cfg.LeaseTime / time.Second)
+			bootp = appendDHCPUint32(bootp, dhcpOptionLeaseTime, leaseTime)
+			bootp = appendDHCPUint32(bootp, dhcpOptionRenewalTime, leaseTime/2)
+			bootp = appendDHCPUint32(bootp, dhcpOptionRebindTime, leaseTime/8*7)
+		}
+
+		mask := net.CIDRMask(s.cfg.Address.Bits(), 32)
+		bootp = append(bootp, dhcpOptionSubnetMask, 4)
+		bootp = append(bootp, mask...)
+
+		if s.cfg.Router.IsValid() {
+			bootp = append(bootp, dhcpOptionRouter, 4)
+			bootp = append(bootp, s.cfg.Router.AsSlice()...)
+		}
+
+		if len(s.cfg.DNS) > 0 {
+			bootp = append(bootp, dhcpOptionDNS, byte(4*len(s.cfg.DNS)))
+			for _, dns := range s.cfg.DNS {
+				bootp = append(bootp, dns.AsSlice()...)
+			}
+		}
+
+		if s.cfg.Domain != "" {
+			bootp = append(bootp, dhcpOptionDomainName, byte(len(s.cfg.Domain)))
+			bootp = append(bootp, s.cfg.Domain...)
+		}
+	}
+
+	bootp = append(bootp, dhcpOptionEnd)
+	for len(bootp) < bootpReplySize {
+		bootp = append(bootp, dhcpOptionPad)
+	}
+
+	// configured clients receive replies at their address, unconfigured clients by broadcast if they ask for it,
+	// NAKs are always broadcast
+	destinationMAC := m.clientMAC
+	destinationIP := yourIP
+	switch {
+	case messageType == dhcpNak || m.clientIP.IsUnspecified() && m.flags&dhcpFlagBroadcast != 0:
+		destinationMAC = broadcastMac
+		destinationIP = netip.AddrFrom4([4]byte{255, 255, 255, 255})
+	case !m.clientIP.IsUnspecified():
+		destinationIP = m.clientIP
+	}
+
+	s.send(ipv4Frame(s.mac, serverIP, destinationMAC, destinationIP, ipProtocolUDP, dhcpTTL,
+		udpDatagram(dhcpServerPort, dhcpClientPort, bootp)))
+}
+
+func appendDHCPUint32(b []byte, option byte, value uint32) []byte {
+	b = append(b, option, 4)
+	return binary.BigEndian.AppendUint32(b, value)
+}
+
+// broadcastAddr returns the last address of an IPv4 subnet
+func broadcastAddr(subnet netip.Prefix) netip.Addr {
+	ip := subnet.Masked().Addr().As4()
+	host := ^binary.BigEndian.Uint32(net.CIDRMask(subnet.Bits(), 32))
+	binary.BigEndian.PutUint32(ip[:], binary.BigEndian.Uint32(ip[:])|host)
+
+	return netip.AddrFrom4(ip)
+}
+
+// linkLocalAddr returns the IPv6 link-local address of a hardware address derived by modified EUI-64
+func linkLocalAddr(mac net.HardwareAddr) netip.Addr {
+	ip := [16]byte{0: 0xfe, 1: 0x80}
+	ip[8] = mac[0] ^ 0x02
+	ip[9] = mac[1]
+	ip[10] = mac[2]
+	ip[11] = 0xff
+	ip[12] = 0xfe
+	ip[13] = mac[3]
+	ip[14] = mac[4]
+	ip[15] = mac[5]
+
+	return netip.AddrFrom16(ip)
+}
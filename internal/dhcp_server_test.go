@@ -0,0 +1,401 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/songgao/packets/ethernet"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+var testServerMAC = testMAC("02:00:00:00:00:fe")
+
+// testDHCPServerConfig returns a server of 10.0.0.0/24 with a pool of two addresses
+func testDHCPServerConfig() DHCPServerConfig {
+	return DHCPServerConfig{
+		MAC:     testServerMAC,
+		Address: netip.MustParsePrefix("10.0.0.1/24"),
+		Pools:   []DHCPPool{{Start: netip.MustParseAddr("10.0.0.100"), End: netip.MustParseAddr("10.0.0.101")}},
+		Router:  netip.MustParseAddr("10.0.0.1"),
+		DNS:     []netip.Addr{netip.MustParseAddr("10.0.0.53")},
+	}
+}
+
+func newTestDHCPServer(t *testing.T, cfg DHCPServerConfig) *dhcpServer {
+	t.Helper()
+
+	s, err := NewDHCPServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+
+	// the server announces its address once started
+	if cfg.Address.IsValid() {
+		expectServerFrame(t, s.(*dhcpServer), true)
+	}
+
+	return s.(*dhcpServer)
+}
+
+// expectServerFrame returns the next frame sent by the server
+func expectServerFrame(t *testing.T, s *dhcpServer, expected bool) ethernet.Frame {
+	t.Helper()
+
+	return expectQueuedFrame(t, "switch", s.frames, expected)
+}
+
+// testDHCPRequest returns a DHCP message of a client, empty addresses are not set
+func testDHCPRequest(mac string, messageType byte, clientIP string, requestedIP string, serverID string) ethernet.Frame {
+	bootp := make([]byte, bootpMinSize)
+	bootp[0] = bootpRequest
+	bootp[1] = arpHardwareEth
+	bootp[2] = 6
+	binary.BigEndian.PutUint32(bootp[4:8], 0x1234)
+	copy(bootp[28:34], testMAC(mac))
+	binary.BigEndian.PutUint32(bootp[236:240], dhcpMagicCookie)
+
+	source := netip.IPv4Unspecified()
+	if clientIP != "" {
+		source = netip.MustParseAddr(clientIP)
+		copy(bootp[12:16], source.AsSlice())
+	}
+
+	bootp = append(bootp, dhcpOptionMessageType, 1, messageType)
+
+	if requestedIP != "" {
+		bootp = append(bootp, dhcpOptionRequestedIP, 4)
+		bootp = append(bootp, netip.MustParseAddr(requestedIP).AsSlice()...)
+	}
+
+	if serverID != "" {
+		bootp = append(bootp, dhcpOptionServerID, 4)
+		bootp = append(bootp, netip.MustParseAddr(serverID).AsSlice()...)
+	}
+
+	bootp = append(bootp, dhcpOptionEnd)
+
+	return ipv4Frame(testMAC(mac), source, broadcastMac, netip.AddrFrom4([4]byte{255, 255, 255, 255}), ipProtocolUDP, 64,
+		udpDatagram(dhcpClientPort, dhcpServerPort, bootp))
+}
+
+// dhcpReply writes a frame to the server and returns its DHCP reply
+func dhcpReply(t *testing.T, s *dhcpServer, frame ethernet.Frame) (ethernet.Frame, dhcpMessage) {
+	t.Helper()
+
+	err := s.Write(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply := expectServerFrame(t, s, true)
+
+	payload, ok := udpPayload(reply, parseFrame(reply))
+	if !ok {
+		t.Fatal("reply is not an udp datagram")
+	}
+
+	m, ok := parseDHCP(payload)
+	if !ok || m.op != bootpReply {
+		t.Fatal("reply is not a dhcp reply")
+	}
+
+	return reply, m
+}
+
+func TestDHCPServerLease(t *testing.T) {
+	s := newTestDHCPServer(t, testDHCPServerConfig())
+	client := "02:00:00:00:00:01"
+
+	offer, m := dhcpReply(t, s, testDHCPRequest(client, dhcpDiscover, "", "", ""))
+	if m.messageType != dhcpOffer || m.yourIP != netip.MustParseAddr("10.0.0.100") || m.serverID != netip.MustParseAddr("10.0.0.1") {
+		t.Fatalf("offer is %+v", m)
+	}
+
+	if m.leaseTime != uint32(defaultLeaseTime/time.Second) || m.xid != 0x1234 || !bytes.Equal(m.clientMAC, testMAC(client)) {
+		t.Fatalf("offer is %+v", m)
+	}
+
+	packet := offer[ethernetHeaderSize:]
+	if checksumFold(checksumAdd(0, packet[:ipv4MinHeaderSize])) != 0 {
+		t.Fatal("ip header checksum is invalid")
+	}
+
+	if pseudoHeaderChecksum(netip.MustParseAddr("10.0.0.1"), m.yourIP, ipProtocolUDP, packet[ipv4MinHeaderSize:]) != 0 {
+		t.Fatal("udp checksum is invalid")
+	}
+
+	// the offered address is held for the client until it requests it
+	if len(s.Leases()) != 1 || !s.Leases()[0].offered {
+		t.Fatalf("leases are %+v, expected an offer", s.Leases())
+	}
+
+	_, m = dhcpReply(t, s, testDHCPRequest(client, dhcpRequest, "", "10.0.0.100", "10.0.0.1"))
+	if m.messageType != dhcpAck || m.yourIP != netip.MustParseAddr("10.0.0.100") {
+		t.Fatalf("ack is %+v", m)
+	}
+
+	leases := s.Leases()
+	if len(leases) != 1 || leases[0].offered || leases[0].MAC != client || leases[0].IP != m.yourIP {
+		t.Fatalf("leases are %+v, expected a lease of the client", leases)
+	}
+
+	// the client gets its address again
+	_, m = dhcpReply(t, s, testDHCPRequest(client, dhcpDiscover, "", "", ""))
+	if m.yourIP != netip.MustParseAddr("10.0.0.100") {
+		t.Fatalf("client was offered %s, expected its lease", m.yourIP)
+	}
+
+	// renewals are sent by configured clients without requested address
+	_, m = dhcpReply(t, s, testDHCPRequest(client, dhcpRequest, "10.0.0.100", "", ""))
+	if m.messageType != dhcpAck || m.yourIP != netip.MustParseAddr("10.0.0.100") {
+		t.Fatalf("renewal ack is %+v", m)
+	}
+
+	err := s.Write(testDHCPRequest(client, dhcpRelease, "10.0.0.100", "", "10.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.Leases()) != 0 {
+		t.Fatal("released lease was kept")
+	}
+}
+
+func TestDHCPServerAddress(t *testing.T) {
+	tests := []struct {
+		name string
+		// leased are clients that leased the first addresses of the pool
+		leased    int
+		mac       string
+		requested string
+		expected  string
+	}{
+		{name: "first free address", expected: "10.0.0.100"},
+		{name: "requested address", requested: "10.0.0.101", expected: "10.0.0.101"},
+		{name: "requested address outside of pool", requested: "10.0.0.50", expected: "10.0.0.100"},
+		{name: "requested address of server", requested: "10.0.0.1", expected: "10.0.0.100"},
+		{name: "requested address leased by other client", leased: 1, requested: "10.0.0.100", expected: "10.0.0.101"},
+		{name: "reservation", mac: "02:00:00:00:00:10", requested: "10.0.0.101", expected: "10.0.0.10"},
+		{name: "pool exhausted", leased: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := testDHCPServerConfig()
+			cfg.Reservations = []DHCPReservation{{MAC: testMAC("02:00:00:00:00:10"), IP: netip.MustParseAddr("10.0.0.10")}}
+			s := newTestDHCPServer(t, cfg)
+
+			for i := range test.leased {
+				mac := net.HardwareAddr{2, 0, 0, 0, 1, byte(i)}.String()
+				ip := netip.AddrFrom4([4]byte{10, 0, 0, byte(100 + i)})
+
+				err := s.leases.set(DHCPLease{MAC: mac, IP: ip, Expires: time.Now().Add(time.Hour)})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			mac := test.mac
+			if mac == "" {
+				mac = "02:00:00:00:00:01"
+			}
+
+			request := testDHCPRequest(mac, dhcpDiscover, "", test.requested, "")
+			if test.expected == "" {
+				err := s.Write(request)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				expectServerFrame(t, s, false)
+				return
+			}
+
+			_, m := dhcpReply(t, s, request)
+			if m.messageType != dhcpOffer || m.yourIP != netip.MustParseAddr(test.expected) {
+				t.Fatalf("offered %s, expected %s", m.yourIP, test.expected)
+			}
+		})
+	}
+}
+
+func TestDHCPServerRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		mac       string
+		requested string
+		serverID  string
+		// messageType is the type of the reply, no reply is expected if 0
+		messageType byte
+	}{
+		{name: "free address", requested: "10.0.0.101", serverID: "10.0.0.1", messageType: dhcpAck},
+		{name: "without server id", requested: "10.0.0.101", messageType: dhcpAck},
+		{name: "address of other client", requested: "10.0.0.100", messageType: dhcpNak},
+		{name: "address outside of pool", requested: "10.0.0.50", messageType: dhcpNak},
+		{name: "address other than reservation", mac: "02:00:00:00:00:10", requested: "10.0.0.101", messageType: dhcpNak},
+		{name: "reservation", mac: "02:00:00:00:00:10", requested: "10.0.0.10", messageType: dhcpAck},
+		{name: "offer of other server", requested: "10.0.0.101", serverID: "10.0.0.2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := testDHCPServerConfig()
+			cfg.Reservations = []DHCPReservation{{MAC: testMAC("02:00:00:00:00:10"), IP: netip.MustParseAddr("10.0.0.10")}}
+			s := newTestDHCPServer(t, cfg)
+
+			err := s.leases.set(DHCPLease{MAC: "02:00:00:00:00:02", IP: netip.MustParseAddr("10.0.0.100"), Expires: time.Now().Add(time.Hour)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mac := test.mac
+			if mac == "" {
+				mac = "02:00:00:00:00:01"
+			}
+
+			request := testDHCPRequest(mac, dhcpRequest, "", test.requested, test.serverID)
+			if test.messageType == 0 {
+				err = s.Write(request)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				expectServerFrame(t, s, false)
+				return
+			}
+
+			reply, m := dhcpReply(t, s, request)
+			if m.messageType != test.messageType {
+				t.Fatalf("reply has message type %d, expected %d", m.messageType, test.messageType)
+			}
+
+			// NAKs are broadcast
+			if m.messageType == dhcpNak && !bytes.Equal(reply.Destination(), broadcastMac) {
+				t.Fatalf("nak was sent to %s", reply.Destination())
+			}
+		})
+	}
+}
+
+func TestDHCPServerDecline(t *testing.T) {
+	s := newTestDHCPServer(t, testDHCPServerConfig())
+	client := "02:00:00:00:00:01"
+
+	dhcpReply(t, s, testDHCPRequest(client, dhcpDiscover, "", "", ""))
+	dhcpReply(t, s, testDHCPRequest(client, dhcpRequest, "", "10.0.0.100", "10.0.0.1"))
+
+	// the declined address is used by another host and not offered again
+	err := s.Write(testDHCPRequest(client, dhcpDecline, "", "10.0.0.100", "10.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, m := dhcpReply(t, s, testDHCPRequest(client, dhcpDiscover, "", "", ""))
+	if m.yourIP != netip.MustParseAddr("10.0.0.101") {
+		t.Fatalf("offered %s after decline, expected 10.0.0.101", m.yourIP)
+	}
+}
+
+func TestDHCPServerIgnoresFrames(t *testing.T) {
+	relayed := testDHCPRequest("02:00:00:00:00:01", dhcpDiscover, "", "", "")
+	copy(relayed[ethernetHeaderSize+ipv4MinHeaderSize+udpHeaderSize+24:], netip.MustParseAddr("10.0.1.1").AsSlice())
+
+	tests := []struct {
+		name  string
+		frame ethernet.Frame
+	}{
+		{name: "relayed request", frame: relayed},
+		{name: "reply of other server", frame: testDHCPServerFrame("02:00:00:00:00:0a", dhcpOffer, "10.0.0.10")},
+		{name: "stacked request", frame: testStacked(testDHCPRequest("02:00:00:00:00:01", dhcpDiscover, "", "", ""), 0x88a8)},
+		{name: "arp request for other address", frame: arpRequestFrame(testMAC("02:00:00:00:00:01"), netip.MustParseAddr("10.0.0.100"), netip.MustParseAddr("10.0.0.2"))},
+		{name: "short frame", frame: ethernet.Frame{1, 2, 3}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestDHCPServer(t, testDHCPServerConfig())
+
+			err := s.Write(test.frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectServerFrame(t, s, false)
+		})
+	}
+}
+
+func TestDHCPServerAnswersARP(t *testing.T) {
+	s := newTestDHCPServer(t, testDHCPServerConfig())
+	client := testMAC("02:00:00:00:00:01")
+
+	err := s.Write(arpRequestFrame(client, netip.MustParseAddr("10.0.0.100"), netip.MustParseAddr("10.0.0.1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply := expectServerFrame(t, s, true)
+
+	p, ok := parseNeighborPacket(reply, parseFrame(reply))
+	if !ok || p.request || p.senderIP != netip.MustParseAddr("10.0.0.1") || !bytes.Equal(p.senderMAC, testServerMAC) {
+		t.Fatalf("arp reply is %+v", p)
+	}
+
+	if !bytes.Equal(reply.Destination(), client) {
+		t.Fatalf("arp reply was sent to %s", reply.Destination())
+	}
+}
+
+func TestNewDHCPServerRejectsTooManyDNSServers(t *testing.T) {
+	cfg := testDHCPServerConfig()
+	for i := range MaxDNSServers {
+		cfg.DNS = append(cfg.DNS, netip.AddrFrom4([4]byte{10, 0, 1, byte(i)}))
+	}
+
+	_, err := NewDHCPServer(cfg)
+	if err == nil {
+		t.Fatal("created server with more than the maximum dns servers")
+	}
+}
+
+func TestBroadcastAddr(t *testing.T) {
+	tests := []struct {
+		subnet   string
+		expected string
+	}{
+		{subnet: "10.0.0.1/24", expected: "10.0.0.255"},
+		{subnet: "10.0.0.1/8", expected: "10.255.255.255"},
+		{subnet: "192.168.1.130/25", expected: "192.168.1.255"},
+		{subnet: "192.168.1.1/32", expected: "192.168.1.1"},
+	}
+
+	for _, test := range tests {
+		broadcast := broadcastAddr(netip.MustParsePrefix(test.subnet))
+		if broadcast != netip.MustParseAddr(test.expected) {
+			t.Fatalf("broadcast address of %s is %s, expected %s", test.subnet, broadcast, test.expected)
+		}
+	}
+}
+
+func TestLinkLocalAddr(t *testing.T) {
+	tests := []struct {
+		mac      string
+		expected string
+	}{
+		{mac: "02:00:5e:10:00:01", expected: "fe80::5eff:fe10:1"},
+		{mac: "00:00:5e:10:00:01", expected: "fe80::200:5eff:fe10:1"},
+	}
+
+	for _, test := range tests {
+		ip := linkLocalAddr(testMAC(test.mac))
+		if ip != netip.MustParseAddr(test.expected) {
+			t.Fatalf("link local address of %s is %s, expected %s", test.mac, ip, test.expected)
+		}
+	}
+}
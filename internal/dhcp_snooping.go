@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// isDHCPServerMessage returns whether a frame is sent by a DHCP or DHCPv6 server to a client
+func isDHCPServerMessage(info frameInfo) bool {
+	if !info.l4 || info.protocol != ipProtocolUDP {
+		return false
+	}
+
+	return info.sourcePort == dhcpServerPort && info.destinationPort == dhcpClientPort ||
+		info.sourcePort == dhcpv6ServerPort && info.destinationPort == dhcpv6ClientPort
+}
+
+// snoopDHCP drops DHCP server messages received on untrusted ports and records the leases acknowledged by trusted servers,
+// returns false if the frame is dropped
+func (e *ethernetSwitch) snoopDHCP(f switchFrame, sourcePortId uint, sourceCfg PortConfig) bool {
+	if !e.dhcpSnooping {
+		return true
+	}
+
+	if isDHCPServerMessage(f.info) && !sourceCfg.DHCPTrusted {
+		drops := e.dhcpDrops.Add(1)
+
+		if e.dhcpLog.Allow() {
+			slog.Warn("dropped dhcp server message from untrusted port", "switch", e.name, "portId", sourcePortId, "port", e.portName(sourcePortId),
+				"mac", f.frame.Source().String(), "drops", drops)
+		}
+
+		return false
+	}
+
+	// the leases of double tagged frames belong to an inner VLAN that is not switched
+	if f.info.etherType != etherTypeIPv4 || f.info.stacked {
+		return true
+	}
+
+	payload, ok := udpPayload(f.frame, f.info)
+	if !ok {
+		return true
+	}
+
+	m, ok := parseDHCP(payload)
+	if !ok {
+		return true
+	}
+
+	switch {
+	case m.op == bootpReply && m.messageType == dhcpAck && sourceCfg.DHCPTrusted:
+		e.bindLease(f.vlan, m)
+	case m.op != bootpReply && (m.messageType == dhcpRelease || m.messageType == dhcpDecline):
+		e.releaseLease(f.vlan, m, sourcePortId)
+	}
+
+	return true
+}
+
+// bindLease records the lease of a DHCPACK, the port of the client is the port its hardware address was learned on
+func (e *ethernetSwitch) bindLease(vlan uint16, m dhcpMessage) {
+	// acknowledgements of DHCPINFORM carry no lease
+	if !m.yourIP.IsValid() || m.yourIP.IsUnspecified() {
+		return
+	}
+
+	portId, ok := e.hardwareAddr.lookup(newMacKey(vlan, m.clientMAC))
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	binding := Binding{
+		VLAN:     vlan,
+		IP:       m.yourIP,
+		MAC:      append(net.HardwareAddr{}, m.clientMAC...),
+		PortId:   portId,
+		Source:   BindingSourceDHCP,
+		LastSeen: now,
+	}
+
+	if m.leaseTime != dhcpInfiniteLease {
+		binding.Expires = now.Add(time.Duration(m.leaseTime) * time.Second)
+	}
+
+	e.bindings.set(binding)
+	slog.Debug("bound dhcp lease", "switch", e.name, "vlan", vlan, "ip", m.yourIP.String(), "mac", m.clientMAC.String(), "portId", portId, "expires", binding.Expires)
+}
+
+// releaseLease removes the binding of a lease released or declined by its client, only the bound client on its port can remove it
+func (e *ethernetSwitch) releaseLease(vlan uint16, m dhcpMessage, sourcePortId uint) {
+	ip := m.clientIP
+	if m.messageType == dhcpDecline {
+		ip = m.requestedIP
+	}
+
+	binding, ok := e.bindings.lookup(vlan, ip)
+	if !ok || binding.Source != BindingSourceDHCP || binding.PortId != sourcePortId || !bytes.Equal(binding.MAC, m.clientMAC) {
+		return
+	}
+
+	e.bindings.delete(vlan, ip)
+	slog.Debug("released dhcp lease", "switch", e.name, "vlan", vlan, "ip", ip.String(), "mac", m.clientMAC.String())
+}
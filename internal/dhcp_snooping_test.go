@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"encoding/binary"
+	"github.com/songgao/packets/ethernet"
+	"net/netip"
+	"testing"
+)
+
+const testClientMAC = "02:00:00:00:00:01"
+
+// testBOOTP returns a DHCP message about the test client
+func testBOOTP(op byte, messageType byte, yourIP string, leaseTime uint32) []byte {
+	bootp := make([]byte, 240)
+	bootp[0] = op
+	bootp[1] = arpHardwareEth
+	bootp[2] = 6
+	copy(bootp[16:20], netip.MustParseAddr(yourIP).AsSlice())
+	copy(bootp[28:34], testMAC(testClientMAC))
+	binary.BigEndian.PutUint32(bootp[236:240], dhcpMagicCookie)
+
+	bootp = append(bootp, dhcpOptionMessageType, 1, messageType)
+	bootp = appendDHCPUint32(bootp, dhcpOptionLeaseTime, leaseTime)
+	return append(bootp, dhcpOptionEnd)
+}
+
+// testDHCPServerFrame returns a DHCP message of a server to the client
+func testDHCPServerFrame(source string, messageType byte, yourIP string) ethernet.Frame {
+	datagram := udpDatagram(dhcpServerPort, dhcpClientPort, testBOOTP(bootpReply, messageType, yourIP, 3600))
+	return ipv4Frame(testMAC(source), netip.MustParseAddr("10.0.0.1"), testMAC(testClientMAC), netip.MustParseAddr(yourIP), ipProtocolUDP, 64, datagram)
+}
+
+// testDHCPv6ServerFrame returns a DHCPv6 message of a server to the client behind the given extension headers
+func testDHCPv6ServerFrame(source string, messageType byte, protocol uint8, extensionHeaders []byte) ethernet.Frame {
+	datagram := udpDatagram(dhcpv6ServerPort, dhcpv6ClientPort, []byte{messageType, 0, 0, 1})
+	return ipv6Frame(testMAC(source), netip.MustParseAddr("fe80::1"), testMAC(testClientMAC), netip.MustParseAddr("fe80::2"),
+		protocol, 64, concat(extensionHeaders, datagram))
+}
+
+func TestDHCPSnoopingServerMessages(t *testing.T) {
+	const dhcpv6Advertise = 2
+	const dhcpv6Reply = 7
+
+	tests := []struct {
+		name  string
+		frame func(source string) ethernet.Frame
+	}{
+		{
+			name: "offer",
+			frame: func(source string) ethernet.Frame {
+				return testDHCPServerFrame(source, dhcpOffer, "10.0.0.10")
+			},
+		},
+		{
+			name: "double tagged offer",
+			frame: func(source string) ethernet.Frame {
+				return testStacked(testStacked(testDHCPServerFrame(source, dhcpOffer, "10.0.0.10"), vlanTPID), 0x88a8)
+			},
+		},
+		{
+			name: "dhcpv6 advertise",
+			frame: func(source string) ethernet.Frame {
+				return testDHCPv6ServerFrame(source, dhcpv6Advertise, ipProtocolUDP, nil)
+			},
+		},
+		{
+			name: "dhcpv6 reply with extension header",
+			frame: func(source string) ethernet.Frame {
+				return testDHCPv6ServerFrame(source, dhcpv6Reply, ipProtocolHopByHop, testExtensionHeader(ipProtocolUDP))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sw := newTestSwitch(t, SwitchConfig{DHCPSnooping: true})
+			client, server, rogue := newTestPort("client"), newTestPort("server"), newTestPort("rogue")
+			sw.AddPort(client, PortConfig{})
+			sw.AddPort(server, PortConfig{DHCPTrusted: true})
+			sw.AddPort(rogue, PortConfig{})
+
+			client.in <- testFrame("02:00:00:00:00:02", testClientMAC)
+			expectFrame(t, server, true)
+			expectFrame(t, rogue, true)
+
+			server.in <- test.frame("02:00:00:00:00:02")
+			expectFrame(t, client, true)
+
+			rogue.in <- test.frame("02:00:00:00:00:03")
+			expectFrame(t, client, false)
+
+			if sw.Status().DHCPDrops != 1 {
+				t.Fatalf("dhcp drops are %d, expected 1", sw.Status().DHCPDrops)
+			}
+		})
+	}
+}
+
+func TestDHCPSnoopingBindsTrustedLeases(t *testing.T) {
+	sw := newTestSwitch(t, SwitchConfig{DHCPSnooping: true})
+	client, server, rogue := newTestPort("client"), newTestPort("server"), newTestPort("rogue")
+	clientPortId := sw.AddPort(client, PortConfig{})
+	sw.AddPort(server, PortConfig{DHCPTrusted: true})
+	sw.AddPort(rogue, PortConfig{})
+
+	client.in <- testFrame("02:00:00:00:00:02", testClientMAC)
+	expectFrame(t, server, true)
+
+	rogue.in <- testDHCPServerFrame("02:00:00:00:00:03", dhcpAck, "10.0.0.66")
+	expectFrame(t, client, false)
+
+	server.in <- testDHCPServerFrame("02:00:00:00:00:02", dhcpAck, "10.0.0.10")
+	expectFrame(t, client, true)
+
+	bindings := sw.Bindings()
+	if len(bindings) != 1 {
+		t.Fatalf("bindings are %+v, expected the lease of the trusted server", bindings)
+	}
+
+	if bindings[0].IP != netip.MustParseAddr("10.0.0.10") || bindings[0].PortId != clientPortId || bindings[0].Source != BindingSourceDHCP {
+		t.Fatalf("binding is %+v", bindings[0])
+	}
+}
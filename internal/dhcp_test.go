@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+)
+
+func TestParseDHCP(t *testing.T) {
+	offer := testBOOTP(bootpReply, dhcpOffer, "10.0.0.10", 3600)
+
+	tests := []struct {
+		name     string
+		payload  []byte
+		parsed   bool
+		expected dhcpMessage
+	}{
+		{
+			name:     "offer",
+			payload:  offer,
+			parsed:   true,
+			expected: dhcpMessage{op: bootpReply, messageType: dhcpOffer, yourIP: netip.MustParseAddr("10.0.0.10"), leaseTime: 3600},
+		},
+		{
+			name: "request",
+			payload: func() []byte {
+				bootp := testBOOTP(bootpRequest, dhcpRequest, "0.0.0.0", 0)
+				bootp = bootp[:len(bootp)-1]
+				bootp = append(bootp, dhcpOptionPad, dhcpOptionPad, dhcpOptionRequestedIP, 4, 10, 0, 0, 10)
+				bootp = append(bootp, dhcpOptionServerID, 4, 10, 0, 0, 1, dhcpOptionEnd)
+				return bootp
+			}(),
+			parsed: true,
+			expected: dhcpMessage{
+				op:          bootpRequest,
+				messageType: dhcpRequest,
+				yourIP:      netip.IPv4Unspecified(),
+				requestedIP: netip.MustParseAddr("10.0.0.10"),
+				serverID:    netip.MustParseAddr("10.0.0.1"),
+			},
+		},
+		{
+			name:    "too short",
+			payload: offer[:bootpMinSize-1],
+		},
+		{
+			name:    "without magic cookie",
+			payload: append(append([]byte{}, offer[:236]...), make([]byte, len(offer)-236)...),
+		},
+		{
+			name: "not ethernet",
+			payload: func() []byte {
+				bootp := append([]byte{}, offer...)
+				bootp[1] = 6
+				return bootp
+			}(),
+		},
+		{
+			name:    "without message type",
+			payload: append(append([]byte{}, offer[:bootpMinSize]...), dhcpOptionEnd),
+		},
+		{
+			name:    "truncated option",
+			payload: append(append([]byte{}, offer[:bootpMinSize]...), dhcpOptionMessageType, 2, dhcpOffer),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, ok := parseDHCP(test.payload)
+			if ok != test.parsed {
+				t.Fatalf("parsed is %t, expected %t", ok, test.parsed)
+			}
+
+			if !ok {
+				return
+			}
+
+			if m.op != test.expected.op || m.messageType != test.expected.messageType || m.yourIP != test.expected.yourIP ||
+				m.requestedIP != test.expected.requestedIP || m.serverID != test.expected.serverID || m.leaseTime != test.expected.leaseTime {
+				t.Fatalf("parsed %+v, expected %+v", m, test.expected)
+			}
+
+			if !bytes.Equal(m.clientMAC, testMAC(testClientMAC)) {
+				t.Fatalf("parsed client mac %s, expected %s", m.clientMAC, testClientMAC)
+			}
+		})
+	}
+}
+
+func TestUDPPayload(t *testing.T) {
+	frame := testDHCPServerFrame("02:00:00:00:00:0a", dhcpOffer, "10.0.0.10")
+
+	payload, ok := udpPayload(frame, parseFrame(frame))
+	if !ok || !bytes.Equal(payload, testBOOTP(bootpReply, dhcpOffer, "10.0.0.10", 3600)) {
+		t.Fatal("udp payload differs from the datagram payload")
+	}
+
+	tcp := testIPv4Frame(ipProtocolTCP, testTransport(ipProtocolTCP, 67, 68))
+
+	_, ok = udpPayload(tcp, parseFrame(tcp))
+	if ok {
+		t.Fatal("returned payload of tcp segment")
+	}
+}
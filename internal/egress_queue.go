@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"github.com/lucasl0st/trestle/internal/util"
+	"github.com/songgao/packets/ethernet"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultQueueSize = 500
+
+// redWeight is the weight of the current queue length in the average queue length used by RED
+const redWeight = 0.002
+const defaultREDMaxProbability = 0.1
+
+type DropPolicy string
+
+const (
+	// DropPolicyTail drops frames once the queue is full
+	DropPolicyTail DropPolicy = "tail"
+	// DropPolicyRED drops frames randomly with increasing probability as the average queue length grows
+	DropPolicyRED DropPolicy = "red"
+)
+
+// QueueConfig is the configuration of the egress queues of a port
+type QueueConfig struct {
+	// Size is the maximum amount of frames in each queue
+	Size int
+	// DropPolicy decides which frames are dropped when the port is congested, tail if empty
+	DropPolicy DropPolicy
+	// REDMinThreshold is the average queue length above which frames are dropped randomly
+	REDMinThreshold int
+	// REDMaxThreshold is the average queue length above which all frames are dropped
+	REDMaxThreshold int
+	// REDMaxProbability is the drop probability at the maximum threshold
+	REDMaxProbability float64
+}
+
+// ClassStatus are the counters of an egress queue of a port
+type ClassStatus struct {
+	Class    int
+	Queued   int
+	Enqueued uint64
+	Sent     uint64
+	Drops    uint64
+}
+
+// trafficClass is a single egress queue of a port
+type trafficClass struct {
+	queue *util.Queue[ethernet.Frame]
+
+	mu      sync.Mutex
+	average float64
+
+	enqueued atomic.Uint64
+	sent     atomic.Uint64
+	drops    atomic.Uint64
+}
+
+// egressQueue is a thread-safe set of queues of frames sent to a port, adding never blocks and frames are dropped instead,
+// grab must only be called by a single writer
+type egressQueue struct {
+	cfg QueueConfig
+	qos QoSConfig
+
+	classes []*trafficClass
+	// ready holds a token for every queued frame
+	ready chan struct{}
+	done  chan struct{}
+	once  sync.Once
+
+	// state of the weighted scheduler
+	current int
+	served  int
+}
+
+func newEgressQueue(cfg QueueConfig, qos QoSConfig) *egressQueue {
+	if cfg.Size == 0 {
+		cfg.Size = defaultQueueSize
+	}
+
+	if cfg.DropPolicy == "" {
+		cfg.DropPolicy = DropPolicyTail
+	}
+
+	if cfg.REDMinThreshold == 0 {
+		cfg.REDMinThreshold = cfg.Size / 4
+	}
+
+	if cfg.REDMaxThreshold == 0 {
+		cfg.REDMaxThreshold = cfg.Size * 3 / 4
+	}
+
+	// the thresholds must span a range for the drop probability to grow
+	if cfg.REDMaxThreshold <= cfg.REDMinThreshold {
+		cfg.REDMaxThreshold = cfg.REDMinThreshold + 1
+	}
+
+	if cfg.REDMaxProbability == 0 {
+		cfg.REDMaxProbability = defaultREDMaxProbability
+	}
+
+	q := &egressQueue{
+		cfg:   cfg,
+		qos:   qos,
+		ready: make(chan struct{}, cfg.Size*qos.classes()),
+		done:  make(chan struct{}),
+	}
+
+	for range qos.classes() {
+		q.classes = append(q.classes, &trafficClass{queue: util.NewQueue[ethernet.Frame](cfg.Size)})
+	}
+
+	q.current = len(q.classes) - 1
+	return q
+}
+
+// add adds a frame to the queue of its priority or drops it if the queue is congested
+func (q *egressQueue) add(frame ethernet.Frame, priority uint8) {
+	c := q.classes[q.qos.class(priority)]
+
+	if q.cfg.DropPolicy == DropPolicyRED && c.dropEarly(q.cfg) {
+		c.drops.Add(1)
+		return
+	}
+
+	if !c.queue.TryAdd(frame) {
+		c.drops.Add(1)
+		return
+	}
+
+	c.enqueued.Add(1)
+
+	// never blocks, there are never more tokens than queued frames
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// dropEarly updates the average queue length and decides if a frame is dropped before the queue is full
+func (c *trafficClass) dropEarly(cfg QueueConfig) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.average = (1-redWeight)*c.average + redWeight*float64(c.queue.Len())
+
+	minThreshold := float64(cfg.REDMinThreshold)
+	maxThreshold := float64(cfg.REDMaxThreshold)
+
+	if c.average < minThreshold {
+		return false
+	}
+
+	if c.average >= maxThreshold {
+		return true
+	}
+
+	probability := cfg.REDMaxProbability * (c.average - minThreshold) / (maxThreshold - minThreshold)
+	return rand.Float64() < probability
+}
+
+// grab returns the next frame chosen by the scheduler, blocking until a frame is queued, returns false once closed
+func (q *egressQueue) grab() (ethernet.Frame, bool) {
+	for {
+		select {
+		case <-q.done:
+			return nil, false
+		case <-q.ready:
+		}
+
+		frame, ok := q.next()
+		if ok {
+			return frame, true
+		}
+	}
+}
+
+func (q *egressQueue) next() (ethernet.Frame, bool) {
+	if q.qos.Scheduler == SchedulerWeighted {
+		return q.nextWeighted()
+	}
+
+	for i := len(q.classes) - 1; i >= 0; i-- {
+		frame, ok := q.classes[i].grab()
+		if ok {
+			return frame, true
+		}
+	}
+
+	return nil, false
+}
+
+// nextWeighted sends up to weight frames of a class before moving on to the next lower class
+func (q *egressQueue) nextWeighted() (ethernet.Frame, bool) {
+	for range len(q.classes) + 1 {
+		if q.served < q.qos.weight(q.current) {
+			frame, ok := q.classes[q.current].grab()
+			if ok {
+				q.served++
+				return frame, true
+			}
+		}
+
+		q.served = 0
+		q.current--
+		if q.current < 0 {
+			q.current = len(q.classes) - 1
+		}
+	}
+
+	return nil, false
+}
+
+func (c *trafficClass) grab() (ethernet.Frame, bool) {
+	frame, ok := c.queue.TryGrab()
+	if ok {
+		c.sent.Add(1)
+	}
+
+	return frame, ok
+}
+
+func (q *egressQueue) close() {
+	q.once.Do(func() {
+		close(q.done)
+
+		for _, c := range q.classes {
+			c.queue.Close()
+		}
+	})
+}
+
+func (q *egressQueue) status() []ClassStatus {
+	var status []ClassStatus
+
+	for i, c := range q.classes {
+		status = append(status, ClassStatus{
+			Class:    i,
+			Queued:   c.queue.Len(),
+			Enqueued: c.enqueued.Load(),
+			Sent:     c.sent.Load(),
+			Drops:    c.drops.Load(),
+		})
+	}
+
+	return status
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"bytes"
+	"github.com/lucasl0st/trestle/internal/util"
+	"github.com/songgao/packets/ethernet"
+	"testing"
+)
+
+func TestEgressQueueTailDrop(t *testing.T) {
+	q := newEgressQueue(QueueConfig{Size: 2}, QoSConfig{})
+	defer q.close()
+
+	frames := []ethernet.Frame{
+		testFrame("02:00:00:00:00:01", "02:00:00:00:00:0a"),
+		testFrame("02:00:00:00:00:02", "02:00:00:00:00:0a"),
+		testFrame("02:00:00:00:00:03", "02:00:00:00:00:0a"),
+	}
+
+	for _, frame := range frames {
+		q.add(frame, 0)
+	}
+
+	status := q.status()[0]
+	if status.Queued != 2 || status.Enqueued != 2 || status.Drops != 1 {
+		t.Fatalf("queue status is %+v, expected 2 queued and enqueued with 1 drop", status)
+	}
+
+	// the frame arriving at the full queue is dropped
+	for _, expected := range frames[:2] {
+		frame, ok := q.grab()
+		if !ok || !bytes.Equal(frame, expected) {
+			t.Fatalf("grabbed frame to %s, expected %s", frame.Destination(), expected.Destination())
+		}
+	}
+
+	if q.status()[0].Sent != 2 {
+		t.Fatalf("queue sent %d frames, expected 2", q.status()[0].Sent)
+	}
+}
+
+func TestTrafficClassDropEarly(t *testing.T) {
+	cfg := QueueConfig{REDMinThreshold: 10, REDMaxThreshold: 20, REDMaxProbability: 1}
+
+	tests := []struct {
+		name    string
+		average float64
+		queued  int
+		drops   bool
+		keeps   bool
+	}{
+		{name: "empty queue", average: 0, drops: false, keeps: true},
+		{name: "below min threshold", average: 9, queued: 9, drops: false, keeps: true},
+		{name: "between thresholds", average: 15, queued: 15, drops: true, keeps: true},
+		{name: "above max threshold", average: 25, queued: 25, drops: true, keeps: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &trafficClass{queue: util.NewQueue[ethernet.Frame](100)}
+			for range test.queued {
+				c.queue.TryAdd(testFrame("02:00:00:00:00:01", "02:00:00:00:00:0a"))
+			}
+
+			var dropped, kept bool
+			for range 100 {
+				c.average = test.average
+
+				if c.dropEarly(cfg) {
+					dropped = true
+				} else {
+					kept = true
+				}
+			}
+
+			if dropped != test.drops || kept != test.keeps {
+				t.Fatalf("frames were dropped %t and kept %t, expected dropped %t and kept %t", dropped, kept, test.drops, test.keeps)
+			}
+		})
+	}
+}
+
+func TestEgressQueueRED(t *testing.T) {
+	q := newEgressQueue(QueueConfig{Size: 100, DropPolicy: DropPolicyRED, REDMinThreshold: 1, REDMaxThreshold: 2}, QoSConfig{})
+	defer q.close()
+
+	// the average queue length is above the max threshold, frames are dropped before the queue is full
+	q.classes[0].average = 10
+
+	q.add(testFrame("02:00:00:00:00:01", "02:00:00:00:00:0a"), 0)
+
+	status := q.status()[0]
+	if status.Queued != 0 || status.Drops != 1 {
+		t.Fatalf("queue status is %+v, expected the frame to be dropped", status)
+	}
+}
+
+func TestEgressQueueClose(t *testing.T) {
+	q := newEgressQueue(QueueConfig{}, QoSConfig{})
+	q.close()
+	q.close()
+
+	_, ok := q.grab()
+	if ok {
+		t.Fatal("grabbed frame from closed queue")
+	}
+}
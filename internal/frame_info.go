@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"encoding/binary"
+	"github.com/songgao/packets/ethernet"
+	"net"
+	"slices"
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeARP  = 0x0806
+	etherTypeIPv6 = 0x86dd
+)
+
+const (
+	ipProtocolHopByHop    = 0
+	ipProtocolICMP        = 1
+	ipProtocolTCP         = 6
+	ipProtocolUDP         = 17
+	ipProtocolRouting     = 43
+	ipProtocolFragment    = 44
+	ipProtocolICMPv6      = 58
+	ipProtocolDestination = 60
+)
+
+// stackedTPIDs are the tag protocol identifiers of VLAN tags that are skipped behind the outer tag
+var stackedTPIDs = []uint16{0x8100, 0x88a8, 0x9100}
+
+const ipv4MinHeaderSize = 20
+const ipv6HeaderSize = 40
+
+// frameInfo are the header fields of an untagged frame used to classify it
+type frameInfo struct {
+	etherType uint16
+
+	// the following fields are only set for IP packets
+	ip              bool
+	sourceIP        net.IP
+	destinationIP   net.IP
+	protocol        uint8
+	dscp            uint8
+	sourcePort      uint16
+	destinationPort uint16
+	// l4 is set if the ports were parsed from a TCP or UDP header
+	l4 bool
+	// incomplete is set if the ports could not be parsed because the packet is a later fragment or its headers are
+	// truncated, protocol is 0 if even the protocol is unknown
+	incomplete bool
+	// transportOffset is the offset of the transport header in the frame
+	transportOffset int
+
+	// stacked is set if the headers were parsed behind further VLAN tags
+	stacked bool
+	// extended is set for IPv6 packets with extension headers
+	extended bool
+}
+
+// parseFrame parses the ethernet, IP and TCP/UDP headers of an untagged frame, missing or truncated headers are skipped
+func parseFrame(frame ethernet.Frame) frameInfo {
+	var info frameInfo
+	if len(frame) < ethernetHeaderSize {
+		return info
+	}
+
+	info.etherType = binary.BigEndian.Uint16(frame[12:14])
+	offset := ethernetHeaderSize
+
+	// the headers of double tagged frames follow the inner tags
+	for slices.Contains(stackedTPIDs, info.etherType) && len(frame) >= offset+vlanTagSize {
+		info.etherType = binary.BigEndian.Uint16(frame[offset+2 : offset+4])
+		info.stacked = true
+		offset += vlanTagSize
+	}
+
+	payload := frame[offset:]
+	headerSize := 0
+	fragment := false
+
+	switch info.etherType {
+	case etherTypeIPv4:
+		if len(payload) < ipv4MinHeaderSize || payload[0]>>4 != 4 {
+			return info
+		}
+
+		headerSize = int(payload[0]&0x0f) * 4
+		if headerSize < ipv4MinHeaderSize || len(payload) < headerSize {
+			return info
+		}
+
+		info.ip = true
+		info.dscp = payload[1] >> 2
+		info.protocol = payload[9]
+		info.sourceIP = net.IP(payload[12:16])
+		info.destinationIP = net.IP(payload[16:20])
+
+		// only the first fragment carries the transport header
+		fragment = binary.BigEndian.Uint16(payload[6:8])&0x1fff != 0
+	case etherTypeIPv6:
+		if len(payload) < ipv6HeaderSize || payload[0]>>4 != 6 {
+			return info
+		}
+
+		info.ip = true
+		info.dscp = (payload[0]&0x0f)<<2 | payload[1]>>6
+		info.sourceIP = net.IP(payload[8:24])
+		info.destinationIP = net.IP(payload[24:40])
+
+		var ok bool
+		info.protocol, headerSize, fragment, ok = parseIPv6ExtensionHeaders(payload)
+		if !ok {
+			info.protocol = 0
+			info.incomplete = true
+			return info
+		}
+
+		info.extended = headerSize > ipv6HeaderSize
+	default:
+		return info
+	}
+
+	info.transportOffset = offset + headerSize
+
+	if info.protocol != ipProtocolTCP && info.protocol != ipProtocolUDP {
+		return info
+	}
+
+	l4 := payload[headerSize:]
+	if fragment || len(l4) < 4 {
+		info.incomplete = true
+		return info
+	}
+
+	info.l4 = true
+	info.sourcePort = binary.BigEndian.Uint16(l4[0:2])
+	info.destinationPort = binary.BigEndian.Uint16(l4[2:4])
+
+	return info
+}
+
+// parseIPv6ExtensionHeaders follows the extension headers of an IPv6 packet, returns the upper layer protocol, the size of
+// all headers and whether the packet is a later fragment, fails if the headers are truncated or the protocol of a later
+// fragment is hidden behind further extension headers
+func parseIPv6ExtensionHeaders(packet []byte) (uint8, int, bool, bool) {
+	protocol := packet[6]
+	size := ipv6HeaderSize
+
+	for {
+		header := packet[size:]
+
+		switch protocol {
+		case ipProtocolHopByHop, ipProtocolRouting, ipProtocolDestination:
+			if len(header) < 8 || len(header) < (int(header[1])+1)*8 {
+				return 0, 0, false, false
+			}
+
+			protocol = header[0]
+			size += (int(header[1]) + 1) * 8
+		case ipProtocolFragment:
+			if len(header) < 8 {
+				return 0, 0, false, false
+			}
+
+			protocol = header[0]
+			size += 8
+
+			// later fragments carry no further headers
+			if binary.BigEndian.Uint16(header[2:4])>>3 != 0 {
+				if isIPv6ExtensionHeader(protocol) {
+					return 0, 0, false, false
+				}
+
+				return protocol, size, true, true
+			}
+		default:
+			return protocol, size, false, true
+		}
+	}
+}
+
+func isIPv6ExtensionHeader(protocol uint8) bool {
+	return protocol == ipProtocolHopByHop || protocol == ipProtocolRouting || protocol == ipProtocolFragment ||
+		protocol == ipProtocolDestination
+}
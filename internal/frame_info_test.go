@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"encoding/binary"
+	"github.com/songgao/packets/ethernet"
+	"net/netip"
+	"testing"
+)
+
+var (
+	testSourceIPv4      = netip.MustParseAddr("192.0.2.1")
+	testDestinationIPv4 = netip.MustParseAddr("192.0.2.2")
+	testSourceIPv6      = netip.MustParseAddr("2001:db8::1")
+	testDestinationIPv6 = netip.MustParseAddr("2001:db8::2")
+)
+
+// testTransport returns a TCP or UDP header with the given ports
+func testTransport(protocol uint8, sourcePort uint16, destinationPort uint16) []byte {
+	if protocol == ipProtocolUDP {
+		return udpDatagram(sourcePort, destinationPort, nil)
+	}
+
+	header := make([]byte, 20)
+	binary.BigEndian.PutUint16(header[0:2], sourcePort)
+	binary.BigEndian.PutUint16(header[2:4], destinationPort)
+	header[12] = 5 << 4
+	return header
+}
+
+func testIPv4Frame(protocol uint8, payload []byte) ethernet.Frame {
+	return ipv4Frame(testMAC("02:00:00:00:00:0a"), testSourceIPv4, testMAC("02:00:00:00:00:0b"), testDestinationIPv4, protocol, 64, payload)
+}
+
+// testIPv6Frame returns an IPv6 frame whose first header is protocol
+func testIPv6Frame(protocol uint8, payload []byte) ethernet.Frame {
+	return ipv6Frame(testMAC("02:00:00:00:00:0a"), testSourceIPv6, testMAC("02:00:00:00:00:0b"), testDestinationIPv6, protocol, 64, payload)
+}
+
+// testExtensionHeader returns an IPv6 hop-by-hop, routing or destination options header of 8 bytes that is followed by next
+func testExtensionHeader(next uint8) []byte {
+	header := make([]byte, 8)
+	header[0] = next
+	return header
+}
+
+// testFragmentHeader returns an IPv6 fragment header that is followed by next
+func testFragmentHeader(next uint8, offset uint16) []byte {
+	header := make([]byte, 8)
+	header[0] = next
+	binary.BigEndian.PutUint16(header[2:4], offset<<3|1)
+	return header
+}
+
+// testFragment marks an IPv4 frame as a fragment at offset
+func testFragment(frame ethernet.Frame, offset uint16) ethernet.Frame {
+	binary.BigEndian.PutUint16(frame[ethernetHeaderSize+6:ethernetHeaderSize+8], offset)
+	return frame
+}
+
+// testStacked inserts an inner VLAN tag into an untagged frame
+func testStacked(frame ethernet.Frame, tpid uint16) ethernet.Frame {
+	stacked := append(ethernet.Frame{}, frame[:12]...)
+	stacked = binary.BigEndian.AppendUint16(stacked, tpid)
+	stacked = binary.BigEndian.AppendUint16(stacked, 100)
+	return append(stacked, frame[12:]...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, part := range parts {
+		b = append(b, part...)
+	}
+
+	return b
+}
+
+func TestParseFrame(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame ethernet.Frame
+
+		protocol        uint8
+		l4              bool
+		incomplete      bool
+		stacked         bool
+		extended        bool
+		transportOffset int
+	}{
+		{
+			name:            "ipv4 udp",
+			frame:           testIPv4Frame(ipProtocolUDP, testTransport(ipProtocolUDP, 1000, 53)),
+			protocol:        ipProtocolUDP,
+			l4:              true,
+			transportOffset: ethernetHeaderSize + ipv4MinHeaderSize,
+		},
+		{
+			name:            "ipv4 later fragment",
+			frame:           testFragment(testIPv4Frame(ipProtocolTCP, testTransport(ipProtocolTCP, 1000, 22)), 185),
+			protocol:        ipProtocolTCP,
+			incomplete:      true,
+			transportOffset: ethernetHeaderSize + ipv4MinHeaderSize,
+		},
+		{
+			name:            "ipv4 icmp",
+			frame:           testIPv4Frame(ipProtocolICMP, make([]byte, 8)),
+			protocol:        ipProtocolICMP,
+			transportOffset: ethernetHeaderSize + ipv4MinHeaderSize,
+		},
+		{
+			name:            "ipv6 tcp",
+			frame:           testIPv6Frame(ipProtocolTCP, testTransport(ipProtocolTCP, 1000, 22)),
+			protocol:        ipProtocolTCP,
+			l4:              true,
+			transportOffset: ethernetHeaderSize + ipv6HeaderSize,
+		},
+		{
+			name: "ipv6 extension headers",
+			frame: testIPv6Frame(ipProtocolHopByHop, concat(
+				testExtensionHeader(ipProtocolRouting),
+				testExtensionHeader(ipProtocolDestination),
+				testExtensionHeader(ipProtocolTCP),
+				testTransport(ipProtocolTCP, 1000, 22),
+			)),
+			protocol:        ipProtocolTCP,
+			l4:              true,
+			extended:        true,
+			transportOffset: ethernetHeaderSize + ipv6HeaderSize + 24,
+		},
+		{
+			name:            "ipv6 first fragment",
+			frame:           testIPv6Frame(ipProtocolFragment, concat(testFragmentHeader(ipProtocolUDP, 0), testTransport(ipProtocolUDP, 1000, 53))),
+			protocol:        ipProtocolUDP,
+			l4:              true,
+			extended:        true,
+			transportOffset: ethernetHeaderSize + ipv6HeaderSize + 8,
+		},
+		{
+			name:            "ipv6 later fragment",
+			frame:           testIPv6Frame(ipProtocolFragment, concat(testFragmentHeader(ipProtocolUDP, 10), make([]byte, 16))),
+			protocol:        ipProtocolUDP,
+			incomplete:      true,
+			extended:        true,
+			transportOffset: ethernetHeaderSize + ipv6HeaderSize + 8,
+		},
+		{
+			name:       "ipv6 later fragment behind extension header",
+			frame:      testIPv6Frame(ipProtocolFragment, concat(testFragmentHeader(ipProtocolDestination, 10), make([]byte, 16))),
+			incomplete: true,
+		},
+		{
+			name:       "ipv6 truncated extension header",
+			frame:      testIPv6Frame(ipProtocolHopByHop, []byte{ipProtocolTCP, 1, 0, 0, 0, 0, 0, 0}),
+			incomplete: true,
+		},
+		{
+			name:            "double tagged ipv4 udp",
+			frame:           testStacked(testIPv4Frame(ipProtocolUDP, testTransport(ipProtocolUDP, 1000, 53)), vlanTPID),
+			protocol:        ipProtocolUDP,
+			l4:              true,
+			stacked:         true,
+			transportOffset: ethernetHeaderSize + vlanTagSize + ipv4MinHeaderSize,
+		},
+		{
+			name:            "802.1ad tagged ipv6 udp",
+			frame:           testStacked(testIPv6Frame(ipProtocolUDP, testTransport(ipProtocolUDP, 1000, 53)), 0x88a8),
+			protocol:        ipProtocolUDP,
+			l4:              true,
+			stacked:         true,
+			transportOffset: ethernetHeaderSize + vlanTagSize + ipv6HeaderSize,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info := parseFrame(test.frame)
+
+			if !info.ip {
+				t.Fatal("frame is not parsed as ip packet")
+			}
+
+			if info.protocol != test.protocol || info.l4 != test.l4 || info.incomplete != test.incomplete ||
+				info.stacked != test.stacked || info.extended != test.extended {
+				t.Fatalf("parsed protocol %d, l4 %t, incomplete %t, stacked %t, extended %t, expected %d, %t, %t, %t, %t",
+					info.protocol, info.l4, info.incomplete, info.stacked, info.extended,
+					test.protocol, test.l4, test.incomplete, test.stacked, test.extended)
+			}
+
+			if test.transportOffset != 0 && info.transportOffset != test.transportOffset {
+				t.Fatalf("transport offset is %d, expected %d", info.transportOffset, test.transportOffset)
+			}
+
+			if test.l4 && info.sourcePort != 1000 {
+				t.Fatalf("source port is %d, expected 1000", info.sourcePort)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"github.com/lucasl0st/trestle/pkg/packet"
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"hash"
+	"time"
+)
+
+// the handshake follows the Noise IKpsk2 pattern, peers without a preshared key use an all zero key:
+//
+//	<- s
+//	...
+//	-> e, es, s, ss
+//	<- e, ee, se, psk
+const noiseProtocolName = "Noise_IKpsk2_25519_ChaChaPoly_BLAKE2s"
+const noisePrologue = "trestle"
+
+const KeySize = curve25519.ScalarSize
+
+type keyPair struct {
+	private [KeySize]byte
+	public  [KeySize]byte
+}
+
+// GenerateKey generates a new random X25519 private key
+func GenerateKey() ([KeySize]byte, error) {
+	var key [KeySize]byte
+	_, err := rand.Read(key[:])
+	return key, err
+}
+
+// PublicKey derives the public key of an X25519 private key
+func PublicKey(privateKey [KeySize]byte) ([KeySize]byte, error) {
+	var key [KeySize]byte
+	public, err := curve25519.X25519(privateKey[:], curve25519.Basepoint)
+	if err != nil {
+		return key, err
+	}
+
+	copy(key[:], public)
+	return key, nil
+}
+
+func newKeyPair(privateKey [KeySize]byte) (keyPair, error) {
+	public, err := PublicKey(privateKey)
+	if err != nil {
+		return keyPair{}, err
+	}
+
+	return keyPair{private: privateKey, public: public}, nil
+}
+
+func newEphemeralKeyPair() (keyPair, error) {
+	private, err := GenerateKey()
+	if err != nil {
+		return keyPair{}, err
+	}
+
+	return newKeyPair(private)
+}
+
+func dh(private [KeySize]byte, public []byte) ([]byte, error) {
+	return curve25519.X25519(private[:], public)
+}
+
+type symmetricState struct {
+	ck [blake2s.Size]byte
+	h  [blake2s.Size]byte
+	k  [chacha20poly1305.KeySize]byte
+	n  uint64
+}
+
+func newSymmetricState() *symmetricState {
+	s := &symmetricState{}
+	s.h = blake2s.Sum256([]byte(noiseProtocolName))
+	s.ck = s.h
+	s.mixHash([]byte(noisePrologue))
+	return s
+}
+
+func (s *symmetricState) mixHash(data []byte) {
+	h, _ := blake2s.New256(nil)
+	h.Write(s.h[:])
+	h.Write(data)
+	h.Sum(s.h[:0])
+}
+
+func (s *symmetricState) mixKey(inputKeyMaterial []byte) {
+	s.ck, s.k, _ = hkdf(s.ck[:], inputKeyMaterial)
+	s.n = 0
+}
+
+func (s *symmetricState) mixKeyAndHash(inputKeyMaterial []byte) {
+	var h [blake2s.Size]byte
+	s.ck, h, s.k = hkdf(s.ck[:], inputKeyMaterial)
+	s.mixHash(h[:])
+	s.n = 0
+}
+
+func (s *symmetricState) mixDH(private [KeySize]byte, public []byte) error {
+	shared, err := dh(private, public)
+	if err != nil {
+		return err
+	}
+
+	s.mixKey(shared)
+	return nil
+}
+
+func (s *symmetricState) encryptAndHash(plaintext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(s.k[:])
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext := aead.Seal(nil, noiseNonce(s.n), plaintext, s.h[:])
+	s.n++
+	s.mixHash(ciphertext)
+	return ciphertext, nil
+}
+
+func (s *symmetricState) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(s.k[:])
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := aead.Open(nil, noiseNonce(s.n), ciphertext, s.h[:])
+	if err != nil {
+		return nil, err
+	}
+
+	s.n++
+	s.mixHash(ciphertext)
+	return plaintext, nil
+}
+
+func (s *symmetricState) split() ([chacha20poly1305.KeySize]byte, [chacha20poly1305.KeySize]byte) {
+	k1, k2, _ := hkdf(s.ck[:], nil)
+	return k1, k2
+}
+
+func noiseNonce(n uint64) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(nonce[4:], n)
+	return nonce
+}
+
+func newHMAC(key []byte) hash.Hash {
+	return hmac.New(func() hash.Hash {
+		h, _ := blake2s.New256(nil)
+		return h
+	}, key)
+}
+
+func hkdf(chainingKey []byte, inputKeyMaterial []byte) ([blake2s.Size]byte, [blake2s.Size]byte, [blake2s.Size]byte) {
+	var tempKey, out1, out2, out3 [blake2s.Size]byte
+
+	mac := newHMAC(chainingKey)
+	mac.Write(inputKeyMaterial)
+	mac.Sum(tempKey[:0])
+
+	mac = newHMAC(tempKey[:])
+	mac.Write([]byte{0x01})
+	mac.Sum(out1[:0])
+
+	mac = newHMAC(tempKey[:])
+	mac.Write(out1[:])
+	mac.Write([]byte{0x02})
+	mac.Sum(out2[:0])
+
+	mac = newHMAC(tempKey[:])
+	mac.Write(out2[:])
+	mac.Write([]byte{0x03})
+	mac.Sum(out3[:0])
+
+	return out1, out2, out3
+}
+
+type handshake struct {
+	state     *symmetricState
+	initiator bool
+
+	local     keyPair
+	ephemeral keyPair
+
+	remoteStatic    [KeySize]byte
+	remoteEphemeral [KeySize]byte
+	presharedKey    [KeySize]byte
+
+	// session indices, each side picks its own index and addresses packets with the index of the other side
+	localIndex  uint32
+	remoteIndex uint32
+
+	initiatedAt time.Time
+}
+
+func newInitiatorHandshake(local keyPair, remoteStatic [KeySize]byte, presharedKey [KeySize]byte) *handshake {
+	hs := &handshake{
+		state:        newSymmetricState(),
+		initiator:    true,
+		local:        local,
+		remoteStatic: remoteStatic,
+		presharedKey: presharedKey,
+		initiatedAt:  time.Now(),
+	}
+
+	hs.state.mixHash(remoteStatic[:])
+	return hs
+}
+
+func newResponderHandshake(local keyPair) *handshake {
+	hs := &handshake{
+		state: newSymmetricState(),
+		local: local,
+	}
+
+	hs.state.mixHash(local.public[:])
+	return hs
+}
+
+func (hs *handshake) createInitiation(payload []byte) (*packet.HandshakeInitiation, error) {
+	var err error
+
+	hs.ephemeral, err = newEphemeralKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	hs.state.mixHash(hs.ephemeral.public[:])
+
+	err = hs.state.mixDH(hs.ephemeral.private, hs.remoteStatic[:])
+	if err != nil {
+		return nil, err
+	}
+
+	static, err := hs.state.encryptAndHash(hs.local.public[:])
+	if err != nil {
+		return nil, err
+	}
+
+	err = hs.state.mixDH(hs.local.private, hs.remoteStatic[:])
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedPayload, err := hs.state.encryptAndHash(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &packet.HandshakeInitiation{
+		Ephemeral: hs.ephemeral.public[:],
+		Static:    static,
+		Payload:   encryptedPayload,
+	}, nil
+}
+
+func (hs *handshake) consumeInitiation(initiation *packet.HandshakeInitiation) ([]byte, error) {
+	if len(initiation.Ephemeral) != KeySize {
+		return nil, errors.New("invalid ephemeral key size")
+	}
+
+	copy(hs.remoteEphemeral[:], initiation.Ephemeral)
+	hs.state.mixHash(hs.remoteEphemeral[:])
+
+	err := hs.state.mixDH(hs.local.private, hs.remoteEphemeral[:])
+	if err != nil {
+		return nil, err
+	}
+
+	static, err := hs.state.decryptAndHash(initiation.Static)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(static) != KeySize {
+		return nil, errors.New("invalid static key size")
+	}
+
+	copy(hs.remoteStatic[:], static)
+
+	err = hs.state.mixDH(hs.local.private, hs.remoteStatic[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return hs.state.decryptAndHash(initiation.Payload)
+}
+
+// createResponse must be called after consumeInitiation and after the preshared key of the initiator is set
+func (hs *handshake) createResponse(payload []byte) (*packet.HandshakeResponse, error) {
+	var err error
+
+	hs.ephemeral, err = newEphemeralKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	hs.state.mixHash(hs.ephemeral.public[:])
+
+	err = hs.state.mixDH(hs.ephemeral.private, hs.remoteEphemeral[:])
+	if err != nil {
+		return nil, err
+	}
+
+	err = hs.state.mixDH(hs.ephemeral.private, hs.remoteStatic[:])
+	if err != nil {
+		return nil, err
+	}
+
+	hs.state.mixKeyAndHash(hs.presharedKey[:])
+
+	encryptedPayload, err := hs.state.encryptAndHash(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &packet.HandshakeResponse{
+		Ephemeral: hs.ephemeral.public[:],
+		Payload:   encryptedPayload,
+	}, nil
+}
+
+func (hs *handshake) consumeResponse(response *packet.HandshakeResponse) ([]byte, error) {
+	if len(response.Ephemeral) != KeySize {
+		return nil, errors.New("invalid ephemeral key size")
+	}
+
+	copy(hs.remoteEphemeral[:], response.Ephemeral)
+	hs.state.mixHash(hs.remoteEphemeral[:])
+
+	err := hs.state.mixDH(hs.ephemeral.private, hs.remoteEphemeral[:])
+	if err != nil {
+		return nil, err
+	}
+
+	err = hs.state.mixDH(hs.local.private, hs.remoteEphemeral[:])
+	if err != nil {
+		return nil, err
+	}
+
+	hs.state.mixKeyAndHash(hs.presharedKey[:])
+
+	return hs.state.decryptAndHash(response.Payload)
+}
+
+// transportKeys returns the keys used for sending and receiving transport packets
+func (hs *handshake) transportKeys() ([chacha20poly1305.KeySize]byte, [chacha20poly1305.KeySize]byte) {
+	initiatorKey, responderKey := hs.state.split()
+	if hs.initiator {
+		return initiatorKey, responderKey
+	}
+
+	return responderKey, initiatorKey
+}
@@ -0,0 +1,239 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/lucasl0st/trestle/internal/util"
+	"github.com/lucasl0st/trestle/pkg/packet"
+	"google.golang.org/protobuf/proto"
+	"testing"
+	"time"
+)
+
+func testKeyPair(t *testing.T) keyPair {
+	t.Helper()
+
+	private, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := newKeyPair(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func testListener(key keyPair, acceptUnknown bool) *listener {
+	return &listener{
+		mtu:                 1500,
+		networkMTU:          1400,
+		key:                 key,
+		acceptUnknown:       acceptUnknown,
+		identities:          util.NewSafeMap[string, identity](),
+		publicKeyToName:     util.NewSafeMap[[KeySize]byte, string](),
+		handshakeTimestamps: util.NewSafeMap[[KeySize]byte, uint64](),
+	}
+}
+
+// testHandshake runs a full handshake between two key pairs and returns both sides
+func testHandshake(t *testing.T, initiatorKey keyPair, responderKey keyPair, initiatorPSK [KeySize]byte, responderPSK [KeySize]byte) (*handshake, *handshake, error) {
+	t.Helper()
+
+	initiator := newInitiatorHandshake(initiatorKey, responderKey.public, initiatorPSK)
+	initiation, err := initiator.createInitiation([]byte("initiation"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responder := newResponderHandshake(responderKey)
+	payload, err := responder.consumeInitiation(initiation)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !bytes.Equal(payload, []byte("initiation")) {
+		t.Fatalf("initiation payload is %q", payload)
+	}
+
+	responder.presharedKey = responderPSK
+	response, err := responder.createResponse([]byte("response"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err = initiator.consumeResponse(response)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !bytes.Equal(payload, []byte("response")) {
+		t.Fatalf("response payload is %q", payload)
+	}
+
+	return initiator, responder, nil
+}
+
+func TestHandshake(t *testing.T) {
+	initiatorKey := testKeyPair(t)
+	responderKey := testKeyPair(t)
+	psk := [KeySize]byte{1, 2, 3}
+
+	initiator, responder, err := testHandshake(t, initiatorKey, responderKey, psk, psk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if responder.remoteStatic != initiatorKey.public {
+		t.Fatal("responder did not learn the static key of the initiator")
+	}
+
+	initiatorSend, initiatorReceive := initiator.transportKeys()
+	responderSend, responderReceive := responder.transportKeys()
+
+	if initiatorSend != responderReceive || initiatorReceive != responderSend {
+		t.Fatal("transport keys do not match")
+	}
+
+	if initiatorSend == initiatorReceive {
+		t.Fatal("send and receive keys are equal")
+	}
+}
+
+func TestHandshakeWrongPresharedKey(t *testing.T) {
+	_, _, err := testHandshake(t, testKeyPair(t), testKeyPair(t), [KeySize]byte{1}, [KeySize]byte{2})
+	if err == nil {
+		t.Fatal("handshake with different preshared keys succeeded")
+	}
+}
+
+func TestHandshakeWrongResponderKey(t *testing.T) {
+	initiator := newInitiatorHandshake(testKeyPair(t), testKeyPair(t).public, [KeySize]byte{})
+	initiation, err := initiator.createInitiation(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = newResponderHandshake(testKeyPair(t)).consumeInitiation(initiation)
+	if err == nil {
+		t.Fatal("initiation for another responder was accepted")
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	known := testKeyPair(t)
+	unknown := testKeyPair(t)
+	psk := [KeySize]byte{4, 5, 6}
+
+	tests := []struct {
+		name          string
+		acceptUnknown bool
+		remote        keyPair
+		peerId        string
+		err           bool
+	}{
+		{name: "known", remote: known, peerId: "known"},
+		{name: "known with accept unknown", acceptUnknown: true, remote: known, peerId: "known"},
+		{name: "unknown rejected", remote: unknown, err: true},
+		{name: "unknown accepted", acceptUnknown: true, remote: unknown, peerId: base64.StdEncoding.EncodeToString(unknown.public[:])},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := testListener(testKeyPair(t), test.acceptUnknown)
+
+			err := l.AddPeer("known", known.public, psk, PortConfig{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hs := &handshake{remoteStatic: test.remote.public}
+
+			peerId, err := l.identify(hs)
+			if test.err {
+				if err == nil {
+					t.Fatalf("identified unknown peer as %s", peerId)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if peerId != test.peerId {
+				t.Fatalf("peer id is %s, expected %s", peerId, test.peerId)
+			}
+
+			if test.remote == known && hs.presharedKey != psk {
+				t.Fatal("preshared key of the known peer was not set")
+			}
+		})
+	}
+}
+
+func TestSessionParametersReplay(t *testing.T) {
+	l := testListener(testKeyPair(t), false)
+	hs := &handshake{remoteStatic: testKeyPair(t).public}
+
+	parameters, err := l.sessionParameters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = l.checkSessionParameters(hs, parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = l.checkSessionParameters(hs, parameters)
+	if err == nil {
+		t.Fatal("replayed handshake was accepted")
+	}
+
+	older, err := proto.Marshal(&packet.SessionParameters{
+		Mtu:        uint32(l.mtu),
+		NetworkMtu: uint32(l.networkMTU),
+		Timestamp:  uint64(time.Now().Add(-time.Minute).UnixNano()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = l.checkSessionParameters(hs, older)
+	if err == nil {
+		t.Fatal("handshake with an older timestamp was accepted")
+	}
+
+	newer, err := l.sessionParameters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = l.checkSessionParameters(hs, newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionParametersMTU(t *testing.T) {
+	l := testListener(testKeyPair(t), false)
+	hs := &handshake{remoteStatic: testKeyPair(t).public}
+
+	parameters, err := proto.Marshal(&packet.SessionParameters{
+		Mtu:        uint32(l.mtu) + 1,
+		NetworkMtu: uint32(l.networkMTU),
+		Timestamp:  uint64(time.Now().UnixNano()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = l.checkSessionParameters(hs, parameters)
+	if err == nil {
+		t.Fatal("handshake with a different mtu was accepted")
+	}
+}
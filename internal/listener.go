@@ -1,47 +1,124 @@
 package internal
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
 	"errors"
 	"fmt"
-	"github.com/google/uuid"
 	"github.com/lucasl0st/trestle/internal/util"
 	"github.com/lucasl0st/trestle/pkg/packet"
 	"google.golang.org/protobuf/proto"
 	"log/slog"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Listener interface {
 	Listen() error
-	Connect(hostname string, port uint16) error
+	AddPeer(name string, publicKey [KeySize]byte, presharedKey [KeySize]byte, portConfig PortConfig) error
+	Connect(name string, hostname string, port uint16) error
 	Read(peerId string) (*packet.Packet, error)
 	Write(peerId string, packet *packet.Packet) error
+	Statistics(peerId string) (SessionStatistics, error)
+	Status() []PeerStatus
 	Close() error
 }
 
 type PeerReceiver interface {
-	AddPort(port Port) uint
+	AddPort(port Port, cfg PortConfig) uint
+	RemovePort(portId uint)
+}
+
+const DefaultKeepaliveInterval = 10 * time.Second
+const DefaultPeerTimeout = 45 * time.Second
+
+const incomingQueueSize = 512
+
+type ListenerConfig struct {
+	Hostname      string
+	Port          uint16
+	MTU           uint16
+	NetworkMTU    uint16
+	PrivateKey    [KeySize]byte
+	AcceptUnknown bool
+
+	// KeepaliveInterval is the interval keepalive packets are send to every peer in
+	KeepaliveInterval time.Duration
+	// PeerTimeout is the duration without any packet from a peer after which its session is closed
+	PeerTimeout time.Duration
+	// SplitHorizon is set on the ports of all peers including unknown peers, peers of a full mesh are connected
+	// directly so frames are never relayed between them
+	SplitHorizon bool
+}
+
+type identity struct {
+	name         string
+	publicKey    [KeySize]byte
+	presharedKey [KeySize]byte
+	portConfig   PortConfig
 }
 
 type listener struct {
-	mtu        uint16
-	networkMTU uint16
-	alive      bool
-	conn       *net.UDPConn
+	mtu               uint16
+	networkMTU        uint16
+	alive             atomic.Bool
+	conn              *net.UDPConn
+	key               keyPair
+	acceptUnknown     bool
+	keepaliveInterval time.Duration
+	peerTimeout       time.Duration
+	splitHorizon      bool
+
+	// peer name -> identity
+	identities *util.SafeMap[string, identity]
+	// public key -> peer name
+	publicKeyToName *util.SafeMap[[KeySize]byte, string]
+	// public key -> timestamp of the last accepted handshake message
+	handshakeTimestamps *util.SafeMap[[KeySize]byte, uint64]
 
-	// udp address -> peerId
-	addressToPeerId *util.SafeMap[string, string]
 	// peerId -> udp address
 	peerIdToAddress *util.SafeMap[string, string]
 
+	// peer name -> handshake initiated by us
+	handshakes *util.SafeMap[string, *handshake]
+	// establishLock is held while sessions are established, so no session is established after Close tore them down
+	establishLock sync.Mutex
+	// peerId -> session
+	sessions *util.SafeMap[string, *session]
+	// local session index -> peerId
+	indexToPeerId *util.SafeMap[uint32, string]
+
 	// peerId -> package queue
 	incomingPackages *util.SafeMap[string, *util.Queue[*packet.Packet]]
+	// peerId -> switch port id
+	peerIdToPortId *util.SafeMap[string, uint]
+	// peer name -> outbound connection maintained by us
+	connections *util.SafeMap[string, *connection]
 
 	receiver PeerReceiver
+
+	congestionLog *util.LogLimiter
 }
 
-func NewListener(hostname string, port uint16, mtu uint16, networkMTU uint16, receiver PeerReceiver) (Listener, error) {
-	listenAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", hostname, port))
+func NewListener(cfg ListenerConfig, receiver PeerReceiver) (Listener, error) {
+	key, err := newKeyPair(cfg.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.KeepaliveInterval == 0 {
+		cfg.KeepaliveInterval = DefaultKeepaliveInterval
+	}
+
+	if cfg.PeerTimeout == 0 {
+		cfg.PeerTimeout = DefaultPeerTimeout
+	}
+
+	listenAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", cfg.Hostname, cfg.Port))
 	if err != nil {
 		return nil, err
 	}
@@ -51,100 +128,153 @@ func NewListener(hostname string, port uint16, mtu uint16, networkMTU uint16, re
 		return nil, err
 	}
 
-	return &listener{
-		mtu:              mtu,
-		networkMTU:       networkMTU,
-		alive:            true,
-		conn:             conn,
-		addressToPeerId:  util.NewSafeMap[string, string](),
-		peerIdToAddress:  util.NewSafeMap[string, string](),
-		incomingPackages: util.NewSafeMap[string, *util.Queue[*packet.Packet]](),
-		receiver:         receiver,
-	}, nil
+	slog.Info("listening", "addr", listenAddr.String(), "publicKey", base64.StdEncoding.EncodeToString(key.public[:]))
+
+	l := &listener{
+		mtu:                 cfg.MTU,
+		networkMTU:          cfg.NetworkMTU,
+		conn:                conn,
+		key:                 key,
+		acceptUnknown:       cfg.AcceptUnknown,
+		keepaliveInterval:   cfg.KeepaliveInterval,
+		peerTimeout:         cfg.PeerTimeout,
+		splitHorizon:        cfg.SplitHorizon,
+		identities:          util.NewSafeMap[string, identity](),
+		publicKeyToName:     util.NewSafeMap[[KeySize]byte, string](),
+		handshakeTimestamps: util.NewSafeMap[[KeySize]byte, uint64](),
+		peerIdToAddress:     util.NewSafeMap[string, string](),
+		handshakes:          util.NewSafeMap[string, *handshake](),
+		sessions:            util.NewSafeMap[string, *session](),
+		indexToPeerId:       util.NewSafeMap[uint32, string](),
+		incomingPackages:    util.NewSafeMap[string, *util.Queue[*packet.Packet]](),
+		peerIdToPortId:      util.NewSafeMap[string, uint](),
+		connections:         util.NewSafeMap[string, *connection](),
+		receiver:            receiver,
+		congestionLog:       util.NewLogLimiter(logInterval),
+	}
+
+	l.alive.Store(true)
+	return l, nil
 }
 
 func (l *listener) Listen() error {
-	for l.alive {
+	go l.keepalive()
+	go l.reconnect()
+
+	for l.alive.Load() {
 		buf := make([]byte, l.networkMTU)
 		n, addr, err := l.conn.ReadFromUDP(buf)
 		if err != nil {
+			if !l.alive.Load() {
+				return nil
+			}
+
 			return err
 		}
 
 		var p packet.Packet
 		err = proto.Unmarshal(buf[:n], &p)
 		if err != nil {
-			slog.Error("could not unmarshal packet", "addr", addr.String(), "error", err)
+			slog.Debug("could not unmarshal packet", "addr", addr.String(), "error", err)
 			continue
 		}
 
-		if p.Type == packet.PacketType_ACK_SESSION {
-			err = l.ackSession(&p, addr)
+		// anyone can send datagrams to the listener, so failures of unauthenticated packets are only debug logs
+		switch p.Type {
+		case packet.PacketType_HANDSHAKE_INITIATION:
+			err = l.handshakeInitiation(&p, addr)
 			if err != nil {
-				slog.Error("failed to ack session", "addr", addr.String(), err)
+				slog.Debug("failed to respond to handshake", "addr", addr.String(), "error", err)
 			}
-
-			continue
-		}
-
-		if p.Type == packet.PacketType_INITIATE_SESSION {
-			err = l.initiateSession(&p, addr)
+		case packet.PacketType_HANDSHAKE_RESPONSE:
+			err = l.handshakeResponse(&p, addr)
 			if err != nil {
-				slog.Error("failed to initiate session", "addr", addr.String(), err)
+				slog.Debug("failed to complete handshake", "addr", addr.String(), "error", err)
 			}
-
-			continue
-		}
-
-		peerId, ok := l.addressToPeerId.Get(addr.String())
-		if !ok || p.Type == packet.PacketType_HELO {
-			err = l.establishSession(addr)
+		case packet.PacketType_TRANSPORT:
+			err = l.transport(&p, addr)
 			if err != nil {
-				slog.Error("could not establish session", "addr", addr.String(), "error", err)
+				slog.Debug("dropped unauthenticated packet", "addr", addr.String(), "error", err)
 			}
-
-			continue
+		default:
+			slog.Debug("dropped unencrypted packet", "addr", addr.String(), "type", p.Type.String())
 		}
+	}
 
-		queue, ok := l.incomingPackages.Get(peerId)
-		if !ok {
-			continue
-		}
+	return nil
+}
+
+func (l *listener) AddPeer(name string, publicKey [KeySize]byte, presharedKey [KeySize]byte, portConfig PortConfig) error {
+	_, ok := l.identities.Get(name)
+	if ok {
+		return fmt.Errorf("peer %s already added", name)
+	}
+
+	existing, ok := l.publicKeyToName.Get(publicKey)
+	if ok {
+		return fmt.Errorf("public key of peer %s is already used by peer %s", name, existing)
+	}
+
+	l.identities.Set(name, identity{
+		name:         name,
+		publicKey:    publicKey,
+		presharedKey: presharedKey,
+		portConfig:   portConfig,
+	})
+	l.publicKeyToName.Set(publicKey, name)
+	return nil
+}
 
-		queue.Add(&p)
+func (l *listener) Connect(name string, hostname string, port uint16) error {
+	_, ok := l.identities.Get(name)
+	if !ok {
+		return fmt.Errorf("peer %s not found", name)
+	}
+
+	_, ok = l.connections.Get(name)
+	if ok {
+		return fmt.Errorf("peer %s already connected", name)
 	}
 
+	l.connections.Set(name, newConnection(hostname, port))
 	return nil
 }
 
-func (l *listener) Connect(hostname string, port uint16) error {
+// initiate sends a handshake initiation to a peer
+func (l *listener) initiate(name string, hostname string, port uint16) error {
+	id, ok := l.identities.Get(name)
+	if !ok {
+		return fmt.Errorf("peer %s not found", name)
+	}
+
 	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", hostname, port))
 	if err != nil {
 		return err
 	}
 
-	p := packet.Packet{
-		Type:    packet.PacketType_HELO,
-		Payload: &packet.Packet_Helo{},
+	parameters, err := l.sessionParameters()
+	if err != nil {
+		return err
 	}
 
-	b, err := proto.Marshal(&p)
+	hs := newInitiatorHandshake(l.key, id.publicKey, id.presharedKey)
+	initiation, err := hs.createInitiation(parameters)
 	if err != nil {
 		return err
 	}
 
-	_, err = l.conn.WriteToUDP(b, addr)
-	return err
-}
+	hs.localIndex, err = l.allocateIndex()
+	if err != nil {
+		return err
+	}
+
+	initiation.Sender = hs.localIndex
+	l.handshakes.Set(name, hs)
 
-func (l *listener) establishSession(addr *net.UDPAddr) error {
 	p := packet.Packet{
-		Type: packet.PacketType_INITIATE_SESSION,
-		Payload: &packet.Packet_InitiateSession{
-			InitiateSession: &packet.InitiateSession{
-				Mtu:        uint32(l.mtu),
-				NetworkMtu: uint32(l.networkMTU),
-			},
+		Type: packet.PacketType_HANDSHAKE_INITIATION,
+		Payload: &packet.Packet_HandshakeInitiation{
+			HandshakeInitiation: initiation,
 		},
 	}
 
@@ -157,26 +287,92 @@ func (l *listener) establishSession(addr *net.UDPAddr) error {
 	return err
 }
 
-func (l *listener) initiateSession(p *packet.Packet, addr *net.UDPAddr) error {
-	payload := p.Payload.(*packet.Packet_InitiateSession)
-	if payload.InitiateSession.Mtu != uint32(l.mtu) {
-		return fmt.Errorf("session mtu %d must be the same as configured mtu %d", payload.InitiateSession.Mtu, l.mtu)
+func (l *listener) sessionParameters() ([]byte, error) {
+	return proto.Marshal(&packet.SessionParameters{
+		Mtu:        uint32(l.mtu),
+		NetworkMtu: uint32(l.networkMTU),
+		Timestamp:  uint64(time.Now().UnixNano()),
+	})
+}
+
+func (l *listener) checkSessionParameters(hs *handshake, b []byte) error {
+	var parameters packet.SessionParameters
+	err := proto.Unmarshal(b, &parameters)
+	if err != nil {
+		return err
+	}
+
+	if parameters.Mtu != uint32(l.mtu) {
+		return fmt.Errorf("session mtu %d must be the same as configured mtu %d", parameters.Mtu, l.mtu)
 	}
 
-	if payload.InitiateSession.NetworkMtu != uint32(l.networkMTU) {
-		return fmt.Errorf("session network mtu %d must be the same as configured network mtu %d", payload.InitiateSession.NetworkMtu, l.networkMTU)
+	if parameters.NetworkMtu != uint32(l.networkMTU) {
+		return fmt.Errorf("session network mtu %d must be the same as configured network mtu %d", parameters.NetworkMtu, l.networkMTU)
 	}
 
-	p = &packet.Packet{
-		Type: packet.PacketType_ACK_SESSION,
-		Payload: &packet.Packet_AckSession{
-			AckSession: &packet.AckSession{
-				Id: uuid.New().String(),
-			},
-		},
+	last, ok := l.handshakeTimestamps.Get(hs.remoteStatic)
+	if ok && parameters.Timestamp <= last {
+		return errors.New("replayed handshake")
+	}
+
+	l.handshakeTimestamps.Set(hs.remoteStatic, parameters.Timestamp)
+	return nil
+}
+
+func (l *listener) handshakeInitiation(p *packet.Packet, addr *net.UDPAddr) error {
+	payload, ok := p.Payload.(*packet.Packet_HandshakeInitiation)
+	if !ok {
+		return errors.New("message was HANDSHAKE_INITIATION but payload type is invalid")
+	}
+
+	hs := newResponderHandshake(l.key)
+	b, err := hs.consumeInitiation(payload.HandshakeInitiation)
+	if err != nil {
+		return err
+	}
+
+	peerId, err := l.identify(hs)
+	if err != nil {
+		return err
 	}
 
-	b, err := proto.Marshal(p)
+	// both sides initiated at the same time, the side with the lower public key stays initiator,
+	// unless its own initiation timed out because it was lost
+	pending, ok := l.handshakes.Get(peerId)
+	if ok && time.Since(pending.initiatedAt) < handshakeTimeout && bytes.Compare(l.key.public[:], hs.remoteStatic[:]) < 0 {
+		return nil
+	}
+
+	err = l.checkSessionParameters(hs, b)
+	if err != nil {
+		return err
+	}
+
+	parameters, err := l.sessionParameters()
+	if err != nil {
+		return err
+	}
+
+	response, err := hs.createResponse(parameters)
+	if err != nil {
+		return err
+	}
+
+	hs.remoteIndex = payload.HandshakeInitiation.Sender
+	hs.localIndex, err = l.allocateIndex()
+	if err != nil {
+		return err
+	}
+
+	response.Sender = hs.localIndex
+	response.Receiver = hs.remoteIndex
+
+	b, err = proto.Marshal(&packet.Packet{
+		Type: packet.PacketType_HANDSHAKE_RESPONSE,
+		Payload: &packet.Packet_HandshakeResponse{
+			HandshakeResponse: response,
+		},
+	})
 	if err != nil {
 		return err
 	}
@@ -186,28 +382,246 @@ func (l *listener) initiateSession(p *packet.Packet, addr *net.UDPAddr) error {
 		return err
 	}
 
-	_, ok := l.addressToPeerId.Get(addr.String())
+	l.handshakes.Delete(peerId)
+	return l.establishSession(peerId, hs, addr)
+}
+
+func (l *listener) handshakeResponse(p *packet.Packet, addr *net.UDPAddr) error {
+	payload, ok := p.Payload.(*packet.Packet_HandshakeResponse)
 	if !ok {
-		return l.establishSession(addr)
+		return errors.New("message was HANDSHAKE_RESPONSE but payload type is invalid")
+	}
+
+	var name string
+	var hs *handshake
+
+	l.handshakes.Range(func(peerName string, pending *handshake) bool {
+		if pending.localIndex != payload.HandshakeResponse.Receiver {
+			return true
+		}
+
+		name = peerName
+		hs = pending
+		return false
+	})
+
+	if hs == nil {
+		return errors.New("no handshake initiated with receiver index")
+	}
+
+	b, err := hs.consumeResponse(payload.HandshakeResponse)
+	if err != nil {
+		return err
+	}
+
+	err = l.checkSessionParameters(hs, b)
+	if err != nil {
+		return err
+	}
+
+	peerId, err := l.identify(hs)
+	if err != nil {
+		return err
+	}
+
+	hs.remoteIndex = payload.HandshakeResponse.Sender
+	l.handshakes.Delete(name)
+	return l.establishSession(peerId, hs, addr)
+}
+
+// allocateIndex returns a random session index that is not in use
+func (l *listener) allocateIndex() (uint32, error) {
+	b := make([]byte, 4)
+
+	for {
+		_, err := rand.Read(b)
+		if err != nil {
+			return 0, err
+		}
+
+		index := binary.BigEndian.Uint32(b)
+
+		_, ok := l.indexToPeerId.Get(index)
+		if !ok {
+			return index, nil
+		}
+	}
+}
+
+// identify returns the configured peer name for the remote static key of the handshake,
+// unknown keys are identified by their encoded public key if the listener accepts unknown peers
+func (l *listener) identify(hs *handshake) (string, error) {
+	publicKey := base64.StdEncoding.EncodeToString(hs.remoteStatic[:])
+
+	name, ok := l.publicKeyToName.Get(hs.remoteStatic)
+	if ok {
+		id, _ := l.identities.Get(name)
+		hs.presharedKey = id.presharedKey
+		return name, nil
+	}
+
+	if !l.acceptUnknown {
+		return "", fmt.Errorf("rejected unknown public key %s", publicKey)
+	}
+
+	return publicKey, nil
+}
+
+func (l *listener) establishSession(peerId string, hs *handshake, addr *net.UDPAddr) error {
+	l.establishLock.Lock()
+	defer l.establishLock.Unlock()
+
+	if !l.alive.Load() {
+		return errors.New("listener closed")
+	}
+
+	s, err := newSession(hs)
+	if err != nil {
+		return err
+	}
+
+	l.indexToPeerId.Set(s.localIndex, peerId)
+
+	previous, ok := l.sessions.Get(peerId)
+	if ok {
+		l.indexToPeerId.Delete(previous.localIndex)
+		l.peerIdToAddress.Set(peerId, addr.String())
+		l.sessions.Set(peerId, s)
+
+		stats := previous.statistics()
+		slog.Info("renewed session", "peer", peerId, "addr", addr.String(), "received", stats.Received, "replayed", stats.Replayed, "reordered", stats.Reordered, "lost", stats.Lost)
+		return nil
+	}
+
+	peer, err := NewPeer(l, peerId, uint32(l.mtu), uint32(l.networkMTU))
+	if err != nil {
+		l.indexToPeerId.Delete(s.localIndex)
+		return err
 	}
 
+	l.peerIdToAddress.Set(peerId, addr.String())
+	l.sessions.Set(peerId, s)
+	l.incomingPackages.Set(peerId, util.NewQueue[*packet.Packet](incomingQueueSize))
+
+	slog.Info("established session", "peer", peerId, "addr", addr.String())
+
+	// unknown peers use the default port configuration
+	id, _ := l.identities.Get(peerId)
+	portConfig := id.portConfig
+	portConfig.SplitHorizon = l.splitHorizon
+
+	l.peerIdToPortId.Set(peerId, l.receiver.AddPort(peer, portConfig))
 	return nil
 }
 
-func (l *listener) ackSession(p *packet.Packet, addr *net.UDPAddr) error {
-	payload, ok := p.Payload.(*packet.Packet_AckSession)
+func (l *listener) keepalive() {
+	ticker := time.NewTicker(l.keepaliveInterval)
+	defer ticker.Stop()
+
+	for l.alive.Load() {
+		<-ticker.C
+
+		l.sessions.Range(func(peerId string, s *session) bool {
+			if time.Since(s.lastReceived()) > l.peerTimeout {
+				l.closeSession(peerId, "timeout")
+				return true
+			}
+
+			err := l.Write(peerId, &packet.Packet{
+				Type:    packet.PacketType_KEEPALIVE,
+				Payload: &packet.Packet_Keepalive{},
+			})
+			if err != nil {
+				slog.Error("failed to send keepalive", "peer", peerId, "error", err)
+			}
+
+			return true
+		})
+	}
+}
+
+// closeSession removes all state of a session and removes the port of the peer from the switch
+func (l *listener) closeSession(peerId string, reason string) {
+	addr, _ := l.peerIdToAddress.Get(peerId)
+	l.peerIdToAddress.Delete(peerId)
+
+	s, ok := l.sessions.Get(peerId)
+	if ok {
+		l.sessions.Delete(peerId)
+		l.indexToPeerId.Delete(s.localIndex)
+	}
+
+	queue, ok := l.incomingPackages.Get(peerId)
+	if ok {
+		l.incomingPackages.Delete(peerId)
+		queue.Close()
+	}
+
+	slog.Info("closed session", "peer", peerId, "addr", addr, "reason", reason)
+
+	portId, ok := l.peerIdToPortId.Get(peerId)
+	if ok {
+		l.peerIdToPortId.Delete(peerId)
+		l.receiver.RemovePort(portId)
+	}
+}
+
+func (l *listener) transport(p *packet.Packet, addr *net.UDPAddr) error {
+	payload, ok := p.Payload.(*packet.Packet_Transport)
 	if !ok {
-		return errors.New("message was ACK_SESSION but payload type is invalid")
+		return errors.New("message was TRANSPORT but payload type is invalid")
 	}
 
-	peerId := payload.AckSession.Id
+	peerId, ok := l.indexToPeerId.Get(payload.Transport.Receiver)
+	if !ok {
+		return errors.New("session not established")
+	}
 
-	l.addressToPeerId.Set(addr.String(), peerId)
-	l.peerIdToAddress.Set(peerId, addr.String())
-	l.incomingPackages.Set(peerId, util.NewQueue[*packet.Packet](512))
+	s, ok := l.sessions.Get(peerId)
+	if !ok || s.localIndex != payload.Transport.Receiver {
+		return errors.New("session not established")
+	}
+
+	inner, err := s.open(payload.Transport)
+	if err != nil {
+		return err
+	}
+
+	// the packet is authenticated, so the peer is now reachable at the address it was sent from
+	previousAddr, _ := l.peerIdToAddress.Get(peerId)
+	if previousAddr != addr.String() {
+		l.peerIdToAddress.Set(peerId, addr.String())
+		slog.Info("peer changed address", "peer", peerId, "previousAddr", previousAddr, "addr", addr.String())
+	}
+
+	if inner.Type == packet.PacketType_KEEPALIVE {
+		return nil
+	}
+
+	if inner.Type == packet.PacketType_CLOSE_SESSION {
+		l.closeSession(peerId, "closed by peer")
+		return nil
+	}
+
+	if inner.Type != packet.PacketType_FRAGMENTED_DATA {
+		return fmt.Errorf("unexpected packet type %s inside of transport packet", inner.Type.String())
+	}
+
+	queue, ok := l.incomingPackages.Get(peerId)
+	if !ok {
+		return errors.New("session not established")
+	}
+
+	// the packets of all peers are received by a single goroutine, so a congested port drops packets instead of
+	// stopping the receive of handshakes and keepalives of every peer
+	if !queue.TryAdd(inner) {
+		drops := s.dropped.Add(1)
+
+		if l.congestionLog.Allow() {
+			slog.Warn("dropped packet of congested peer port", "peer", peerId, "drops", drops)
+		}
+	}
 
-	peer := NewPeer(l, peerId, uint32(l.networkMTU))
-	l.receiver.AddPort(peer)
 	return nil
 }
 
@@ -217,7 +631,12 @@ func (l *listener) Read(peerId string) (*packet.Packet, error) {
 		return nil, errors.New("session not established")
 	}
 
-	return queue.Grab(), nil
+	p, ok := queue.Grab()
+	if !ok {
+		return nil, errors.New("session closed")
+	}
+
+	return p, nil
 }
 
 func (l *listener) Write(peerId string, packet *packet.Packet) error {
@@ -226,12 +645,22 @@ func (l *listener) Write(peerId string, packet *packet.Packet) error {
 		return errors.New("peer not found")
 	}
 
+	s, ok := l.sessions.Get(peerId)
+	if !ok {
+		return errors.New("session not established")
+	}
+
 	peerAddr, err := net.ResolveUDPAddr("udp", udpAddr)
 	if err != nil {
 		return err
 	}
 
-	b, err := proto.Marshal(packet)
+	sealed, err := s.seal(packet)
+	if err != nil {
+		return err
+	}
+
+	b, err := proto.Marshal(sealed)
 	if err != nil {
 		return err
 	}
@@ -240,7 +669,33 @@ func (l *listener) Write(peerId string, packet *packet.Packet) error {
 	return err
 }
 
+func (l *listener) Statistics(peerId string) (SessionStatistics, error) {
+	s, ok := l.sessions.Get(peerId)
+	if !ok {
+		return SessionStatistics{}, errors.New("session not established")
+	}
+
+	return s.statistics(), nil
+}
+
+// Close notifies all peers that their session is closed, removes their ports and closes the socket
 func (l *listener) Close() error {
-	l.alive = false
-	return nil
+	l.establishLock.Lock()
+	l.alive.Store(false)
+	l.establishLock.Unlock()
+
+	l.sessions.Range(func(peerId string, _ *session) bool {
+		err := l.Write(peerId, &packet.Packet{
+			Type:    packet.PacketType_CLOSE_SESSION,
+			Payload: &packet.Packet_CloseSession{},
+		})
+		if err != nil {
+			slog.Error("failed to send close session", "peer", peerId, "error", err)
+		}
+
+		l.closeSession(peerId, "shutdown")
+		return true
+	})
+
+	return l.conn.Close()
 }
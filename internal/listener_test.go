@@ -0,0 +1,371 @@
+package internal
+
+import (
+	"bytes"
+	"github.com/lucasl0st/trestle/pkg/packet"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testReceiver records the ports added and removed by a listener
+type testReceiver struct {
+	sync.Mutex
+
+	ports   map[uint]Port
+	configs map[uint]PortConfig
+	portId  uint
+}
+
+func newTestReceiver() *testReceiver {
+	return &testReceiver{ports: map[uint]Port{}, configs: map[uint]PortConfig{}}
+}
+
+func (r *testReceiver) AddPort(port Port, cfg PortConfig) uint {
+	r.Lock()
+	defer r.Unlock()
+
+	r.portId++
+	r.ports[r.portId] = port
+	r.configs[r.portId] = cfg
+	return r.portId
+}
+
+func (r *testReceiver) RemovePort(portId uint) {
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.ports, portId)
+	delete(r.configs, portId)
+}
+
+// port returns the port and configuration of a peer
+func (r *testReceiver) port(name string) (Port, PortConfig, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	for portId, port := range r.ports {
+		if port.Name() == name {
+			return port, r.configs[portId], true
+		}
+	}
+
+	return nil, PortConfig{}, false
+}
+
+// loopbackListener is a listener on a random port of the loopback interface
+type loopbackListener struct {
+	*listener
+	receiver *testReceiver
+	port     uint16
+}
+
+func newLoopbackListener(t *testing.T, key keyPair, cfg ListenerConfig) *loopbackListener {
+	t.Helper()
+
+	cfg.Hostname = "127.0.0.1"
+	cfg.PrivateKey = key.private
+	if cfg.MTU == 0 {
+		cfg.MTU = 1500
+	}
+
+	if cfg.NetworkMTU == 0 {
+		cfg.NetworkMTU = 1400
+	}
+
+	receiver := newTestReceiver()
+
+	l, err := NewListener(cfg, receiver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tl := &loopbackListener{
+		listener: l.(*listener),
+		receiver: receiver,
+		port:     uint16(l.(*listener).conn.LocalAddr().(*net.UDPAddr).Port),
+	}
+
+	go func() {
+		_ = l.Listen()
+	}()
+
+	t.Cleanup(func() {
+		_ = l.Close()
+	})
+
+	return tl
+}
+
+// testKeyPairs returns two key pairs, the first has the lower public key
+func testKeyPairs(t *testing.T) (keyPair, keyPair) {
+	a := testKeyPair(t)
+	b := testKeyPair(t)
+
+	if bytes.Compare(a.public[:], b.public[:]) > 0 {
+		return b, a
+	}
+
+	return a, b
+}
+
+// eventually fails the test if condition is not true within a second
+func eventually(t *testing.T, condition func() bool, message string) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatal(message)
+}
+
+func established(l *loopbackListener, peerId string) func() bool {
+	return func() bool {
+		_, ok := l.sessions.Get(peerId)
+		return ok
+	}
+}
+
+// testPair returns two listeners that know each other as a and b
+func testPair(t *testing.T, cfg ListenerConfig) (*loopbackListener, *loopbackListener) {
+	t.Helper()
+
+	keyA, keyB := testKeyPairs(t)
+	a := newLoopbackListener(t, keyA, cfg)
+	b := newLoopbackListener(t, keyB, cfg)
+
+	err := a.AddPeer("b", keyB.public, [KeySize]byte{}, PortConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.AddPeer("a", keyA.public, [KeySize]byte{}, PortConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a, b
+}
+
+func TestListenerSimultaneousInitiationWithLostInitiation(t *testing.T) {
+	a, b := testPair(t, ListenerConfig{})
+
+	// the initiation of a, which has the lower public key, is lost
+	unused, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer unused.Close()
+
+	err = a.initiate("b", "127.0.0.1", uint16(unused.LocalAddr().(*net.UDPAddr).Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a stays initiator while its own initiation may still be answered
+	err = b.initiate("a", "127.0.0.1", a.port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if established(a, "b")() {
+		t.Fatal("initiation of the peer with the higher key was answered during a pending initiation")
+	}
+
+	// once the initiation of a timed out the initiation of b is answered
+	pending, ok := a.handshakes.Get("b")
+	if !ok {
+		t.Fatal("initiation of a is not pending")
+	}
+
+	aged := *pending
+	aged.initiatedAt = time.Now().Add(-handshakeTimeout)
+	a.handshakes.Set("b", &aged)
+
+	err = b.initiate("a", "127.0.0.1", a.port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, established(a, "b"), "a did not establish a session")
+	eventually(t, established(b, "a"), "b did not establish a session")
+}
+
+func TestListenerHandshakeTimeoutRemovesPendingHandshake(t *testing.T) {
+	a, _ := testPair(t, ListenerConfig{})
+
+	err := a.initiate("b", "127.0.0.1", 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newConnection("127.0.0.1", 9)
+	c.state = PeerStateConnecting
+	c.attemptedAt = time.Now().Add(-handshakeTimeout)
+
+	a.maintainConnection("b", c)
+
+	if c.state != PeerStateBackingOff {
+		t.Fatalf("state is %s, expected %s", c.state, PeerStateBackingOff)
+	}
+
+	_, ok := a.handshakes.Get("b")
+	if ok {
+		t.Fatal("timed out handshake is still pending")
+	}
+}
+
+func TestListenerPeerTimeout(t *testing.T) {
+	a, b := testPair(t, ListenerConfig{KeepaliveInterval: 20 * time.Millisecond, PeerTimeout: 100 * time.Millisecond})
+
+	err := a.initiate("b", "127.0.0.1", b.port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, established(a, "b"), "a did not establish a session")
+
+	// keepalives keep idle sessions established
+	time.Sleep(250 * time.Millisecond)
+	if !established(a, "b")() || !established(b, "a")() {
+		t.Fatal("idle session timed out")
+	}
+
+	// b disappears without closing its session
+	_ = b.conn.Close()
+
+	eventually(t, func() bool {
+		return !established(a, "b")()
+	}, "session of a did not time out")
+
+	_, _, ok := a.receiver.port("b")
+	if ok {
+		t.Fatal("port of timed out peer was not removed")
+	}
+}
+
+func TestListenerCloseClosesSessions(t *testing.T) {
+	a, b := testPair(t, ListenerConfig{})
+
+	err := a.initiate("b", "127.0.0.1", b.port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, established(a, "b"), "a did not establish a session")
+	eventually(t, established(b, "a"), "b did not establish a session")
+
+	err = a.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if established(a, "b")() {
+		t.Fatal("session of a is still established after close")
+	}
+
+	_, _, ok := a.receiver.port("b")
+	if ok {
+		t.Fatal("port of b was not removed on close")
+	}
+
+	// the peer is told that the session was closed
+	eventually(t, func() bool {
+		return !established(b, "a")()
+	}, "session of b was not closed")
+
+	// sessions are not established while the listener is closed
+	err = b.initiate("a", "127.0.0.1", a.port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if established(a, "b")() {
+		t.Fatal("closed listener established a session")
+	}
+}
+
+func TestListenerRoaming(t *testing.T) {
+	a, b := testPair(t, ListenerConfig{})
+
+	err := a.initiate("b", "127.0.0.1", b.port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, established(a, "b"), "a did not establish a session")
+	eventually(t, established(b, "a"), "b did not establish a session")
+
+	s, _ := b.sessions.Get("a")
+	keepalive := func() *packet.Packet {
+		sealed, err := s.seal(&packet.Packet{Type: packet.PacketType_KEEPALIVE, Payload: &packet.Packet_Keepalive{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return sealed
+	}
+
+	roamed := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9}
+
+	// packets that fail authentication do not move the peer
+	tampered := keepalive()
+	tampered.GetTransport().Ciphertext[0] ^= 0xff
+
+	err = a.transport(tampered, roamed)
+	if err == nil {
+		t.Fatal("tampered packet was accepted")
+	}
+
+	addr, _ := a.peerIdToAddress.Get("b")
+	if addr == roamed.String() {
+		t.Fatal("tampered packet moved the peer")
+	}
+
+	// authenticated packets from a new address move the session to it
+	err = a.transport(keepalive(), roamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr, _ = a.peerIdToAddress.Get("b")
+	if addr != roamed.String() {
+		t.Fatalf("address of b is %s, expected %s", addr, roamed)
+	}
+
+	if !established(a, "b")() {
+		t.Fatal("session was closed by roaming")
+	}
+}
+
+func TestListenerSplitHorizon(t *testing.T) {
+	for _, splitHorizon := range []bool{false, true} {
+		a, b := testPair(t, ListenerConfig{SplitHorizon: splitHorizon})
+
+		err := a.initiate("b", "127.0.0.1", b.port)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		eventually(t, established(a, "b"), "a did not connect to b")
+
+		_, cfg, ok := a.receiver.port("b")
+		if !ok {
+			t.Fatal("port of b was not added")
+		}
+
+		if cfg.SplitHorizon != splitHorizon {
+			t.Fatalf("split horizon of port is %t, expected %t", cfg.SplitHorizon, splitHorizon)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+type learnResult int
+
+const (
+	learnRefreshed learnResult = iota
+	learnAdded
+	learnMoved
+	learnPortLimit
+	learnSwitchLimit
+)
+
+// macKey is a hardware address within a VLAN, the same address may be learned on different ports in different VLANs
+type macKey struct {
+	vlan uint16
+	mac  [6]byte
+}
+
+func newMacKey(vlan uint16, mac net.HardwareAddr) macKey {
+	return macKey{vlan: vlan, mac: macArray(mac)}
+}
+
+func macArray(mac net.HardwareAddr) [6]byte {
+	var a [6]byte
+	copy(a[:], mac)
+	return a
+}
+
+// randomMAC returns a random locally administered unicast hardware address
+func randomMAC() (net.HardwareAddr, error) {
+	mac := make(net.HardwareAddr, 6)
+
+	_, err := rand.Read(mac)
+	if err != nil {
+		return nil, err
+	}
+
+	mac[0] = mac[0]&0xfe | 0x02
+	return mac, nil
+}
+
+func (k macKey) String() string {
+	return fmt.Sprintf("%d/%s", k.vlan, net.HardwareAddr(k.mac[:]))
+}
+
+type macEntry struct {
+	portId   uint
+	lastSeen time.Time
+}
+
+// macTable is a thread-safe table of learned hardware addresses with per-port accounting
+type macTable struct {
+	sync.RWMutex
+
+	entries    map[macKey]macEntry
+	portCounts map[uint]int
+	maxEntries int
+}
+
+func newMacTable(maxEntries int) *macTable {
+	return &macTable{
+		entries:    map[macKey]macEntry{},
+		portCounts: map[uint]int{},
+		maxEntries: maxEntries,
+	}
+}
+
+// learn records that mac was seen on portId, a maxPortEntries of 0 means unlimited,
+// returns the previous port of the mac if it moved
+func (t *macTable) learn(mac macKey, portId uint, maxPortEntries int) (learnResult, uint) {
+	t.Lock()
+	defer t.Unlock()
+
+	now := time.Now()
+
+	entry, ok := t.entries[mac]
+	if ok && entry.portId == portId {
+		t.entries[mac] = macEntry{portId: portId, lastSeen: now}
+		return learnRefreshed, portId
+	}
+
+	if maxPortEntries > 0 && t.portCounts[portId] >= maxPortEntries {
+		return learnPortLimit, entry.portId
+	}
+
+	if !ok && t.maxEntries > 0 && len(t.entries) >= t.maxEntries {
+		return learnSwitchLimit, 0
+	}
+
+	t.entries[mac] = macEntry{portId: portId, lastSeen: now}
+	t.portCounts[portId]++
+
+	if !ok {
+		return learnAdded, portId
+	}
+
+	t.decrement(entry.portId)
+	return learnMoved, entry.portId
+}
+
+func (t *macTable) lookup(mac macKey) (uint, bool) {
+	t.RLock()
+	defer t.RUnlock()
+
+	entry, ok := t.entries[mac]
+	return entry.portId, ok
+}
+
+// removePort removes all entries learned on portId
+func (t *macTable) removePort(portId uint) {
+	t.Lock()
+	defer t.Unlock()
+
+	for mac, entry := range t.entries {
+		if entry.portId == portId {
+			delete(t.entries, mac)
+		}
+	}
+
+	delete(t.portCounts, portId)
+}
+
+// expire removes all entries not seen for longer than agingTime and returns their amount
+func (t *macTable) expire(agingTime time.Duration) int {
+	t.Lock()
+	defer t.Unlock()
+
+	expired := 0
+
+	for mac, entry := range t.entries {
+		if time.Since(entry.lastSeen) > agingTime {
+			delete(t.entries, mac)
+			t.decrement(entry.portId)
+			expired++
+		}
+	}
+
+	return expired
+}
+
+func (t *macTable) decrement(portId uint) {
+	t.portCounts[portId]--
+	if t.portCounts[portId] <= 0 {
+		delete(t.portCounts, portId)
+	}
+}
+
+func (t *macTable) size() int {
+	t.RLock()
+	defer t.RUnlock()
+
+	return len(t.entries)
+}
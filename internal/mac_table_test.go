@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMacTableLearn(t *testing.T) {
+	a := newMacKey(1, testMAC("02:00:00:00:00:0a"))
+	b := newMacKey(1, testMAC("02:00:00:00:00:0b"))
+	c := newMacKey(1, testMAC("02:00:00:00:00:0c"))
+	aInVLAN2 := newMacKey(2, testMAC("02:00:00:00:00:0a"))
+
+	type learn struct {
+		mac            macKey
+		portId         uint
+		maxPortEntries int
+
+		result       learnResult
+		previousPort uint
+	}
+
+	tests := []struct {
+		name       string
+		maxEntries int
+		learns     []learn
+	}{
+		{
+			name: "added and refreshed",
+			learns: []learn{
+				{mac: a, portId: 1, result: learnAdded, previousPort: 1},
+				{mac: a, portId: 1, result: learnRefreshed, previousPort: 1},
+			},
+		},
+		{
+			name: "moved",
+			learns: []learn{
+				{mac: a, portId: 1, result: learnAdded, previousPort: 1},
+				{mac: a, portId: 2, result: learnMoved, previousPort: 1},
+				{mac: a, portId: 2, result: learnRefreshed, previousPort: 2},
+			},
+		},
+		{
+			name: "vlans are learned separately",
+			learns: []learn{
+				{mac: a, portId: 1, result: learnAdded, previousPort: 1},
+				{mac: aInVLAN2, portId: 2, result: learnAdded, previousPort: 2},
+			},
+		},
+		{
+			name: "port limit",
+			learns: []learn{
+				{mac: a, portId: 1, maxPortEntries: 2, result: learnAdded, previousPort: 1},
+				{mac: b, portId: 1, maxPortEntries: 2, result: learnAdded, previousPort: 1},
+				{mac: c, portId: 1, maxPortEntries: 2, result: learnPortLimit},
+				{mac: a, portId: 1, maxPortEntries: 2, result: learnRefreshed, previousPort: 1},
+				{mac: c, portId: 2, maxPortEntries: 2, result: learnAdded, previousPort: 2},
+			},
+		},
+		{
+			name: "port limit stops moves to the port",
+			learns: []learn{
+				{mac: a, portId: 1, maxPortEntries: 1, result: learnAdded, previousPort: 1},
+				{mac: b, portId: 2, maxPortEntries: 1, result: learnAdded, previousPort: 2},
+				{mac: a, portId: 2, maxPortEntries: 1, result: learnPortLimit, previousPort: 1},
+			},
+		},
+		{
+			name:       "switch limit",
+			maxEntries: 2,
+			learns: []learn{
+				{mac: a, portId: 1, result: learnAdded, previousPort: 1},
+				{mac: b, portId: 2, result: learnAdded, previousPort: 2},
+				{mac: c, portId: 3, result: learnSwitchLimit},
+				{mac: a, portId: 3, result: learnMoved, previousPort: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			table := newMacTable(test.maxEntries)
+
+			for i, l := range test.learns {
+				result, previousPort := table.learn(l.mac, l.portId, l.maxPortEntries)
+				if result != l.result || previousPort != l.previousPort {
+					t.Fatalf("learn %d of %s returned %d with previous port %d, expected %d with %d", i, l.mac, result, previousPort,
+						l.result, l.previousPort)
+				}
+			}
+		})
+	}
+}
+
+func TestMacTableExpire(t *testing.T) {
+	table := newMacTable(0)
+	a := newMacKey(1, testMAC("02:00:00:00:00:0a"))
+	b := newMacKey(1, testMAC("02:00:00:00:00:0b"))
+
+	table.learn(a, 1, 1)
+	table.learn(b, 2, 1)
+
+	table.entries[a] = macEntry{portId: 1, lastSeen: time.Now().Add(-time.Minute)}
+
+	expired := table.expire(30 * time.Second)
+	if expired != 1 {
+		t.Fatalf("expired %d entries, expected 1", expired)
+	}
+
+	_, ok := table.lookup(a)
+	if ok {
+		t.Fatal("aged entry was not expired")
+	}
+
+	_, ok = table.lookup(b)
+	if !ok {
+		t.Fatal("fresh entry was expired")
+	}
+
+	// expired entries no longer count towards the port limit
+	result, _ := table.learn(newMacKey(1, testMAC("02:00:00:00:00:0c")), 1, 1)
+	if result != learnAdded {
+		t.Fatalf("learn after expiry returned %d, expected %d", result, learnAdded)
+	}
+}
+
+func TestMacTableRemovePort(t *testing.T) {
+	table := newMacTable(0)
+	a := newMacKey(1, testMAC("02:00:00:00:00:0a"))
+	b := newMacKey(1, testMAC("02:00:00:00:00:0b"))
+
+	table.learn(a, 1, 1)
+	table.learn(b, 2, 1)
+	table.removePort(1)
+
+	if table.size() != 1 {
+		t.Fatalf("table has %d entries, expected 1", table.size())
+	}
+
+	_, ok := table.lookup(a)
+	if ok {
+		t.Fatal("entry of removed port is still learned")
+	}
+
+	result, _ := table.learn(newMacKey(1, testMAC("02:00:00:00:00:0c")), 1, 1)
+	if result != learnAdded {
+		t.Fatalf("learn on re-added port returned %d, expected %d", result, learnAdded)
+	}
+}
+
+func TestRandomMAC(t *testing.T) {
+	mac, err := randomMAC()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mac[0]&0x01 != 0 || mac[0]&0x02 == 0 {
+		t.Fatalf("mac %s is not a locally administered unicast address", mac)
+	}
+}
+
+func TestSwitchMACLimit(t *testing.T) {
+	sw := newTestSwitch(t, SwitchConfig{})
+	a, b, c := newTestPort("a"), newTestPort("b"), newTestPort("c")
+	sw.AddPort(a, PortConfig{MaxMACs: 1})
+	sw.AddPort(b, PortConfig{})
+	sw.AddPort(c, PortConfig{})
+
+	a.in <- testFrame("ff:ff:ff:ff:ff:ff", "02:00:00:00:00:0a")
+	expectFrame(t, b, true)
+	expectFrame(t, c, true)
+
+	a.in <- testFrame("ff:ff:ff:ff:ff:ff", "02:00:00:00:00:0d")
+	expectFrame(t, b, true)
+	expectFrame(t, c, true)
+
+	// the learned hardware address is forwarded, the one above the limit is flooded
+	b.in <- testFrame("02:00:00:00:00:0a", "02:00:00:00:00:0b")
+	expectFrame(t, a, true)
+	expectFrame(t, c, false)
+
+	b.in <- testFrame("02:00:00:00:00:0d", "02:00:00:00:00:0b")
+	expectFrame(t, a, true)
+	expectFrame(t, c, true)
+
+	if sw.Status().MACLimitExceeded != 1 {
+		t.Fatalf("mac limit was exceeded %d times, expected 1", sw.Status().MACLimitExceeded)
+	}
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"github.com/songgao/packets/ethernet"
+	"slices"
+)
+
+type MirrorDirection string
+
+const (
+	// MirrorIngress mirrors frames received on the mirrored ports
+	MirrorIngress MirrorDirection = "ingress"
+	// MirrorEgress mirrors frames sent to the mirrored ports
+	MirrorEgress MirrorDirection = "egress"
+	// MirrorBoth mirrors frames received on and sent to the mirrored ports
+	MirrorBoth MirrorDirection = "both"
+)
+
+// MirrorConfig is a port mirroring session of a switch, the monitor port receives copies of the mirrored traffic
+// and takes no part in switching while mirroring is enabled
+type MirrorConfig struct {
+	// Enabled is whether mirroring is enabled when the switch is created
+	Enabled bool
+	// MonitorPort is the name of the port receiving the mirrored frames
+	MonitorPort string
+	// Ports are the names of the mirrored ports
+	Ports []string
+	// VLANs are the mirrored VLANs
+	VLANs []uint16
+	// Direction is the mirrored traffic direction, both if empty
+	Direction MirrorDirection
+}
+
+func (c MirrorConfig) mirrors(direction MirrorDirection) bool {
+	return c.Direction == "" || c.Direction == MirrorBoth || c.Direction == direction
+}
+
+// isMonitorPort returns whether the port is the monitor port of an enabled mirroring session
+func (e *ethernetSwitch) isMonitorPort(portId uint) bool {
+	if !e.mirroring.Load() {
+		return false
+	}
+
+	monitorPortId, ok := e.portNames.Get(e.mirror.MonitorPort)
+	return ok && monitorPortId == portId
+}
+
+// mirrorFrame sends a copy of a frame received on or sent to a port to the monitor port if the port or VLAN is mirrored
+func (e *ethernetSwitch) mirrorFrame(frame ethernet.Frame, portId uint, vlan uint16, direction MirrorDirection) {
+	if !e.mirroring.Load() || !e.mirror.mirrors(direction) {
+		return
+	}
+
+	monitorPortId, ok := e.portNames.Get(e.mirror.MonitorPort)
+	if !ok || monitorPortId == portId {
+		return
+	}
+
+	port, ok := e.ports.Get(portId)
+	if !ok {
+		return
+	}
+
+	if !slices.Contains(e.mirror.Ports, port.Name()) && !slices.Contains(e.mirror.VLANs, vlan) {
+		return
+	}
+
+	queue, ok := e.outgoingFrames.Get(monitorPortId)
+	if !ok {
+		return
+	}
+
+	queue.add(frame, 0)
+}
+
+func (e *ethernetSwitch) SetMirroring(enabled bool) {
+	if e.mirror.MonitorPort == "" {
+		return
+	}
+
+	e.mirroring.Store(enabled)
+}
+
+func (e *ethernetSwitch) Mirroring() bool {
+	return e.mirroring.Load()
+}
@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSwitchMirroring(t *testing.T) {
+	tests := []struct {
+		name   string
+		mirror MirrorConfig
+		// fromA and toA are whether the monitor port receives copies of frames received on and sent to port a
+		fromA bool
+		toA   bool
+	}{
+		{
+			name:   "ingress",
+			mirror: MirrorConfig{Ports: []string{"a"}, Direction: MirrorIngress},
+			fromA:  true,
+		},
+		{
+			name:   "egress",
+			mirror: MirrorConfig{Ports: []string{"a"}, Direction: MirrorEgress},
+			toA:    true,
+		},
+		{
+			name:   "both",
+			mirror: MirrorConfig{Ports: []string{"a"}},
+			fromA:  true,
+			toA:    true,
+		},
+		{
+			name:   "other port",
+			mirror: MirrorConfig{Ports: []string{"c"}},
+		},
+		{
+			name:   "vlan",
+			mirror: MirrorConfig{VLANs: []uint16{defaultVLAN}, Direction: MirrorIngress},
+			fromA:  true,
+			toA:    true,
+		},
+		{
+			name:   "other vlan",
+			mirror: MirrorConfig{VLANs: []uint16{10}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.mirror.Enabled = true
+			test.mirror.MonitorPort = "m"
+
+			sw := newTestSwitch(t, SwitchConfig{Mirror: test.mirror})
+			a, b, m := newTestPort("a"), newTestPort("b"), newTestPort("m")
+			sw.AddPort(a, PortConfig{})
+			sw.AddPort(b, PortConfig{})
+			sw.AddPort(m, PortConfig{})
+
+			// the monitor port takes no part in switching
+			fromA := testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0a")
+			a.in <- fromA
+			expectFrame(t, b, true)
+
+			if test.fromA && !bytes.Equal(expectFrame(t, m, true), fromA) {
+				t.Fatal("monitor port received a different frame")
+			}
+
+			expectFrame(t, m, false)
+
+			toA := testFrame("02:00:00:00:00:0a", "02:00:00:00:00:0b")
+			b.in <- toA
+			expectFrame(t, a, true)
+
+			if test.toA && !bytes.Equal(expectFrame(t, m, true), toA) {
+				t.Fatal("monitor port received a different frame")
+			}
+
+			expectFrame(t, m, false)
+
+			// frames received on the monitor port are dropped
+			m.in <- testFrame("ff:ff:ff:ff:ff:ff", "02:00:00:00:00:0c")
+			expectFrame(t, a, false)
+		})
+	}
+}
+
+func TestSwitchSetMirroring(t *testing.T) {
+	sw := newTestSwitch(t, SwitchConfig{Mirror: MirrorConfig{MonitorPort: "m", Ports: []string{"a"}}})
+	a, b, m := newTestPort("a"), newTestPort("b"), newTestPort("m")
+	sw.AddPort(a, PortConfig{})
+	sw.AddPort(b, PortConfig{})
+	sw.AddPort(m, PortConfig{})
+
+	if sw.Mirroring() {
+		t.Fatal("mirroring is enabled")
+	}
+
+	// the monitor port is a regular port while mirroring is disabled
+	b.in <- testFrame("02:00:00:00:00:0c", "02:00:00:00:00:0b")
+	expectFrame(t, a, true)
+	expectFrame(t, m, true)
+
+	sw.SetMirroring(true)
+	if !sw.Mirroring() {
+		t.Fatal("mirroring is disabled")
+	}
+
+	a.in <- testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0a")
+	expectFrame(t, b, true)
+	expectFrame(t, m, true)
+
+	b.in <- testFrame("02:00:00:00:00:0c", "02:00:00:00:00:0b")
+	expectFrame(t, a, true)
+	expectFrame(t, m, true)
+
+	// mirroring can not be enabled without monitor port
+	sw = newTestSwitch(t, SwitchConfig{Mirror: MirrorConfig{Ports: []string{"a"}}})
+	sw.SetMirroring(true)
+
+	if sw.Mirroring() {
+		t.Fatal("mirroring is enabled without monitor port")
+	}
+}
@@ -0,0 +1,397 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/songgao/packets/ethernet"
+	"log/slog"
+	"net"
+	"net/netip"
+	"time"
+)
+
+const (
+	arpSize        = 28
+	arpRequest     = 1
+	arpReply       = 2
+	arpHardwareEth = 1
+
+	icmpv6NeighborSolicitation  = 135
+	icmpv6NeighborAdvertisement = 136
+	ndOptionSourceLinkAddr      = 1
+	ndOptionTargetLinkAddr      = 2
+	ndMinSize                   = 24
+	ndFlagSolicited             = 0x40
+	ndFlagOverride              = 0x20
+	ndHopLimit                  = 255
+)
+
+// NeighborConfig is the snooping of ARP and IPv6 neighbor discovery on a switch
+type NeighborConfig struct {
+	// Inspection drops ARP and neighbor advertisement packets contradicting known bindings
+	Inspection bool
+	// Suppression answers ARP requests and neighbor solicitations of known bindings instead of flooding them
+	Suppression bool
+	// BindingTimeout is the duration after which snooped bindings that were not seen are removed, the mac aging time if 0
+	BindingTimeout time.Duration
+}
+
+// neighborPacket is an ARP or neighbor discovery packet announcing or requesting a binding
+type neighborPacket struct {
+	source BindingSource
+	// request is set for ARP requests and neighbor solicitations
+	request bool
+	// senderIP is bound to senderMAC if both are valid
+	senderIP  netip.Addr
+	senderMAC net.HardwareAddr
+	targetIP  netip.Addr
+	// gratuitous is set for packets announcing the own binding without being asked
+	gratuitous bool
+}
+
+func parseNeighborPacket(frame ethernet.Frame, info frameInfo) (neighborPacket, bool) {
+	if info.stacked {
+		return neighborPacket{}, false
+	}
+
+	switch {
+	case info.etherType == etherTypeARP:
+		return parseARP(frame[ethernetHeaderSize:])
+	case info.etherType == etherTypeIPv6 && info.protocol == ipProtocolICMPv6 && !info.extended:
+		return parseND(frame[ethernetHeaderSize:])
+	}
+
+	return neighborPacket{}, false
+}
+
+func parseARP(payload []byte) (neighborPacket, bool) {
+	if len(payload) < arpSize ||
+		binary.BigEndian.Uint16(payload[0:2]) != arpHardwareEth ||
+		binary.BigEndian.Uint16(payload[2:4]) != etherTypeIPv4 ||
+		payload[4] != 6 || payload[5] != 4 {
+		return neighborPacket{}, false
+	}
+
+	op := binary.BigEndian.Uint16(payload[6:8])
+	if op != arpRequest && op != arpReply {
+		return neighborPacket{}, false
+	}
+
+	p := neighborPacket{
+		source:    BindingSourceARP,
+		request:   op == arpRequest,
+		senderMAC: net.HardwareAddr(payload[8:14]),
+		senderIP:  netip.AddrFrom4([4]byte(payload[14:18])),
+		targetIP:  netip.AddrFrom4([4]byte(payload[24:28])),
+	}
+
+	p.gratuitous = p.senderIP == p.targetIP
+	return p, true
+}
+
+func parseND(payload []byte) (neighborPacket, bool) {
+	if len(payload) < ipv6HeaderSize+ndMinSize || payload[7] != ndHopLimit {
+		return neighborPacket{}, false
+	}
+
+	icmp := payload[ipv6HeaderSize:]
+	if icmp[0] != icmpv6NeighborSolicitation && icmp[0] != icmpv6NeighborAdvertisement || icmp[1] != 0 {
+		return neighborPacket{}, false
+	}
+
+	p := neighborPacket{
+		source:   BindingSourceND,
+		request:  icmp[0] == icmpv6NeighborSolicitation,
+		targetIP: netip.AddrFrom16([16]byte(icmp[8:24])),
+	}
+
+	linkAddrOption := byte(ndOptionTargetLinkAddr)
+	if p.request {
+		linkAddrOption = ndOptionSourceLinkAddr
+		p.senderIP = netip.AddrFrom16([16]byte(payload[8:24]))
+	} else {
+		// advertisements bind their target, unsolicited advertisements announce a binding
+		p.senderIP = p.targetIP
+		p.gratuitous = icmp[4]&ndFlagSolicited == 0
+	}
+
+	options := icmp[ndMinSize:]
+	for len(options) >= 8 && options[1] > 0 && len(options) >= int(options[1])*8 {
+		if options[0] == linkAddrOption {
+			p.senderMAC = net.HardwareAddr(options[2:8])
+		}
+
+		options = options[int(options[1])*8:]
+	}
+
+	return p, true
+}
+
+// bindable returns whether the packet announces a valid binding, probes and duplicate address detection do not
+func (p neighborPacket) bindable() bool {
+	return p.senderMAC != nil && p.senderIP.IsValid() && !p.senderIP.IsUnspecified() && !isGroupAddr(p.senderMAC)
+}
+
+// inspectNeighbors snoops bindings from ARP and neighbor discovery packets, returns false if the frame contradicts a binding and is dropped
+func (e *ethernetSwitch) inspectNeighbors(f switchFrame, sourcePortId uint) bool {
+	if !e.neighbor.Inspection && !e.neighbor.Suppression {
+		return true
+	}
+
+	p, ok := parseNeighborPacket(f.frame, f.info)
+	if !ok || !p.bindable() {
+		return true
+	}
+
+	binding, known := e.bindings.lookup(f.vlan, p.senderIP)
+
+	if known && !bytes.Equal(binding.MAC, p.senderMAC) && e.neighbor.Inspection {
+		drops := e.neighborDrops.Add(1)
+
+		if e.neighborLog.Allow() {
+			slog.Warn("dropped packet contradicting binding", "switch", e.name, "portId", sourcePortId, "port", e.portName(sourcePortId),
+				"source", p.source, "ip", p.senderIP.String(), "mac", p.senderMAC.String(), "boundMac", binding.MAC.String(),
+				"gratuitous", p.gratuitous, "drops", drops)
+		}
+
+		return false
+	}
+
+	// leases are managed by DHCP snooping, ARP and neighbor discovery never overwrite them
+	if known && binding.Source == BindingSourceDHCP {
+		return true
+	}
+
+	now := time.Now()
+	e.bindings.set(Binding{
+		VLAN:     f.vlan,
+		IP:       p.senderIP,
+		MAC:      append(net.HardwareAddr{}, p.senderMAC...),
+		PortId:   sourcePortId,
+		Source:   p.source,
+		LastSeen: now,
+		Expires:  now.Add(e.neighbor.BindingTimeout),
+	})
+
+	return true
+}
+
+// suppressNeighbors answers ARP requests and neighbor solicitations for known bindings, returns true if the frame was answered
+func (e *ethernetSwitch) suppressNeighbors(f switchFrame, sourcePortId uint, sourceCfg PortConfig) bool {
+	if !e.neighbor.Suppression {
+		return false
+	}
+
+	p, ok := parseNeighborPacket(f.frame, f.info)
+	if !ok || !p.request || p.gratuitous || p.senderMAC == nil {
+		return false
+	}
+
+	binding, ok := e.bindings.lookup(f.vlan, p.targetIP)
+	if !ok || binding.PortId == sourcePortId {
+		return false
+	}
+
+	var reply ethernet.Frame
+	switch p.source {
+	case BindingSourceARP:
+		reply = arpReplyFrame(binding.MAC, p.targetIP, p.senderMAC, p.senderIP)
+	case BindingSourceND:
+		// duplicate address detection must reach the owner of the address
+		if p.senderIP.IsUnspecified() {
+			return false
+		}
+
+		reply = neighborAdvertisementFrame(binding.MAC, p.targetIP, p.senderMAC, p.senderIP)
+	default:
+		return false
+	}
+
+	queue, ok := e.outgoingFrames.Get(sourcePortId)
+	if !ok {
+		return false
+	}
+
+	e.neighborReplies.Add(1)
+	e.enqueueFrame(switchFrame{frame: reply, vlan: f.vlan, priority: f.priority, info: parseFrame(reply)}, sourcePortId, sourceCfg, queue)
+	return true
+}
+
+func arpReplyFrame(senderMAC net.HardwareAddr, senderIP netip.Addr, targetMAC net.HardwareAddr, targetIP netip.Addr) ethernet.Frame {
+	var frame ethernet.Frame
+	frame.Prepare(targetMAC, senderMAC, ethernet.NotTagged, ethernet.ARP, arpSize)
+
+	payload := frame.Payload()
+	binary.BigEndian.PutUint16(payload[0:2], arpHardwareEth)
+	binary.BigEndian.PutUint16(payload[2:4], etherTypeIPv4)
+	payload[4] = 6
+	payload[5] = 4
+	binary.BigEndian.PutUint16(payload[6:8], arpReply)
+	copy(payload[8:14], senderMAC)
+	copy(payload[14:18], senderIP.AsSlice())
+	copy(payload[18:24], targetMAC)
+	copy(payload[24:28], targetIP.AsSlice())
+
+	return frame
+}
+
+// arpRequestFrame asks all hosts for the hardware address of targetIP
+func arpRequestFrame(senderMAC net.HardwareAddr, senderIP netip.Addr, targetIP netip.Addr) ethernet.Frame {
+	frame := arpReplyFrame(senderMAC, senderIP, make(net.HardwareAddr, 6), targetIP)
+	copy(frame.Destination(), broadcastMac)
+	binary.BigEndian.PutUint16(frame.Payload()[6:8], arpRequest)
+
+	return frame
+}
+
+// neighborSolicitationFrame asks the solicited-node multicast group of targetIP for its hardware address
+func neighborSolicitationFrame(senderMAC net.HardwareAddr, senderIP netip.Addr, targetIP netip.Addr) ethernet.Frame {
+	target := targetIP.As16()
+	group := netip.AddrFrom16([16]byte{0: 0xff, 1: 0x02, 11: 0x01, 12: 0xff, 13: target[13], 14: target[14], 15: target[15]})
+	groupMAC := net.HardwareAddr{0x33, 0x33, 0xff, target[13], target[14], target[15]}
+
+	icmp := make([]byte, ndMinSize+8)
+	icmp[0] = icmpv6NeighborSolicitation
+	copy(icmp[8:24], target[:])
+	icmp[24] = ndOptionSourceLinkAddr
+	icmp[25] = 1
+	copy(icmp[26:32], senderMAC)
+
+	return ipv6Frame(senderMAC, senderIP, groupMAC, group, ipProtocolICMPv6, ndHopLimit, icmp)
+}
+
+func neighborAdvertisementFrame(senderMAC net.HardwareAddr, senderIP netip.Addr, targetMAC net.HardwareAddr, targetIP netip.Addr) ethernet.Frame {
+	return neighborAdvertisement(senderMAC, senderIP, targetMAC, targetIP, ndFlagSolicited|ndFlagOverride)
+}
+
+// unsolicitedNeighborAdvertisementFrame announces the hardware address of ip to all nodes
+func unsolicitedNeighborAdvertisementFrame(mac net.HardwareAddr, ip netip.Addr) ethernet.Frame {
+	return neighborAdvertisement(mac, ip, allNodesMAC, allNodesIP, ndFlagOverride)
+}
+
+func neighborAdvertisement(senderMAC net.HardwareAddr, senderIP netip.Addr, targetMAC net.HardwareAddr, targetIP netip.Addr, flags byte) ethernet.Frame {
+	icmp := make([]byte, ndMinSize+8)
+	icmp[0] = icmpv6NeighborAdvertisement
+	icmp[4] = flags
+	copy(icmp[8:24], senderIP.AsSlice())
+	icmp[24] = ndOptionTargetLinkAddr
+	icmp[25] = 1
+	copy(icmp[26:32], senderMAC)
+
+	return ipv6Frame(senderMAC, senderIP, targetMAC, targetIP, ipProtocolICMPv6, ndHopLimit, icmp)
+}
+
+// ipv6Frame builds an IPv6 packet, the checksum of ICMPv6, TCP and UDP payloads is calculated
+func ipv6Frame(sourceMAC net.HardwareAddr, sourceIP netip.Addr, destinationMAC net.HardwareAddr, destinationIP netip.Addr,
+	protocol uint8, hopLimit uint8, payload []byte) ethernet.Frame {
+	var frame ethernet.Frame
+	frame.Prepare(destinationMAC, sourceMAC, ethernet.NotTagged, ethernet.IPv6, ipv6HeaderSize+len(payload))
+
+	packet := frame.Payload()
+	packet[0] = 6 << 4
+	binary.BigEndian.PutUint16(packet[4:6], uint16(len(payload)))
+	packet[6] = protocol
+	packet[7] = hopLimit
+	copy(packet[8:24], sourceIP.AsSlice())
+	copy(packet[24:40], destinationIP.AsSlice())
+	copy(packet[ipv6HeaderSize:], payload)
+
+	l4 := packet[ipv6HeaderSize:]
+
+	switch protocol {
+	case ipProtocolICMPv6:
+		binary.BigEndian.PutUint16(l4[2:4], pseudoHeaderChecksum(sourceIP, destinationIP, protocol, l4))
+	case ipProtocolTCP:
+		binary.BigEndian.PutUint16(l4[16:18], pseudoHeaderChecksum(sourceIP, destinationIP, protocol, l4))
+	case ipProtocolUDP:
+		binary.BigEndian.PutUint16(l4[6:8], udpChecksum(pseudoHeaderChecksum(sourceIP, destinationIP, protocol, l4)))
+	}
+
+	return frame
+}
+
+// ipv4Frame builds an IPv4 packet without options, the checksum of the header and of TCP and UDP payloads is calculated
+func ipv4Frame(sourceMAC net.HardwareAddr, sourceIP netip.Addr, destinationMAC net.HardwareAddr, destinationIP netip.Addr,
+	protocol uint8, ttl uint8, payload []byte) ethernet.Frame {
+	var frame ethernet.Frame
+	frame.Prepare(destinationMAC, sourceMAC, ethernet.NotTagged, ethernet.IPv4, ipv4MinHeaderSize+len(payload))
+
+	packet := frame.Payload()
+	packet[0] = 4<<4 | ipv4MinHeaderSize/4
+	binary.BigEndian.PutUint16(packet[2:4], uint16(ipv4MinHeaderSize+len(payload)))
+	packet[8] = ttl
+	packet[9] = protocol
+	copy(packet[12:16], sourceIP.AsSlice())
+	copy(packet[16:20], destinationIP.AsSlice())
+	binary.BigEndian.PutUint16(packet[10:12], checksumFold(checksumAdd(0, packet[:ipv4MinHeaderSize])))
+	copy(packet[ipv4MinHeaderSize:], payload)
+
+	l4 := packet[ipv4MinHeaderSize:]
+
+	switch protocol {
+	case ipProtocolTCP:
+		binary.BigEndian.PutUint16(l4[16:18], pseudoHeaderChecksum(sourceIP, destinationIP, protocol, l4))
+	case ipProtocolUDP:
+		binary.BigEndian.PutUint16(l4[6:8], udpChecksum(pseudoHeaderChecksum(sourceIP, destinationIP, protocol, l4)))
+	}
+
+	return frame
+}
+
+// udpDatagram builds an UDP datagram, the checksum is calculated with the IP packet
+func udpDatagram(sourcePort uint16, destinationPort uint16, payload []byte) []byte {
+	datagram := make([]byte, udpHeaderSize+len(payload))
+	binary.BigEndian.PutUint16(datagram[0:2], sourcePort)
+	binary.BigEndian.PutUint16(datagram[2:4], destinationPort)
+	binary.BigEndian.PutUint16(datagram[4:6], uint16(len(datagram)))
+	copy(datagram[udpHeaderSize:], payload)
+
+	return datagram
+}
+
+// pseudoHeaderChecksum calculates the internet checksum of a transport payload including the IP pseudo header
+func pseudoHeaderChecksum(source netip.Addr, destination netip.Addr, protocol uint8, payload []byte) uint16 {
+	var sum uint32
+
+	pseudo := append(source.AsSlice(), destination.AsSlice()...)
+	if source.Is4() {
+		pseudo = append(pseudo, 0, protocol)
+		pseudo = binary.BigEndian.AppendUint16(pseudo, uint16(len(payload)))
+	} else {
+		pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(len(payload)))
+		pseudo = append(pseudo, 0, 0, 0, protocol)
+	}
+
+	sum = checksumAdd(sum, pseudo)
+	sum = checksumAdd(sum, payload)
+	return checksumFold(sum)
+}
+
+// udpChecksum returns the checksum of an UDP datagram, a checksum of 0 means no checksum for UDP
+func udpChecksum(checksum uint16) uint16 {
+	if checksum == 0 {
+		return 0xffff
+	}
+
+	return checksum
+}
+
+func checksumAdd(sum uint32, b []byte) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+
+	return sum
+}
+
+func checksumFold(sum uint32) uint16 {
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+
+	return ^uint16(sum)
+}
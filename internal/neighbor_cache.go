@@ -0,0 +1,201 @@
+package internal
+
+import (
+	"github.com/songgao/packets/ethernet"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const (
+	// neighborCacheTimeout is the duration after which resolved hardware addresses are resolved again
+	neighborCacheTimeout = 5 * time.Minute
+	// resolveInterval is the interval ARP requests and neighbor solicitations for an unresolved neighbor are repeated in
+	resolveInterval = time.Second
+	// maxPendingPackets is the amount of packets held per unresolved neighbor
+	maxPendingPackets = 8
+	// maxCachedNeighbors is the amount of resolved and unresolved neighbors after which stale neighbors are removed
+	maxCachedNeighbors = 4096
+)
+
+type cachedNeighbor struct {
+	mac     net.HardwareAddr
+	updated time.Time
+}
+
+// pendingResolution are packets waiting for the hardware address of their neighbor
+type pendingResolution struct {
+	requested time.Time
+	packets   []pendingPacket
+}
+
+type pendingPacket struct {
+	etherType ethernet.Ethertype
+	packet    []byte
+}
+
+// neighborCache is a thread-safe cache of the hardware addresses of the neighbors on a link,
+// packets to unresolved neighbors wait for their resolution
+type neighborCache struct {
+	sync.Mutex
+
+	// ip -> resolved neighbor
+	neighbors map[netip.Addr]cachedNeighbor
+	// ip -> packets waiting for the resolution of the ip
+	pending map[netip.Addr]*pendingResolution
+}
+
+func newNeighborCache() *neighborCache {
+	return &neighborCache{
+		neighbors: map[netip.Addr]cachedNeighbor{},
+		pending:   map[netip.Addr]*pendingResolution{},
+	}
+}
+
+// learn stores the hardware address of a neighbor and returns the packets that were waiting for it
+func (c *neighborCache) learn(ip netip.Addr, mac net.HardwareAddr) []pendingPacket {
+	now := time.Now()
+
+	c.Lock()
+	defer c.Unlock()
+
+	_, known := c.neighbors[ip]
+	if !known && len(c.neighbors)+len(c.pending) >= maxCachedNeighbors && !c.prune(now) {
+		return nil
+	}
+
+	c.neighbors[ip] = cachedNeighbor{mac: append(net.HardwareAddr{}, mac...), updated: now}
+
+	pending, ok := c.pending[ip]
+	if !ok {
+		return nil
+	}
+
+	delete(c.pending, ip)
+	return pending.packets
+}
+
+// resolve returns the hardware address of a neighbor, if it is unknown the packet waits for the resolution
+// and request is set if the neighbor has to be asked for its hardware address
+func (c *neighborCache) resolve(ip netip.Addr, packet pendingPacket) (mac net.HardwareAddr, ok bool, request bool) {
+	now := time.Now()
+
+	c.Lock()
+	defer c.Unlock()
+
+	neighbor, ok := c.neighbors[ip]
+	if ok && now.Sub(neighbor.updated) < neighborCacheTimeout {
+		return neighbor.mac, true, false
+	}
+
+	pending, ok := c.pending[ip]
+	if !ok {
+		if len(c.neighbors)+len(c.pending) >= maxCachedNeighbors && !c.prune(now) {
+			return nil, false, false
+		}
+
+		pending = &pendingResolution{}
+		c.pending[ip] = pending
+	}
+
+	if len(pending.packets) < maxPendingPackets {
+		pending.packets = append(pending.packets, packet)
+	}
+
+	if now.Sub(pending.requested) < resolveInterval {
+		return nil, false, false
+	}
+
+	// packets of a previous unanswered resolution are dropped
+	if !pending.requested.IsZero() {
+		pending.packets = pending.packets[len(pending.packets)-1:]
+	}
+
+	pending.requested = now
+	return nil, false, true
+}
+
+// prune removes expired neighbors and unanswered resolutions, returns whether space was freed, the caller must hold the lock
+func (c *neighborCache) prune(now time.Time) bool {
+	pruned := false
+
+	for ip, neighbor := range c.neighbors {
+		if now.Sub(neighbor.updated) >= neighborCacheTimeout {
+			delete(c.neighbors, ip)
+			pruned = true
+		}
+	}
+
+	for ip, pending := range c.pending {
+		if now.Sub(pending.requested) >= resolveInterval {
+			delete(c.pending, ip)
+			pruned = true
+		}
+	}
+
+	return pruned
+}
+
+// isLocalAddr returns whether ip is one of the addresses or the link-local address of a link
+func isLocalAddr(addresses []netip.Prefix, linkLocal netip.Addr, ip netip.Addr) bool {
+	if ip == linkLocal {
+		return true
+	}
+
+	for _, address := range addresses {
+		if address.Addr() == ip {
+			return true
+		}
+	}
+
+	return false
+}
+
+// onLink returns whether ip is reachable on a link without next hop
+func onLink(addresses []netip.Prefix, ip netip.Addr) bool {
+	if ip.Is6() && ip.IsLinkLocalUnicast() {
+		return true
+	}
+
+	for _, address := range addresses {
+		if address.Masked().Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sourceAddr returns the address of a link used to reach ip
+func sourceAddr(addresses []netip.Prefix, linkLocal netip.Addr, ip netip.Addr) (netip.Addr, bool) {
+	for _, address := range addresses {
+		if address.Masked().Contains(ip) {
+			return address.Addr(), true
+		}
+	}
+
+	if ip.Is6() {
+		return linkLocal, true
+	}
+
+	return netip.Addr{}, false
+}
+
+// resolutionFrame asks for the hardware address of an IPv4 or IPv6 neighbor
+func resolutionFrame(sourceMAC net.HardwareAddr, sourceIP netip.Addr, targetIP netip.Addr) ethernet.Frame {
+	if targetIP.Is4() {
+		return arpRequestFrame(sourceMAC, sourceIP, targetIP)
+	}
+
+	return neighborSolicitationFrame(sourceMAC, sourceIP, targetIP)
+}
+
+// packetFrame wraps an IP packet into an untagged frame
+func packetFrame(destination net.HardwareAddr, source net.HardwareAddr, etherType ethernet.Ethertype, packet []byte) ethernet.Frame {
+	var frame ethernet.Frame
+	frame.Prepare(destination, source, ethernet.NotTagged, etherType, len(packet))
+	copy(frame.Payload(), packet)
+
+	return frame
+}
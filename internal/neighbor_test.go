@@ -0,0 +1,216 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/songgao/packets/ethernet"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func TestParseNeighborPacket(t *testing.T) {
+	macA := testMAC("02:00:00:00:00:0a")
+	macB := testMAC("02:00:00:00:00:0b")
+	ipA := netip.MustParseAddr("10.0.0.10")
+	ipB := netip.MustParseAddr("10.0.0.11")
+	ip6A := netip.MustParseAddr("2001:db8::a")
+	ip6B := netip.MustParseAddr("2001:db8::b")
+
+	tests := []struct {
+		name     string
+		frame    ethernet.Frame
+		parsed   bool
+		expected neighborPacket
+		bindable bool
+	}{
+		{
+			name:     "arp request",
+			frame:    arpRequestFrame(macA, ipA, ipB),
+			parsed:   true,
+			expected: neighborPacket{source: BindingSourceARP, request: true, senderIP: ipA, senderMAC: macA, targetIP: ipB},
+			bindable: true,
+		},
+		{
+			name:     "arp reply",
+			frame:    arpReplyFrame(macB, ipB, macA, ipA),
+			parsed:   true,
+			expected: neighborPacket{source: BindingSourceARP, senderIP: ipB, senderMAC: macB, targetIP: ipA},
+			bindable: true,
+		},
+		{
+			name:     "gratuitous arp",
+			frame:    arpRequestFrame(macA, ipA, ipA),
+			parsed:   true,
+			expected: neighborPacket{source: BindingSourceARP, request: true, senderIP: ipA, senderMAC: macA, targetIP: ipA, gratuitous: true},
+			bindable: true,
+		},
+		{
+			name:     "arp probe",
+			frame:    arpRequestFrame(macA, netip.IPv4Unspecified(), ipA),
+			parsed:   true,
+			expected: neighborPacket{source: BindingSourceARP, request: true, senderIP: netip.IPv4Unspecified(), senderMAC: macA, targetIP: ipA},
+		},
+		{
+			name:  "truncated arp",
+			frame: arpRequestFrame(macA, ipA, ipB)[:ethernetHeaderSize+arpSize-1],
+		},
+		{
+			name:     "neighbor solicitation",
+			frame:    neighborSolicitationFrame(macA, ip6A, ip6B),
+			parsed:   true,
+			expected: neighborPacket{source: BindingSourceND, request: true, senderIP: ip6A, senderMAC: macA, targetIP: ip6B},
+			bindable: true,
+		},
+		{
+			name:     "duplicate address detection",
+			frame:    neighborSolicitationFrame(macA, netip.IPv6Unspecified(), ip6A),
+			parsed:   true,
+			expected: neighborPacket{source: BindingSourceND, request: true, senderIP: netip.IPv6Unspecified(), senderMAC: macA, targetIP: ip6A},
+		},
+		{
+			name:     "neighbor advertisement",
+			frame:    neighborAdvertisementFrame(macB, ip6B, macA, ip6A),
+			parsed:   true,
+			expected: neighborPacket{source: BindingSourceND, senderIP: ip6B, senderMAC: macB, targetIP: ip6B},
+			bindable: true,
+		},
+		{
+			name: "hop limit below 255",
+			frame: func() ethernet.Frame {
+				frame := neighborSolicitationFrame(macA, ip6A, ip6B)
+				frame[ethernetHeaderSize+7] = 64
+				return frame
+			}(),
+		},
+		{
+			name:  "other ip packet",
+			frame: testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0a"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, ok := parseNeighborPacket(test.frame, parseFrame(test.frame))
+			if ok != test.parsed {
+				t.Fatalf("parsed is %t, expected %t", ok, test.parsed)
+			}
+
+			if !ok {
+				return
+			}
+
+			if p.source != test.expected.source || p.request != test.expected.request || p.gratuitous != test.expected.gratuitous ||
+				p.senderIP != test.expected.senderIP || p.targetIP != test.expected.targetIP || !bytes.Equal(p.senderMAC, test.expected.senderMAC) {
+				t.Fatalf("parsed %+v, expected %+v", p, test.expected)
+			}
+
+			if p.bindable() != test.bindable {
+				t.Fatalf("bindable is %t, expected %t", p.bindable(), test.bindable)
+			}
+		})
+	}
+}
+
+func TestSwitchNeighborInspection(t *testing.T) {
+	sw := newTestSwitch(t, SwitchConfig{Neighbor: NeighborConfig{Inspection: true}})
+	a, b := newTestPort("a"), newTestPort("b")
+	sw.AddPort(a, PortConfig{})
+	sw.AddPort(b, PortConfig{})
+
+	ip := netip.MustParseAddr("10.0.0.10")
+
+	a.in <- arpRequestFrame(testMAC("02:00:00:00:00:0a"), ip, ip)
+	expectFrame(t, b, true)
+
+	// b claims the address bound to a
+	b.in <- arpRequestFrame(testMAC("02:00:00:00:00:0b"), ip, ip)
+	expectFrame(t, a, false)
+
+	status := sw.Status()
+	if status.Bindings != 1 || status.NeighborDrops != 1 {
+		t.Fatalf("switch has %d bindings and %d drops, expected 1 binding and 1 drop", status.Bindings, status.NeighborDrops)
+	}
+}
+
+func TestSwitchNeighborSuppression(t *testing.T) {
+	tests := []struct {
+		name    string
+		request func(mac net.HardwareAddr) ethernet.Frame
+		// announce binds the address of port a
+		announce ethernet.Frame
+	}{
+		{
+			name: "arp",
+			request: func(mac net.HardwareAddr) ethernet.Frame {
+				return arpRequestFrame(mac, netip.MustParseAddr("10.0.0.11"), netip.MustParseAddr("10.0.0.10"))
+			},
+			announce: arpRequestFrame(testMAC("02:00:00:00:00:0a"), netip.MustParseAddr("10.0.0.10"), netip.MustParseAddr("10.0.0.10")),
+		},
+		{
+			name: "neighbor discovery",
+			request: func(mac net.HardwareAddr) ethernet.Frame {
+				return neighborSolicitationFrame(mac, netip.MustParseAddr("2001:db8::b"), netip.MustParseAddr("2001:db8::a"))
+			},
+			announce: unsolicitedNeighborAdvertisementFrame(testMAC("02:00:00:00:00:0a"), netip.MustParseAddr("2001:db8::a")),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sw := newTestSwitch(t, SwitchConfig{Neighbor: NeighborConfig{Suppression: true}})
+			a, b := newTestPort("a"), newTestPort("b")
+			sw.AddPort(a, PortConfig{})
+			sw.AddPort(b, PortConfig{})
+
+			a.in <- test.announce
+			expectFrame(t, b, true)
+
+			// the switch answers the request instead of flooding it
+			b.in <- test.request(testMAC("02:00:00:00:00:0b"))
+
+			reply := expectFrame(t, b, true)
+			if !bytes.Equal(reply.Destination(), testMAC("02:00:00:00:00:0b")) {
+				t.Fatalf("reply is sent to %s", reply.Destination())
+			}
+
+			p, ok := parseNeighborPacket(reply, parseFrame(reply))
+			if !ok || p.request || !bytes.Equal(p.senderMAC, testMAC("02:00:00:00:00:0a")) {
+				t.Fatalf("reply %+v does not bind the address to a", p)
+			}
+
+			expectFrame(t, a, false)
+
+			if sw.Status().NeighborReplies != 1 {
+				t.Fatalf("switch answered %d requests, expected 1", sw.Status().NeighborReplies)
+			}
+		})
+	}
+}
+
+func TestUnsolicitedNeighborAdvertisement(t *testing.T) {
+	mac := testMAC("02:00:00:00:00:0a")
+	ip := netip.MustParseAddr("2001:db8::a")
+
+	frame := unsolicitedNeighborAdvertisementFrame(mac, ip)
+	if !bytes.Equal(frame.Destination(), allNodesMAC) {
+		t.Fatalf("advertisement is sent to %s, expected all nodes", frame.Destination())
+	}
+
+	p, ok := parseNeighborPacket(frame, parseFrame(frame))
+	if !ok {
+		t.Fatal("failed to parse advertisement")
+	}
+
+	if p.request || !p.gratuitous || p.senderIP != ip || !bytes.Equal(p.senderMAC, mac) {
+		t.Fatalf("parsed advertisement %+v", p)
+	}
+
+	icmp := append([]byte{}, frame[ethernetHeaderSize+ipv6HeaderSize:]...)
+	checksum := binary.BigEndian.Uint16(icmp[2:4])
+	binary.BigEndian.PutUint16(icmp[2:4], 0)
+
+	if checksum != pseudoHeaderChecksum(ip, allNodesIP, ipProtocolICMPv6, icmp) {
+		t.Fatal("checksum is invalid")
+	}
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/songgao/packets/ethernet"
+	"sync"
+)
+
+const patchQueueSize = 512
+
+// VLANTranslation translates the VLAN Local of a switch to the VLAN Remote carried by a patch
+type VLANTranslation struct {
+	Local  uint16
+	Remote uint16
+}
+
+// PatchConfig is one end of a patch
+type PatchConfig struct {
+	Name string
+	// VLANTranslation is applied to tagged frames, frames sent to the patch are translated from local to remote
+	// and frames received from the patch from remote to local
+	VLANTranslation []VLANTranslation
+}
+
+// patchPort is one end of a patch, frames written to it are read from the other end
+type patchPort struct {
+	name string
+	// local vlan -> remote vlan
+	egress map[uint16]uint16
+	// remote vlan -> local vlan
+	ingress map[uint16]uint16
+
+	peer   *patchPort
+	frames chan ethernet.Frame
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewPatch returns two connected ports to interconnect switches in-process
+func NewPatch(a PatchConfig, b PatchConfig) (Port, Port) {
+	endA := newPatchPort(a)
+	endB := newPatchPort(b)
+
+	endA.peer = endB
+	endB.peer = endA
+
+	return endA, endB
+}
+
+func newPatchPort(cfg PatchConfig) *patchPort {
+	p := &patchPort{
+		name:    cfg.Name,
+		egress:  map[uint16]uint16{},
+		ingress: map[uint16]uint16{},
+		frames:  make(chan ethernet.Frame, patchQueueSize),
+		done:    make(chan struct{}),
+	}
+
+	for _, t := range cfg.VLANTranslation {
+		p.egress[t.Local] = t.Remote
+		p.ingress[t.Remote] = t.Local
+	}
+
+	return p
+}
+
+func (p *patchPort) Name() string {
+	return p.name
+}
+
+// Write sends a frame to the other end, it blocks while the other end is congested so the egress queue of the switch drops frames
+func (p *patchPort) Write(frame ethernet.Frame) error {
+	frame = translateVLAN(frame, p.egress)
+	frame = translateVLAN(frame, p.peer.ingress)
+
+	// a select with a free slot in the queue may pick it even though the patch is closed
+	select {
+	case <-p.peer.done:
+		return errors.New("patch peer closed")
+	case <-p.done:
+		return errors.New("patch closed")
+	default:
+	}
+
+	select {
+	case p.peer.frames <- frame:
+		return nil
+	case <-p.peer.done:
+		return errors.New("patch peer closed")
+	case <-p.done:
+		return errors.New("patch closed")
+	}
+}
+
+func (p *patchPort) Read() (ethernet.Frame, error) {
+	select {
+	case frame := <-p.frames:
+		return frame, nil
+	case <-p.done:
+		return nil, errors.New("patch closed")
+	case <-p.peer.done:
+		return nil, errors.New("patch peer closed")
+	}
+}
+
+func (p *patchPort) Close() error {
+	p.once.Do(func() {
+		close(p.done)
+	})
+
+	return nil
+}
+
+// translateVLAN returns a copy of a tagged frame with its VLAN translated, other frames are returned unchanged
+func translateVLAN(frame ethernet.Frame, translation map[uint16]uint16) ethernet.Frame {
+	if len(translation) == 0 || len(frame) < ethernetHeaderSize+vlanTagSize || binary.BigEndian.Uint16(frame[12:14]) != vlanTPID {
+		return frame
+	}
+
+	tci := binary.BigEndian.Uint16(frame[14:16])
+
+	vlan, ok := translation[tci&0x0fff]
+	if !ok {
+		return frame
+	}
+
+	translated := append(ethernet.Frame{}, frame...)
+	binary.BigEndian.PutUint16(translated[14:16], tci&0xf000|vlan)
+
+	return translated
+}
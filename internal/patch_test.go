@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"bytes"
+	"github.com/songgao/packets/ethernet"
+	"testing"
+)
+
+func TestTranslateVLAN(t *testing.T) {
+	frame := testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0a")
+	translation := map[uint16]uint16{10: 100}
+
+	tests := []struct {
+		name        string
+		frame       ethernet.Frame
+		translation map[uint16]uint16
+		expected    ethernet.Frame
+	}{
+		{name: "translated", frame: tagFrame(frame, 10, 5), translation: translation, expected: tagFrame(frame, 100, 5)},
+		{name: "other vlan", frame: tagFrame(frame, 20, 5), translation: translation, expected: tagFrame(frame, 20, 5)},
+		{name: "untagged", frame: frame, translation: translation, expected: frame},
+		{name: "no translation", frame: tagFrame(frame, 10, 5), expected: tagFrame(frame, 10, 5)},
+		{name: "truncated", frame: tagFrame(frame, 10, 5)[:ethernetHeaderSize], translation: translation, expected: tagFrame(frame, 10, 5)[:ethernetHeaderSize]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := append(ethernet.Frame{}, test.frame...)
+
+			translated := translateVLAN(test.frame, test.translation)
+			if !bytes.Equal(translated, test.expected) {
+				t.Fatalf("translated frame is %x, expected %x", []byte(translated), []byte(test.expected))
+			}
+
+			// the frame may be shared with other ports
+			if !bytes.Equal(test.frame, original) {
+				t.Fatal("original frame was changed")
+			}
+		})
+	}
+}
+
+func TestPatch(t *testing.T) {
+	a, b := NewPatch(
+		PatchConfig{Name: "to-b", VLANTranslation: []VLANTranslation{{Local: 10, Remote: 100}}},
+		PatchConfig{Name: "to-a", VLANTranslation: []VLANTranslation{{Local: 20, Remote: 100}}},
+	)
+
+	frame := testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0a")
+
+	tests := []struct {
+		name     string
+		from     Port
+		to       Port
+		frame    ethernet.Frame
+		expected ethernet.Frame
+	}{
+		{name: "a to b", from: a, to: b, frame: tagFrame(frame, 10, 0), expected: tagFrame(frame, 20, 0)},
+		{name: "b to a", from: b, to: a, frame: tagFrame(frame, 20, 3), expected: tagFrame(frame, 10, 3)},
+		{name: "untranslated vlan", from: a, to: b, frame: tagFrame(frame, 30, 0), expected: tagFrame(frame, 30, 0)},
+		{name: "untagged", from: b, to: a, frame: frame, expected: frame},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.from.Write(test.frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			received, err := test.to.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(received, test.expected) {
+				t.Fatalf("%s read %x, expected %x", test.to.Name(), []byte(received), []byte(test.expected))
+			}
+		})
+	}
+
+	// closing one end closes the patch for both ends
+	_ = a.Close()
+
+	_, err := b.Read()
+	if err == nil {
+		t.Fatal("read from closed patch")
+	}
+
+	err = b.Write(frame)
+	if err == nil {
+		t.Fatal("wrote to closed patch")
+	}
+}
+
+func TestSwitchPatch(t *testing.T) {
+	swA := newTestSwitch(t, SwitchConfig{Name: "a"})
+	swB := newTestSwitch(t, SwitchConfig{Name: "b"})
+
+	hostA, hostB := newTestPort("host-a"), newTestPort("host-b")
+	swA.AddPort(hostA, PortConfig{PVID: 10})
+	swB.AddPort(hostB, PortConfig{PVID: 20})
+
+	// VLAN 10 of switch a and VLAN 20 of switch b are carried as VLAN 100 on the patch
+	patchA, patchB := NewPatch(
+		PatchConfig{Name: "to-b", VLANTranslation: []VLANTranslation{{Local: 10, Remote: 100}}},
+		PatchConfig{Name: "to-a", VLANTranslation: []VLANTranslation{{Local: 20, Remote: 100}}},
+	)
+
+	swA.AddPort(patchA, PortConfig{VLANMode: VLANModeTrunk})
+	swB.AddPort(patchB, PortConfig{VLANMode: VLANModeTrunk})
+
+	fromA := testFrame("ff:ff:ff:ff:ff:ff", "02:00:00:00:00:0a")
+	hostA.in <- fromA
+	if !bytes.Equal(expectFrame(t, hostB, true), fromA) {
+		t.Fatal("host b received a different frame")
+	}
+
+	fromB := testFrame("02:00:00:00:00:0a", "02:00:00:00:00:0b")
+	hostB.in <- fromB
+	if !bytes.Equal(expectFrame(t, hostA, true), fromB) {
+		t.Fatal("host a received a different frame")
+	}
+}
@@ -1,23 +1,50 @@
 package internal
 
 import (
+	"errors"
+	"fmt"
 	"github.com/lucasl0st/trestle/internal/util"
 	"github.com/lucasl0st/trestle/pkg/packet"
 	"github.com/songgao/packets/ethernet"
 	"google.golang.org/protobuf/proto"
 	"log/slog"
 	"math"
-	"sort"
+	"sync"
+	"time"
 )
 
+// ethernet header with a single 802.1Q tag
+const maxFrameHeaderSize = 18
+
+const reassemblyTimeout = 5 * time.Second
+const maxReassemblyFrames = 64
+const maxReassemblyBytes = 4 * 1024 * 1024
+
 type peer struct {
 	listener Listener
 	id       string
 
-	maxPayloadSize    int
-	fragmentedPackets *util.SafeMap[uint32, []*packet.Packet]
+	maxPayloadSize int
+	maxFrameSize   int
+	maxFragments   uint32
+
+	// reassemblyLock guards the reassembly state, incomplete frames are expired concurrently to Read
+	reassemblyLock    sync.Mutex
+	fragmentedPackets *util.SafeMap[uint32, *reassembly]
+	reassemblyBytes   int
 
 	packedId uint32
+
+	done chan struct{}
+	once sync.Once
+}
+
+// reassembly is a partially received frame
+type reassembly struct {
+	fragments [][]byte
+	received  uint32
+	size      int
+	createdAt time.Time
 }
 
 func maxPayloadSize(networkMTU uint32) int {
@@ -28,6 +55,7 @@ func maxPayloadSize(networkMTU uint32) int {
 				Id:          math.MaxInt32,
 				Fragment:    math.MaxInt32,
 				FragmentMax: math.MaxInt32,
+				Payload:     make([]byte, networkMTU),
 			},
 		},
 	}
@@ -37,19 +65,36 @@ func maxPayloadSize(networkMTU uint32) int {
 		panic(err)
 	}
 
-	return int(networkMTU - uint32(len(b)))
+	fragmentOverhead := len(b) - int(networkMTU)
+	return int(networkMTU) - fragmentOverhead - transportOverhead(networkMTU)
 }
 
-func NewPeer(listener Listener, id string, networkMTU uint32) Port {
+func NewPeer(listener Listener, id string, mtu uint32, networkMTU uint32) (Port, error) {
 	maxPayloadSize := maxPayloadSize(networkMTU)
-	slog.Info("calculated max payload size", "size", maxPayloadSize)
+	if maxPayloadSize <= 0 {
+		return nil, fmt.Errorf("network mtu %d leaves no room for the payload of fragments", networkMTU)
+	}
 
-	return &peer{
+	maxFrameSize := int(mtu) + maxFrameHeaderSize
+	slog.Info("calculated max payload size", "peer", id, "size", maxPayloadSize)
+
+	p := &peer{
 		listener:          listener,
 		id:                id,
 		maxPayloadSize:    maxPayloadSize,
-		fragmentedPackets: util.NewSafeMap[uint32, []*packet.Packet](),
+		maxFrameSize:      maxFrameSize,
+		maxFragments:      uint32((maxFrameSize + maxPayloadSize - 1) / maxPayloadSize),
+		fragmentedPackets: util.NewSafeMap[uint32, *reassembly](),
+		done:              make(chan struct{}),
 	}
+
+	go p.expireFragments()
+
+	return p, nil
+}
+
+func (p *peer) Name() string {
+	return p.id
 }
 
 func (p *peer) Write(frame ethernet.Frame) error {
@@ -66,22 +111,28 @@ func (p *peer) Write(frame ethernet.Frame) error {
 }
 
 func (p *peer) Read() (ethernet.Frame, error) {
-	pack, err := p.listener.Read(p.id)
-	if err != nil {
-		return nil, err
-	}
+	for {
+		pack, err := p.listener.Read(p.id)
+		if err != nil {
+			return nil, err
+		}
 
-	payload := pack.Payload.(*packet.Packet_FragmentedData)
-	fragments, _ := p.fragmentedPackets.Get(payload.FragmentedData.Id)
-	fragments = append(fragments, pack)
-	p.fragmentedPackets.Set(payload.FragmentedData.Id, fragments)
+		payload, ok := pack.Payload.(*packet.Packet_FragmentedData)
+		if !ok {
+			slog.Debug("dropped packet without fragmented data", "peer", p.id, "type", pack.Type.String())
+			continue
+		}
 
-	frame := p.findCompleteFrame()
-	if frame == nil {
-		return p.Read()
-	}
+		frame, err := p.addFragment(payload.FragmentedData)
+		if err != nil {
+			slog.Debug("dropped fragment", "peer", p.id, "id", payload.FragmentedData.Id, "error", err)
+			continue
+		}
 
-	return frame, nil
+		if frame != nil {
+			return frame, nil
+		}
+	}
 }
 
 func (p *peer) fragment(frame ethernet.Frame) []*packet.Packet {
@@ -119,49 +170,137 @@ func (p *peer) fragment(frame ethernet.Frame) []*packet.Packet {
 	return fragments
 }
 
-func (p *peer) findCompleteFrame() ethernet.Frame {
-	var toDeFragment []*packet.Packet
-	toDeFragmentPacketid := uint32(0)
+// addFragment adds a fragment to its frame, returns the frame once all fragments are received
+func (p *peer) addFragment(fragment *packet.FragmentedData) (ethernet.Frame, error) {
+	p.reassemblyLock.Lock()
+	defer p.reassemblyLock.Unlock()
 
-	p.fragmentedPackets.Range(func(packetId uint32, fragments []*packet.Packet) bool {
-		if len(fragments) == 0 {
-			return true
-		}
+	if fragment.FragmentMax == 0 || fragment.FragmentMax > p.maxFragments {
+		return nil, fmt.Errorf("fragment max %d is not in range of 1 to %d", fragment.FragmentMax, p.maxFragments)
+	}
 
-		if uint32(len(fragments)) >= fragments[0].Payload.(*packet.Packet_FragmentedData).FragmentedData.FragmentMax {
-			toDeFragment = fragments
-			toDeFragmentPacketid = packetId
-			return false
+	if fragment.Fragment >= fragment.FragmentMax {
+		return nil, fmt.Errorf("fragment %d is not lower than fragment max %d", fragment.Fragment, fragment.FragmentMax)
+	}
+
+	if len(fragment.Payload) > p.maxPayloadSize {
+		return nil, fmt.Errorf("fragment payload size %d exceeds max payload size %d", len(fragment.Payload), p.maxPayloadSize)
+	}
+
+	r, ok := p.fragmentedPackets.Get(fragment.Id)
+	if !ok {
+		p.makeRoom(len(fragment.Payload))
+
+		r = &reassembly{
+			fragments: make([][]byte, fragment.FragmentMax),
+			createdAt: time.Now(),
 		}
 
-		return true
-	})
+		p.fragmentedPackets.Set(fragment.Id, r)
+	}
 
-	if toDeFragment == nil {
-		return nil
+	if uint32(len(r.fragments)) != fragment.FragmentMax {
+		p.dropFrame(fragment.Id, r)
+		return nil, errors.New("fragment max is inconsistent with earlier fragments")
 	}
 
-	return p.deFragmentFrame(toDeFragmentPacketid, toDeFragment)
+	if r.fragments[fragment.Fragment] != nil {
+		return nil, errors.New("duplicate fragment")
+	}
+
+	if r.size+len(fragment.Payload) > p.maxFrameSize {
+		p.dropFrame(fragment.Id, r)
+		return nil, fmt.Errorf("frame exceeds max frame size %d", p.maxFrameSize)
+	}
+
+	r.fragments[fragment.Fragment] = fragment.Payload
+	r.received++
+	r.size += len(fragment.Payload)
+	p.reassemblyBytes += len(fragment.Payload)
+
+	if r.received < fragment.FragmentMax {
+		return nil, nil
+	}
+
+	p.dropFrame(fragment.Id, r)
+
+	frame := make(ethernet.Frame, 0, r.size)
+	for _, payload := range r.fragments {
+		frame = append(frame, payload...)
+	}
+
+	return frame, nil
 }
 
-func (p *peer) deFragmentFrame(packetId uint32, fragments []*packet.Packet) ethernet.Frame {
-	sort.Slice(fragments, func(i, j int) bool {
-		a := fragments[i].Payload.(*packet.Packet_FragmentedData)
-		b := fragments[j].Payload.(*packet.Packet_FragmentedData)
+// makeRoom drops the oldest incomplete frames until a new frame fits into the reassembly limits, the caller must hold the lock
+func (p *peer) makeRoom(size int) {
+	for {
+		frames := p.fragmentedPackets.Keys()
+		if len(frames) < maxReassemblyFrames && p.reassemblyBytes+size <= maxReassemblyBytes {
+			return
+		}
 
-		return a.FragmentedData.Fragment < b.FragmentedData.Fragment
-	})
+		var oldestId uint32
+		var oldest *reassembly
 
-	var frame ethernet.Frame
+		for _, id := range frames {
+			r, _ := p.fragmentedPackets.Get(id)
+			if oldest == nil || r.createdAt.Before(oldest.createdAt) {
+				oldestId = id
+				oldest = r
+			}
+		}
 
-	for _, fragment := range fragments {
-		frame = append(frame, fragment.Payload.(*packet.Packet_FragmentedData).FragmentedData.Payload...)
+		if oldest == nil {
+			return
+		}
+
+		slog.Debug("dropped incomplete frame to stay in reassembly limits", "peer", p.id, "id", oldestId)
+		p.dropFrame(oldestId, oldest)
+	}
+}
+
+// expireFragments drops incomplete frames older than the reassembly timeout until the peer is closed,
+// so an idle peer does not hold incomplete frames
+func (p *peer) expireFragments() {
+	ticker := time.NewTicker(reassemblyTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		p.dropExpiredFrames(time.Now())
 	}
+}
+
+// dropExpiredFrames drops incomplete frames older than the reassembly timeout
+func (p *peer) dropExpiredFrames(now time.Time) {
+	p.reassemblyLock.Lock()
+	defer p.reassemblyLock.Unlock()
 
-	p.fragmentedPackets.Delete(packetId)
-	return frame
+	p.fragmentedPackets.Range(func(id uint32, r *reassembly) bool {
+		if now.Sub(r.createdAt) > reassemblyTimeout {
+			slog.Debug("dropped incomplete frame after reassembly timeout", "peer", p.id, "id", id)
+			p.dropFrame(id, r)
+		}
+
+		return true
+	})
+}
+
+func (p *peer) dropFrame(id uint32, r *reassembly) {
+	p.fragmentedPackets.Delete(id)
+	p.reassemblyBytes -= r.size
 }
 
 func (p *peer) Close() error {
+	p.once.Do(func() {
+		close(p.done)
+	})
+
 	return nil
 }
@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"bytes"
+	"github.com/lucasl0st/trestle/pkg/packet"
+	"github.com/songgao/packets/ethernet"
+	"testing"
+	"time"
+)
+
+func newTestPeer(t *testing.T) *peer {
+	t.Helper()
+
+	p, err := NewPeer(nil, "b", 1500, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = p.Close()
+	})
+
+	return p.(*peer)
+}
+
+// testFragments returns the fragmented data of a frame of size bytes
+func testFragments(p *peer, size int) (ethernet.Frame, []*packet.FragmentedData) {
+	frame := make(ethernet.Frame, size)
+	for i := range frame {
+		frame[i] = byte(i)
+	}
+
+	var fragments []*packet.FragmentedData
+	for _, fragment := range p.fragment(frame) {
+		fragments = append(fragments, fragment.GetFragmentedData())
+	}
+
+	return frame, fragments
+}
+
+func TestNewPeerRejectsSmallNetworkMTU(t *testing.T) {
+	_, err := NewPeer(nil, "b", 1500, 40)
+	if err == nil {
+		t.Fatal("created peer without room for fragment payloads")
+	}
+}
+
+func TestPeerReassembly(t *testing.T) {
+	p := newTestPeer(t)
+	frame, fragments := testFragments(p, 1500)
+
+	if len(fragments) < 2 {
+		t.Fatalf("frame was split into %d fragments, expected at least 2", len(fragments))
+	}
+
+	// fragments may arrive in any order
+	for i := len(fragments) - 1; i >= 0; i-- {
+		reassembled, err := p.addFragment(fragments[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i > 0 && reassembled != nil {
+			t.Fatal("frame was reassembled before all fragments arrived")
+		}
+
+		if i == 0 && !bytes.Equal(reassembled, frame) {
+			t.Fatal("reassembled frame differs from the sent frame")
+		}
+	}
+
+	if len(p.fragmentedPackets.Keys()) != 0 || p.reassemblyBytes != 0 {
+		t.Fatalf("%d frames with %d bytes are left after reassembly", len(p.fragmentedPackets.Keys()), p.reassemblyBytes)
+	}
+}
+
+func TestPeerAddFragmentLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		fragment func(p *peer) *packet.FragmentedData
+	}{
+		{
+			name: "fragment max 0",
+			fragment: func(p *peer) *packet.FragmentedData {
+				return &packet.FragmentedData{Id: 1, FragmentMax: 0}
+			},
+		},
+		{
+			name: "fragment max above frame size",
+			fragment: func(p *peer) *packet.FragmentedData {
+				return &packet.FragmentedData{Id: 1, FragmentMax: p.maxFragments + 1}
+			},
+		},
+		{
+			name: "fragment out of range",
+			fragment: func(p *peer) *packet.FragmentedData {
+				return &packet.FragmentedData{Id: 1, Fragment: 2, FragmentMax: 2}
+			},
+		},
+		{
+			name: "payload above max payload size",
+			fragment: func(p *peer) *packet.FragmentedData {
+				return &packet.FragmentedData{Id: 1, FragmentMax: 2, Payload: make([]byte, p.maxPayloadSize+1)}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestPeer(t)
+
+			_, err := p.addFragment(test.fragment(p))
+			if err == nil {
+				t.Fatal("invalid fragment was accepted")
+			}
+
+			if len(p.fragmentedPackets.Keys()) != 0 {
+				t.Fatal("invalid fragment started a reassembly")
+			}
+		})
+	}
+}
+
+func TestPeerAddFragmentDropsInconsistentFrames(t *testing.T) {
+	tests := []struct {
+		name   string
+		second func(p *peer) *packet.FragmentedData
+		kept   bool
+	}{
+		{
+			name: "inconsistent fragment max",
+			second: func(p *peer) *packet.FragmentedData {
+				return &packet.FragmentedData{Id: 1, Fragment: 1, FragmentMax: 3, Payload: []byte{1}}
+			},
+		},
+		{
+			name: "duplicate fragment",
+			second: func(p *peer) *packet.FragmentedData {
+				return &packet.FragmentedData{Id: 1, Fragment: 0, FragmentMax: 2, Payload: []byte{1}}
+			},
+			kept: true,
+		},
+		{
+			name: "frame above max frame size",
+			second: func(p *peer) *packet.FragmentedData {
+				return &packet.FragmentedData{Id: 1, Fragment: 1, FragmentMax: 2, Payload: make([]byte, p.maxFrameSize)}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestPeer(t)
+			p.maxPayloadSize = p.maxFrameSize
+
+			_, err := p.addFragment(&packet.FragmentedData{Id: 1, Fragment: 0, FragmentMax: 2, Payload: []byte{1}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = p.addFragment(test.second(p))
+			if err == nil {
+				t.Fatal("inconsistent fragment was accepted")
+			}
+
+			_, kept := p.fragmentedPackets.Get(1)
+			if kept != test.kept {
+				t.Fatalf("frame was kept %t, expected %t", kept, test.kept)
+			}
+		})
+	}
+}
+
+func TestPeerReassemblyFrameLimit(t *testing.T) {
+	p := newTestPeer(t)
+
+	for id := uint32(0); id <= maxReassemblyFrames; id++ {
+		_, err := p.addFragment(&packet.FragmentedData{Id: id, FragmentMax: 2, Payload: []byte{1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the creation times of the frames must differ to find the oldest
+		time.Sleep(time.Microsecond)
+	}
+
+	if len(p.fragmentedPackets.Keys()) != maxReassemblyFrames {
+		t.Fatalf("%d incomplete frames are kept, expected %d", len(p.fragmentedPackets.Keys()), maxReassemblyFrames)
+	}
+
+	_, ok := p.fragmentedPackets.Get(0)
+	if ok {
+		t.Fatal("oldest incomplete frame was not dropped")
+	}
+
+	if p.reassemblyBytes != maxReassemblyFrames {
+		t.Fatalf("reassembly bytes are %d, expected %d", p.reassemblyBytes, maxReassemblyFrames)
+	}
+}
+
+func TestPeerReassemblyTimeout(t *testing.T) {
+	p := newTestPeer(t)
+
+	_, err := p.addFragment(&packet.FragmentedData{Id: 1, FragmentMax: 2, Payload: []byte{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.dropExpiredFrames(time.Now())
+	if len(p.fragmentedPackets.Keys()) != 1 {
+		t.Fatal("incomplete frame was dropped before the reassembly timeout")
+	}
+
+	p.dropExpiredFrames(time.Now().Add(reassemblyTimeout + time.Second))
+	if len(p.fragmentedPackets.Keys()) != 0 || p.reassemblyBytes != 0 {
+		t.Fatal("incomplete frame was not dropped after the reassembly timeout")
+	}
+}
@@ -3,7 +3,47 @@ package internal
 import "github.com/songgao/packets/ethernet"
 
 type Port interface {
+	Name() string
 	Write(frame ethernet.Frame) error
 	Read() (ethernet.Frame, error)
 	Close() error
 }
+
+// PortConfig is the configuration of a port on the switch
+type PortConfig struct {
+	// SuppressBroadcast stops broadcast frames from being flooded to the port
+	SuppressBroadcast bool
+	// SuppressMulticast stops multicast frames from being flooded to the port
+	SuppressMulticast bool
+	// SuppressUnknownUnicast stops unicast frames with an unknown destination from being flooded to the port
+	SuppressUnknownUnicast bool
+	// MaxMACs is the maximum amount of hardware addresses learned on the port, 0 is unlimited
+	MaxMACs int
+	// VLANMode is the 802.1Q mode of the port, access if empty
+	VLANMode VLANMode
+	// PVID is the VLAN of an access port or the native VLAN of a trunk port, trunks without PVID drop untagged frames
+	PVID uint16
+	// AllowedVLANs are the VLANs carried by a trunk port, all VLANs if empty
+	AllowedVLANs []uint16
+	// SplitHorizon stops frames received on the port from being forwarded to other split horizon ports,
+	// this prevents loops between fully meshed peers
+	SplitHorizon bool
+	// Queue is the configuration of the egress queue of the port
+	Queue QueueConfig
+	// QoS is the classification of frames received on the port and the scheduling of its egress queues
+	QoS QoSConfig
+	// IngressLimit limits the traffic received on the port
+	IngressLimit RateLimit
+	// EgressLimit limits the traffic sent to the port
+	EgressLimit RateLimit
+	// StormControl limits the rate of flooded frames received on the port
+	StormControl StormControl
+	// IngressACL filters frames received on the port
+	IngressACL ACL
+	// EgressACL filters frames sent to the port
+	EgressACL ACL
+	// Security restricts the source hardware addresses of frames received on the port
+	Security PortSecurity
+	// DHCPTrusted allows DHCP server messages to be received on the port if DHCP snooping is enabled
+	DHCPTrusted bool
+}
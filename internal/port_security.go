@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"github.com/lucasl0st/trestle/internal/util"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type ViolationAction string
+
+const (
+	// ViolationDrop drops frames violating the port security
+	ViolationDrop ViolationAction = "drop"
+	// ViolationLog drops and logs frames violating the port security
+	ViolationLog ViolationAction = "log"
+	// ViolationShutdown logs the violation and shuts the port down, it neither sends nor receives frames until it recovers
+	// or is removed and added again
+	ViolationShutdown ViolationAction = "shutdown"
+)
+
+// PortSecurity restricts the source hardware addresses of frames received on a port
+type PortSecurity struct {
+	// AllowedMACs are the hardware addresses that are always allowed
+	AllowedMACs []net.HardwareAddr
+	// StickyMACs is the amount of hardware addresses that are allowed once they were first seen
+	StickyMACs int
+	// Violation is the action taken for frames from other hardware addresses, log if empty
+	Violation ViolationAction
+	// Recovery is the time after which a shut down port is enabled again, it stays shut down if 0
+	Recovery time.Duration
+}
+
+func (s PortSecurity) enabled() bool {
+	return len(s.AllowedMACs) > 0 || s.StickyMACs > 0
+}
+
+// portSecurityState is the state of the port security of a port
+type portSecurityState struct {
+	sync.Mutex
+
+	sticky     int
+	violations atomic.Uint64
+	// shutdownAt is the time in unix nanoseconds the port was shut down, 0 if it is not shut down
+	shutdownAt atomic.Int64
+	// violations are logged per port, so a spoofing host does not hide the violations on other ports
+	log *util.LogLimiter
+}
+
+// stick locks a hardware address to the port if the port has sticky addresses left
+func (s *portSecurityState) stick(maxSticky int) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.sticky >= maxSticky {
+		return false
+	}
+
+	s.sticky++
+	return true
+}
+
+// addSecureMACs locks the allowed hardware addresses of a port to it
+func (e *ethernetSwitch) addSecureMACs(portId uint, cfg PortConfig) {
+	for _, mac := range cfg.Security.AllowedMACs {
+		e.secureMACs.Set(macArray(mac), portId)
+	}
+}
+
+// removeSecureMACs removes all hardware addresses locked to a port
+func (e *ethernetSwitch) removeSecureMACs(portId uint) {
+	var macs [][6]byte
+
+	e.secureMACs.Range(func(mac [6]byte, securedPortId uint) bool {
+		if securedPortId == portId {
+			macs = append(macs, mac)
+		}
+
+		return true
+	})
+
+	for _, mac := range macs {
+		e.secureMACs.Delete(mac)
+	}
+}
+
+// secure checks the source hardware address of a frame received on a port, returns false if the frame is dropped,
+// addresses locked to a port are never accepted on another port
+func (e *ethernetSwitch) secure(source net.HardwareAddr, portId uint, cfg PortConfig, state *portSecurityState) bool {
+	mac := macArray(source)
+
+	securedPortId, secured := e.secureMACs.Get(mac)
+	if secured {
+		if securedPortId == portId {
+			return true
+		}
+
+		e.violation(source, portId, cfg, state, "mac is secured on another port")
+		return false
+	}
+
+	if !cfg.Security.enabled() {
+		return true
+	}
+
+	if cfg.Security.StickyMACs > 0 && state.stick(cfg.Security.StickyMACs) {
+		e.secureMACs.Set(mac, portId)
+		slog.Info("secured sticky mac", "switch", e.name, "portId", portId, "port", e.portName(portId), "mac", source.String())
+		return true
+	}
+
+	e.violation(source, portId, cfg, state, "mac is not allowed")
+	return false
+}
+
+func (e *ethernetSwitch) violation(source net.HardwareAddr, portId uint, cfg PortConfig, state *portSecurityState, reason string) {
+	state.violations.Add(1)
+
+	action := cfg.Security.Violation
+	if action == "" {
+		action = ViolationLog
+	}
+
+	if action == ViolationDrop {
+		return
+	}
+
+	if action == ViolationShutdown {
+		if state.shutdownAt.CompareAndSwap(0, time.Now().UnixNano()) {
+			slog.Error("shut down port after port security violation", "switch", e.name, "portId", portId, "port", e.portName(portId), "mac", source.String(), "reason", reason,
+				"recovery", cfg.Security.Recovery)
+		}
+
+		return
+	}
+
+	if state.log.Allow() {
+		slog.Warn("port security violation", "switch", e.name, "portId", portId, "port", e.portName(portId), "mac", source.String(), "reason", reason, "violations", state.violations.Load())
+	}
+}
+
+// isShutdown returns whether a port was shut down by a port security violation, the port is enabled again once its
+// recovery time passed
+func (e *ethernetSwitch) isShutdown(portId uint, cfg PortConfig) bool {
+	state, ok := e.security.Get(portId)
+	if !ok {
+		return false
+	}
+
+	shutdownAt := state.shutdownAt.Load()
+	if shutdownAt == 0 {
+		return false
+	}
+
+	if cfg.Security.Recovery == 0 || time.Since(time.Unix(0, shutdownAt)) < cfg.Security.Recovery {
+		return true
+	}
+
+	if state.shutdownAt.CompareAndSwap(shutdownAt, 0) {
+		slog.Info("recovered port after port security violation", "switch", e.name, "portId", portId, "port", e.portName(portId))
+	}
+
+	return false
+}
+
+func (e *ethernetSwitch) portName(portId uint) string {
+	port, ok := e.ports.Get(portId)
+	if !ok {
+		return ""
+	}
+
+	return port.Name()
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPortSecurity(t *testing.T) {
+	tests := []struct {
+		name     string
+		security PortSecurity
+		sources  []string
+		allowed  []bool
+	}{
+		{
+			name:     "disabled",
+			security: PortSecurity{},
+			sources:  []string{"02:00:00:00:00:0a", "02:00:00:00:00:0c"},
+			allowed:  []bool{true, true},
+		},
+		{
+			name:     "allowed macs",
+			security: PortSecurity{AllowedMACs: []net.HardwareAddr{testMAC("02:00:00:00:00:0a")}},
+			sources:  []string{"02:00:00:00:00:0a", "02:00:00:00:00:0c", "02:00:00:00:00:0a"},
+			allowed:  []bool{true, false, true},
+		},
+		{
+			name:     "sticky macs",
+			security: PortSecurity{StickyMACs: 1},
+			sources:  []string{"02:00:00:00:00:0c", "02:00:00:00:00:0d", "02:00:00:00:00:0c"},
+			allowed:  []bool{true, false, true},
+		},
+		{
+			name:     "mac secured on another port",
+			security: PortSecurity{StickyMACs: 1},
+			sources:  []string{"02:00:00:00:00:0b"},
+			allowed:  []bool{false},
+		},
+		{
+			name:     "shutdown",
+			security: PortSecurity{AllowedMACs: []net.HardwareAddr{testMAC("02:00:00:00:00:0a")}, Violation: ViolationShutdown},
+			sources:  []string{"02:00:00:00:00:0a", "02:00:00:00:00:0c", "02:00:00:00:00:0a"},
+			allowed:  []bool{true, false, false},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sw := newTestSwitch(t, SwitchConfig{})
+			a, b := newTestPort("a"), newTestPort("b")
+			sw.AddPort(a, PortConfig{Security: test.security})
+			sw.AddPort(b, PortConfig{Security: PortSecurity{AllowedMACs: []net.HardwareAddr{testMAC("02:00:00:00:00:0b")}}})
+
+			for i, source := range test.sources {
+				a.in <- testFrame("02:00:00:00:00:0b", source)
+				expectFrame(t, b, test.allowed[i])
+			}
+		})
+	}
+}
+
+func TestPortSecurityShutdownRecovery(t *testing.T) {
+	sw := newTestSwitch(t, SwitchConfig{})
+	a, b := newTestPort("a"), newTestPort("b")
+	aPortId := sw.AddPort(a, PortConfig{Security: PortSecurity{
+		AllowedMACs: []net.HardwareAddr{testMAC("02:00:00:00:00:0a")},
+		Violation:   ViolationShutdown,
+		Recovery:    100 * time.Millisecond,
+	}})
+	sw.AddPort(b, PortConfig{})
+
+	a.in <- testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0c")
+	expectFrame(t, b, false)
+
+	// a shut down port neither receives nor sends frames
+	a.in <- testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0a")
+	expectFrame(t, b, false)
+
+	b.in <- testFrame("ff:ff:ff:ff:ff:ff", "02:00:00:00:00:0b")
+	expectFrame(t, a, false)
+
+	if !portStatus(t, sw, aPortId).Shutdown {
+		t.Fatal("port is not shut down")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	a.in <- testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0a")
+	expectFrame(t, b, true)
+
+	if portStatus(t, sw, aPortId).Shutdown {
+		t.Fatal("port did not recover")
+	}
+}
+
+func TestPortSecurityShutdownClearedByReadding(t *testing.T) {
+	sw := newTestSwitch(t, SwitchConfig{})
+	a, b := newTestPort("a"), newTestPort("b")
+	cfg := PortConfig{Security: PortSecurity{AllowedMACs: []net.HardwareAddr{testMAC("02:00:00:00:00:0a")}, Violation: ViolationShutdown}}
+	aPortId := sw.AddPort(a, cfg)
+	sw.AddPort(b, PortConfig{})
+
+	a.in <- testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0c")
+	expectFrame(t, b, false)
+
+	sw.RemovePort(aPortId)
+	a = newTestPort("a")
+	sw.AddPort(a, cfg)
+
+	a.in <- testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0a")
+	expectFrame(t, b, true)
+}
+
+func portStatus(t *testing.T, sw Switch, portId uint) PortStatus {
+	t.Helper()
+
+	for _, port := range sw.Status().Ports {
+		if port.Id == portId {
+			return port
+		}
+	}
+
+	t.Fatalf("port %d has no status", portId)
+	return PortStatus{}
+}
@@ -0,0 +1,115 @@
+package internal
+
+const MaxPriority = 7
+const TrafficClasses = MaxPriority + 1
+
+type QoSTrust string
+
+const (
+	// QoSTrustPCP uses the 802.1p priority of tagged frames
+	QoSTrustPCP QoSTrust = "pcp"
+	// QoSTrustDSCP uses the DSCP of IP packets
+	QoSTrustDSCP QoSTrust = "dscp"
+	// QoSTrustNone ignores the priority of received frames
+	QoSTrustNone QoSTrust = "none"
+)
+
+type Scheduler string
+
+const (
+	// SchedulerStrict always sends frames of the highest non-empty class first
+	SchedulerStrict Scheduler = "strict"
+	// SchedulerWeighted sends frames of all classes in a round-robin weighted by the class weights
+	SchedulerWeighted Scheduler = "weighted"
+)
+
+// QoSRule sets the priority of matching frames, zero fields match everything
+type QoSRule struct {
+	EtherType  uint16
+	IPProtocol uint8
+	// Port matches the TCP or UDP source or destination port
+	Port     uint16
+	Priority uint8
+}
+
+// QoSConfig is the classification of frames received on a port and the scheduling of frames sent to it
+type QoSConfig struct {
+	// Trust is the source of the priority of received frames, pcp if empty
+	Trust QoSTrust
+	// DefaultPriority is the priority of frames without priority
+	DefaultPriority uint8
+	// Rules are matched in order before the trusted priority, the first matching rule sets the priority
+	Rules []QoSRule
+	// Classes is the amount of egress queues of the port, priorities are spread evenly across them, 1 if 0
+	Classes int
+	// Scheduler decides which egress queue is sent next, strict if empty
+	Scheduler Scheduler
+	// Weights are the weights of the egress queues from lowest to highest for the weighted scheduler,
+	// class i has weight i+1 if empty
+	Weights []int
+}
+
+// classify returns the priority of a frame received on the port
+func (c QoSConfig) classify(info frameInfo, tagged bool, pcp uint8) uint8 {
+	for _, rule := range c.Rules {
+		if rule.matches(info) {
+			return rule.Priority
+		}
+	}
+
+	switch c.Trust {
+	case QoSTrustNone:
+		return c.DefaultPriority
+	case QoSTrustDSCP:
+		if !info.ip {
+			return c.DefaultPriority
+		}
+
+		// the class selector bits of the DSCP map to the priority
+		return info.dscp >> 3
+	default:
+		if !tagged {
+			return c.DefaultPriority
+		}
+
+		return pcp
+	}
+}
+
+func (r QoSRule) matches(info frameInfo) bool {
+	if r.EtherType != 0 && r.EtherType != info.etherType {
+		return false
+	}
+
+	if r.IPProtocol != 0 && (!info.ip || r.IPProtocol != info.protocol) {
+		return false
+	}
+
+	if r.Port != 0 && (!info.l4 || r.Port != info.sourcePort && r.Port != info.destinationPort) {
+		return false
+	}
+
+	return true
+}
+
+func (c QoSConfig) classes() int {
+	if c.Classes <= 0 {
+		return 1
+	}
+
+	return min(c.Classes, TrafficClasses)
+}
+
+// class returns the egress queue of a priority
+func (c QoSConfig) class(priority uint8) int {
+	return int(priority) * c.classes() / TrafficClasses
+}
+
+// weight returns the weight of an egress queue for the weighted scheduler
+func (c QoSConfig) weight(class int) int {
+	if class < len(c.Weights) && c.Weights[class] > 0 {
+		return c.Weights[class]
+	}
+
+	return class + 1
+}
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"github.com/songgao/packets/ethernet"
+	"testing"
+)
+
+func TestQoSConfigClassify(t *testing.T) {
+	udp := frameInfo{etherType: 0x0800, ip: true, l4: true, protocol: ipProtocolUDP, dscp: 46, sourcePort: 5060, destinationPort: 40000}
+	arp := frameInfo{etherType: 0x0806}
+
+	tests := []struct {
+		name     string
+		cfg      QoSConfig
+		info     frameInfo
+		tagged   bool
+		pcp      uint8
+		priority uint8
+	}{
+		{name: "pcp tagged", cfg: QoSConfig{}, info: udp, tagged: true, pcp: 5, priority: 5},
+		{name: "pcp untagged", cfg: QoSConfig{DefaultPriority: 2}, info: udp, priority: 2},
+		{name: "dscp", cfg: QoSConfig{Trust: QoSTrustDSCP}, info: udp, tagged: true, pcp: 1, priority: 5},
+		{name: "dscp without ip", cfg: QoSConfig{Trust: QoSTrustDSCP, DefaultPriority: 3}, info: arp, priority: 3},
+		{name: "none", cfg: QoSConfig{Trust: QoSTrustNone, DefaultPriority: 1}, info: udp, tagged: true, pcp: 7, priority: 1},
+		{
+			name:     "rule matches port",
+			cfg:      QoSConfig{Rules: []QoSRule{{IPProtocol: ipProtocolUDP, Port: 5060, Priority: 6}}},
+			info:     udp,
+			tagged:   true,
+			pcp:      1,
+			priority: 6,
+		},
+		{
+			name:     "first matching rule",
+			cfg:      QoSConfig{Rules: []QoSRule{{EtherType: 0x0806, Priority: 7}, {EtherType: 0x0800, Priority: 4}, {Priority: 1}}},
+			info:     udp,
+			priority: 4,
+		},
+		{
+			name:     "rule does not match",
+			cfg:      QoSConfig{Rules: []QoSRule{{Port: 443, Priority: 6}}, DefaultPriority: 2},
+			info:     udp,
+			priority: 2,
+		},
+		{
+			name:     "port rule does not match frames without ports",
+			cfg:      QoSConfig{Rules: []QoSRule{{Port: 5060, Priority: 6}}},
+			info:     arp,
+			priority: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			priority := test.cfg.classify(test.info, test.tagged, test.pcp)
+			if priority != test.priority {
+				t.Fatalf("classified priority %d, expected %d", priority, test.priority)
+			}
+		})
+	}
+}
+
+func TestQoSConfigClass(t *testing.T) {
+	tests := []struct {
+		classes int
+		// expected are the classes of the priorities 0 to 7
+		expected []int
+	}{
+		{classes: 0, expected: []int{0, 0, 0, 0, 0, 0, 0, 0}},
+		{classes: 2, expected: []int{0, 0, 0, 0, 1, 1, 1, 1}},
+		{classes: 4, expected: []int{0, 0, 1, 1, 2, 2, 3, 3}},
+		{classes: 8, expected: []int{0, 1, 2, 3, 4, 5, 6, 7}},
+		{classes: 16, expected: []int{0, 1, 2, 3, 4, 5, 6, 7}},
+	}
+
+	for _, test := range tests {
+		cfg := QoSConfig{Classes: test.classes}
+
+		for priority, expected := range test.expected {
+			class := cfg.class(uint8(priority))
+			if class != expected {
+				t.Fatalf("priority %d is in class %d with %d classes, expected %d", priority, class, test.classes, expected)
+			}
+		}
+	}
+}
+
+// testPriorityFrame returns a frame whose destination holds its priority
+func testPriorityFrame(priority uint8) ethernet.Frame {
+	frame := testFrame("02:00:00:00:00:01", "02:00:00:00:00:0a")
+	frame[5] = priority
+	return frame
+}
+
+func TestEgressQueueScheduler(t *testing.T) {
+	tests := []struct {
+		name string
+		qos  QoSConfig
+		// expected are the priorities of the frames in the order they are grabbed
+		expected []uint8
+	}{
+		{
+			name:     "single class",
+			qos:      QoSConfig{},
+			expected: []uint8{0, 7, 0, 7, 0, 7},
+		},
+		{
+			name:     "strict",
+			qos:      QoSConfig{Classes: 2},
+			expected: []uint8{7, 7, 7, 0, 0, 0},
+		},
+		{
+			name:     "weighted",
+			qos:      QoSConfig{Classes: 2, Scheduler: SchedulerWeighted},
+			expected: []uint8{7, 7, 0, 7, 0, 0},
+		},
+		{
+			name:     "weighted with weights",
+			qos:      QoSConfig{Classes: 2, Scheduler: SchedulerWeighted, Weights: []int{2, 1}},
+			expected: []uint8{7, 0, 0, 7, 0, 7},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := newEgressQueue(QueueConfig{}, test.qos)
+			defer q.close()
+
+			for range 3 {
+				q.add(testPriorityFrame(0), 0)
+				q.add(testPriorityFrame(7), 7)
+			}
+
+			for i, expected := range test.expected {
+				frame, ok := q.grab()
+				if !ok {
+					t.Fatal("queue was closed")
+				}
+
+				if frame[5] != expected {
+					t.Fatalf("frame %d has priority %d, expected %d", i, frame[5], expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"github.com/lucasl0st/trestle/internal/util"
+	"sync/atomic"
+	"time"
+)
+
+const defaultBurstDuration = 100 * time.Millisecond
+
+// minBurst is the minimum burst in bytes, it must fit the largest frames
+const minBurst = 64 * 1024
+
+// RateLimit is a token bucket limit of the traffic of a port
+type RateLimit struct {
+	// Rate is the limit in bits per second, 0 is unlimited
+	Rate uint64
+	// Burst is the amount of bytes that may exceed the rate at once, 100ms of the rate if 0 and at least minBurst
+	Burst uint64
+}
+
+// StormControl limits the rate of flooded frames received on a port
+type StormControl struct {
+	// Broadcast is the maximum of broadcast frames per second, 0 is unlimited
+	Broadcast uint64
+	// Multicast is the maximum of multicast frames per second, 0 is unlimited
+	Multicast uint64
+	// UnknownUnicast is the maximum of unicast frames with an unknown destination per second, 0 is unlimited
+	UnknownUnicast uint64
+}
+
+// portLimiter are the token buckets of a port, nil buckets are unlimited
+type portLimiter struct {
+	ingress *util.TokenBucket
+	egress  *util.TokenBucket
+
+	broadcast      *util.TokenBucket
+	multicast      *util.TokenBucket
+	unknownUnicast *util.TokenBucket
+
+	ingressDrops atomic.Uint64
+	egressDrops  atomic.Uint64
+	stormDrops   atomic.Uint64
+}
+
+func newPortLimiter(cfg PortConfig) *portLimiter {
+	return &portLimiter{
+		ingress:        newByteBucket(cfg.IngressLimit),
+		egress:         newByteBucket(cfg.EgressLimit),
+		broadcast:      newFrameBucket(cfg.StormControl.Broadcast),
+		multicast:      newFrameBucket(cfg.StormControl.Multicast),
+		unknownUnicast: newFrameBucket(cfg.StormControl.UnknownUnicast),
+	}
+}
+
+func newByteBucket(limit RateLimit) *util.TokenBucket {
+	if limit.Rate == 0 {
+		return nil
+	}
+
+	rate := float64(limit.Rate) / 8
+
+	burst := float64(limit.Burst)
+	if burst == 0 {
+		burst = rate * defaultBurstDuration.Seconds()
+	}
+
+	return util.NewTokenBucket(rate, max(burst, minBurst))
+}
+
+// newFrameBucket creates a bucket of frames per second that allows a burst of one second
+func newFrameBucket(rate uint64) *util.TokenBucket {
+	if rate == 0 {
+		return nil
+	}
+
+	return util.NewTokenBucket(float64(rate), float64(rate))
+}
+
+func take(bucket *util.TokenBucket, n int) bool {
+	return bucket == nil || bucket.Take(float64(n))
+}
+
+// allowIngress returns whether a frame received on the port is within the ingress rate limit
+func (p *portLimiter) allowIngress(size int) bool {
+	if take(p.ingress, size) {
+		return true
+	}
+
+	p.ingressDrops.Add(1)
+	return false
+}
+
+// allowEgress returns whether a frame sent to the port is within the egress rate limit
+func (p *portLimiter) allowEgress(size int) bool {
+	if take(p.egress, size) {
+		return true
+	}
+
+	p.egressDrops.Add(1)
+	return false
+}
+
+// allowFlood returns whether a flooded frame received on the port is within the storm control limits
+func (p *portLimiter) allowFlood(flood floodType) bool {
+	var bucket *util.TokenBucket
+
+	switch flood {
+	case floodBroadcast:
+		bucket = p.broadcast
+	case floodMulticast:
+		bucket = p.multicast
+	case floodUnknownUnicast:
+		bucket = p.unknownUnicast
+	}
+
+	if take(bucket, 1) {
+		return true
+	}
+
+	p.stormDrops.Add(1)
+	return false
+}
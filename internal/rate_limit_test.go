@@ -0,0 +1,117 @@
+package internal
+
+import "testing"
+
+func TestNewByteBucket(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit RateLimit
+		burst int
+	}{
+		{name: "unlimited", limit: RateLimit{}},
+		{name: "minimum burst", limit: RateLimit{Rate: 8000}, burst: minBurst},
+		{name: "default burst", limit: RateLimit{Rate: 80_000_000}, burst: 1_000_000},
+		{name: "configured burst", limit: RateLimit{Rate: 80_000_000, Burst: 2_000_000}, burst: 2_000_000},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bucket := newByteBucket(test.limit)
+			if test.burst == 0 {
+				if bucket != nil {
+					t.Fatal("unlimited rate has a bucket")
+				}
+
+				return
+			}
+
+			if !bucket.Take(float64(test.burst)) || bucket.Take(float64(test.burst)) {
+				t.Fatalf("burst of bucket is not %d bytes", test.burst)
+			}
+		})
+	}
+}
+
+func TestPortLimiter(t *testing.T) {
+	cfg := PortConfig{
+		IngressLimit: RateLimit{Rate: 8, Burst: minBurst},
+		EgressLimit:  RateLimit{Rate: 8, Burst: minBurst},
+		StormControl: StormControl{Broadcast: 2},
+	}
+
+	tests := []struct {
+		name    string
+		allow   func(l *portLimiter) bool
+		allowed []bool
+		drops   func(l *portLimiter) uint64
+	}{
+		{
+			name:    "ingress",
+			allow:   func(l *portLimiter) bool { return l.allowIngress(minBurst / 2) },
+			allowed: []bool{true, true, false},
+			drops:   func(l *portLimiter) uint64 { return l.ingressDrops.Load() },
+		},
+		{
+			name:    "egress",
+			allow:   func(l *portLimiter) bool { return l.allowEgress(minBurst / 2) },
+			allowed: []bool{true, true, false},
+			drops:   func(l *portLimiter) uint64 { return l.egressDrops.Load() },
+		},
+		{
+			name:    "broadcast storm",
+			allow:   func(l *portLimiter) bool { return l.allowFlood(floodBroadcast) },
+			allowed: []bool{true, true, false},
+			drops:   func(l *portLimiter) uint64 { return l.stormDrops.Load() },
+		},
+		{
+			name:    "multicast is unlimited",
+			allow:   func(l *portLimiter) bool { return l.allowFlood(floodMulticast) },
+			allowed: []bool{true, true, true},
+			drops:   func(l *portLimiter) uint64 { return l.stormDrops.Load() },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := newPortLimiter(cfg)
+
+			var drops uint64
+			for i, expected := range test.allowed {
+				if test.allow(l) != expected {
+					t.Fatalf("frame %d allowed is not %t", i, expected)
+				}
+
+				if !expected {
+					drops++
+				}
+			}
+
+			if test.drops(l) != drops {
+				t.Fatalf("dropped %d frames, expected %d", test.drops(l), drops)
+			}
+		})
+	}
+}
+
+func TestSwitchStormControl(t *testing.T) {
+	sw := newTestSwitch(t, SwitchConfig{})
+	a, b := newTestPort("a"), newTestPort("b")
+	aId := sw.AddPort(a, PortConfig{StormControl: StormControl{Broadcast: 1}})
+	sw.AddPort(b, PortConfig{})
+
+	a.in <- testFrame("ff:ff:ff:ff:ff:ff", "02:00:00:00:00:0a")
+	expectFrame(t, b, true)
+
+	// broadcasts above the limit are dropped, other frames are not limited
+	a.in <- testFrame("ff:ff:ff:ff:ff:ff", "02:00:00:00:00:0a")
+	expectFrame(t, b, false)
+
+	a.in <- testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0a")
+	expectFrame(t, b, true)
+
+	for _, port := range sw.Status().Ports {
+		if port.Id == aId && port.StormDrops != 1 {
+			t.Fatalf("port dropped %d frames by storm control, expected 1", port.StormDrops)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+const reconnectInterval = 500 * time.Millisecond
+const handshakeTimeout = 5 * time.Second
+const minBackoff = time.Second
+const maxBackoff = time.Minute
+
+type PeerState string
+
+const (
+	// PeerStateDisconnected is the state of peers without session that are not connected to by us
+	PeerStateDisconnected PeerState = "disconnected"
+	// PeerStateConnecting is the state of peers a handshake was initiated with
+	PeerStateConnecting PeerState = "connecting"
+	// PeerStateEstablished is the state of peers with a session
+	PeerStateEstablished PeerState = "established"
+	// PeerStateBackingOff is the state of peers waiting for the next connection attempt
+	PeerStateBackingOff PeerState = "backing off"
+)
+
+// PeerStatus is the current state of a peer for debugging
+type PeerStatus struct {
+	Name        string
+	Address     string
+	State       PeerState
+	NextAttempt time.Time
+	Statistics  SessionStatistics
+}
+
+// connection is an outbound peer connection that is kept established
+type connection struct {
+	sync.Mutex
+
+	hostname string
+	port     uint16
+
+	state       PeerState
+	attemptedAt time.Time
+	nextAttempt time.Time
+	backoff     time.Duration
+}
+
+func newConnection(hostname string, port uint16) *connection {
+	return &connection{
+		hostname: hostname,
+		port:     port,
+		state:    PeerStateBackingOff,
+		backoff:  minBackoff,
+	}
+}
+
+func (l *listener) reconnect() {
+	ticker := time.NewTicker(reconnectInterval)
+	defer ticker.Stop()
+
+	for l.alive.Load() {
+		l.connections.Range(func(name string, c *connection) bool {
+			l.maintainConnection(name, c)
+			return true
+		})
+
+		<-ticker.C
+	}
+}
+
+func (l *listener) maintainConnection(name string, c *connection) {
+	c.Lock()
+	defer c.Unlock()
+
+	_, established := l.sessions.Get(name)
+	if established {
+		if c.state != PeerStateEstablished {
+			slog.Info("peer state changed", "peer", name, "state", PeerStateEstablished)
+		}
+
+		c.state = PeerStateEstablished
+		c.backoff = minBackoff
+		return
+	}
+
+	now := time.Now()
+
+	switch c.state {
+	case PeerStateConnecting:
+		if now.Sub(c.attemptedAt) < handshakeTimeout {
+			return
+		}
+
+		l.handshakes.Delete(name)
+		c.backOff(name, now)
+		return
+	case PeerStateBackingOff:
+		if now.Before(c.nextAttempt) {
+			return
+		}
+	}
+
+	c.state = PeerStateConnecting
+	c.attemptedAt = now
+	slog.Info("peer state changed", "peer", name, "state", PeerStateConnecting, "hostname", c.hostname, "port", c.port)
+
+	err := l.initiate(name, c.hostname, c.port)
+	if err != nil {
+		slog.Error("failed to initiate handshake", "peer", name, "error", err)
+		l.handshakes.Delete(name)
+		c.backOff(name, now)
+	}
+}
+
+func (c *connection) backOff(name string, now time.Time) {
+	c.state = PeerStateBackingOff
+	c.nextAttempt = now.Add(c.backoff)
+	slog.Info("peer state changed", "peer", name, "state", PeerStateBackingOff, "retryIn", c.backoff)
+
+	c.backoff *= 2
+	if c.backoff > maxBackoff {
+		c.backoff = maxBackoff
+	}
+}
+
+func (l *listener) Status() []PeerStatus {
+	var status []PeerStatus
+
+	l.identities.Range(func(name string, _ identity) bool {
+		status = append(status, l.peerStatus(name))
+		return true
+	})
+
+	// peers with unknown public keys are only known by their session
+	l.sessions.Range(func(peerId string, _ *session) bool {
+		_, ok := l.identities.Get(peerId)
+		if !ok {
+			status = append(status, l.peerStatus(peerId))
+		}
+
+		return true
+	})
+
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Name < status[j].Name
+	})
+
+	return status
+}
+
+func (l *listener) peerStatus(peerId string) PeerStatus {
+	status := PeerStatus{
+		Name:  peerId,
+		State: PeerStateDisconnected,
+	}
+
+	c, ok := l.connections.Get(peerId)
+	if ok {
+		c.Lock()
+		status.State = c.state
+		status.NextAttempt = c.nextAttempt
+		c.Unlock()
+	}
+
+	s, ok := l.sessions.Get(peerId)
+	if ok {
+		status.State = PeerStateEstablished
+		status.NextAttempt = time.Time{}
+		status.Address, _ = l.peerIdToAddress.Get(peerId)
+		status.Statistics = s.statistics()
+	}
+
+	return status
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnectionBackOff(t *testing.T) {
+	c := newConnection("127.0.0.1", 9)
+	now := time.Now()
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, time.Minute, time.Minute}
+
+	for _, backoff := range expected {
+		c.backOff("b", now)
+
+		if c.state != PeerStateBackingOff {
+			t.Fatalf("state is %s, expected %s", c.state, PeerStateBackingOff)
+		}
+
+		if c.nextAttempt != now.Add(backoff) {
+			t.Fatalf("next attempt is in %s, expected %s", c.nextAttempt.Sub(now), backoff)
+		}
+	}
+}
+
+func TestListenerConnect(t *testing.T) {
+	a, b := testPair(t, ListenerConfig{})
+
+	err := a.Connect("c", "127.0.0.1", b.port)
+	if err == nil {
+		t.Fatal("connected to unknown peer")
+	}
+
+	err = a.Connect("b", "127.0.0.1", b.port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.Connect("b", "127.0.0.1", b.port)
+	if err == nil {
+		t.Fatal("connected to peer twice")
+	}
+
+	eventually(t, established(a, "b"), "a did not connect to b")
+
+	// the connection notices the session with the next reconnect interval
+	eventually(t, func() bool {
+		c, _ := a.connections.Get("b")
+		c.Lock()
+		defer c.Unlock()
+
+		return c.state == PeerStateEstablished
+	}, "connection to b is not established")
+
+	// the connection is established again once the session is lost
+	a.closeSession("b", "test")
+	b.closeSession("a", "test")
+
+	eventually(t, established(a, "b"), "a did not reconnect to b")
+	eventually(t, established(b, "a"), "b did not accept the reconnect of a")
+}
+
+func TestListenerConnectBacksOff(t *testing.T) {
+	a, _ := testPair(t, ListenerConfig{})
+
+	c := newConnection("127.0.0.1", 9)
+	a.maintainConnection("b", c)
+
+	if c.state != PeerStateConnecting {
+		t.Fatalf("state is %s, expected %s", c.state, PeerStateConnecting)
+	}
+
+	// the connection is not retried before the handshake timed out
+	a.maintainConnection("b", c)
+	if c.state != PeerStateConnecting {
+		t.Fatalf("state is %s, expected %s", c.state, PeerStateConnecting)
+	}
+
+	c.attemptedAt = time.Now().Add(-handshakeTimeout)
+	a.maintainConnection("b", c)
+
+	if c.state != PeerStateBackingOff || c.backoff != 2*minBackoff {
+		t.Fatalf("state is %s with backoff %s, expected %s with %s", c.state, c.backoff, PeerStateBackingOff, 2*minBackoff)
+	}
+
+	// the connection is retried once the backoff passed
+	a.maintainConnection("b", c)
+	if c.state != PeerStateBackingOff {
+		t.Fatalf("state is %s, expected %s", c.state, PeerStateBackingOff)
+	}
+
+	c.nextAttempt = time.Now()
+	a.maintainConnection("b", c)
+
+	if c.state != PeerStateConnecting {
+		t.Fatalf("state is %s, expected %s", c.state, PeerStateConnecting)
+	}
+}
@@ -0,0 +1,402 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/songgao/packets/ethernet"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+)
+
+type Router interface {
+	// Interfaces returns the ports of the router interfaces in the order of their config
+	Interfaces() []Port
+}
+
+const (
+	routerQueueSize = 256
+	routerTTL       = 64
+
+	icmpEchoReply     = 0
+	icmpEchoRequest   = 8
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+// RouterConfig is a router with an interface on each of several switches
+type RouterConfig struct {
+	Name       string
+	Interfaces []RouterInterfaceConfig
+	// Routes are static routes, the connected subnets of the interfaces are routed without route
+	Routes []Route
+}
+
+// RouterInterfaceConfig is a port of a router
+type RouterInterfaceConfig struct {
+	// Name is the name of the port
+	Name string
+	// MAC is the hardware address of the interface, a random locally administered address if empty
+	MAC net.HardwareAddr
+	// Addresses are the IPv4 and IPv6 addresses of the interface and their connected subnets
+	Addresses []netip.Prefix
+}
+
+// Route routes a prefix to a next hop in a connected subnet
+type Route struct {
+	Prefix netip.Prefix
+	Via    netip.Addr
+}
+
+type router struct {
+	name       string
+	interfaces []*routerInterface
+	routes     []Route
+}
+
+// routerInterface is the port of a router on a switch
+type routerInterface struct {
+	router    *router
+	name      string
+	mac       net.HardwareAddr
+	addresses []netip.Prefix
+	linkLocal netip.Addr
+	neighbors *neighborCache
+
+	frames chan ethernet.Frame
+	done   chan struct{}
+	once   sync.Once
+}
+
+func NewRouter(cfg RouterConfig) (Router, error) {
+	r := &router{
+		name:   cfg.Name,
+		routes: cfg.Routes,
+	}
+
+	for _, ifaceCfg := range cfg.Interfaces {
+		mac := ifaceCfg.MAC
+		if mac == nil {
+			var err error
+			mac, err = randomMAC()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		iface := &routerInterface{
+			router:    r,
+			name:      ifaceCfg.Name,
+			mac:       mac,
+			addresses: ifaceCfg.Addresses,
+			linkLocal: linkLocalAddr(mac),
+			neighbors: newNeighborCache(),
+			frames:    make(chan ethernet.Frame, routerQueueSize),
+			done:      make(chan struct{}),
+		}
+
+		// announcing the addresses lets the switch learn the hardware address of the interface
+		for _, address := range iface.addresses {
+			if address.Addr().Is4() {
+				iface.send(arpReplyFrame(mac, address.Addr(), broadcastMac, address.Addr()))
+			}
+		}
+
+		r.interfaces = append(r.interfaces, iface)
+	}
+
+	for _, route := range cfg.Routes {
+		if r.connected(route.Via) == nil {
+			return nil, fmt.Errorf("next hop %s of route %s is not in a connected subnet", route.Via, route.Prefix)
+		}
+	}
+
+	slog.Info("started router", "router", r.name, "interfaces", len(r.interfaces), "routes", len(r.routes))
+	return r, nil
+}
+
+func (r *router) Interfaces() []Port {
+	ports := make([]Port, 0, len(r.interfaces))
+	for _, iface := range r.interfaces {
+		ports = append(ports, iface)
+	}
+
+	return ports
+}
+
+func (i *routerInterface) Name() string {
+	return i.name
+}
+
+// Write handles a frame sent to the interface by the switch
+func (i *routerInterface) Write(frame ethernet.Frame) error {
+	if len(frame) < ethernetHeaderSize {
+		return nil
+	}
+
+	i.router.receive(i, frame)
+	return nil
+}
+
+// Read returns the next frame sent by the interface
+func (i *routerInterface) Read() (ethernet.Frame, error) {
+	select {
+	case frame := <-i.frames:
+		return frame, nil
+	case <-i.done:
+		return nil, errors.New("router interface closed")
+	}
+}
+
+func (i *routerInterface) Close() error {
+	i.once.Do(func() {
+		close(i.done)
+	})
+
+	return nil
+}
+
+// send queues a frame to be read by the switch, frames are dropped if the switch does not keep up
+func (i *routerInterface) send(frame ethernet.Frame) {
+	select {
+	case i.frames <- frame:
+	default:
+	}
+}
+
+// local returns whether ip is an address of the interface
+func (i *routerInterface) local(ip netip.Addr) bool {
+	return isLocalAddr(i.addresses, i.linkLocal, ip)
+}
+
+func (r *router) receive(in *routerInterface, frame ethernet.Frame) {
+	// double tagged frames belong to a VLAN the router has no interface in
+	info := parseFrame(frame)
+	if info.stacked {
+		return
+	}
+
+	p, ok := parseNeighborPacket(frame, info)
+	if ok {
+		r.handleNeighbor(in, p)
+		return
+	}
+
+	if !bytes.Equal(frame.Destination(), in.mac) || !info.ip {
+		return
+	}
+
+	destination, _ := netip.AddrFromSlice(info.destinationIP)
+	destination = destination.Unmap()
+
+	if r.local(destination) {
+		r.answerEcho(in, frame, info)
+		return
+	}
+
+	r.forward(frame, info, destination)
+}
+
+func (r *router) local(ip netip.Addr) bool {
+	for _, iface := range r.interfaces {
+		if iface.local(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// connected returns the interface with a connected subnet containing ip
+func (r *router) connected(ip netip.Addr) *routerInterface {
+	for _, iface := range r.interfaces {
+		for _, address := range iface.addresses {
+			if address.Masked().Contains(ip) {
+				return iface
+			}
+		}
+	}
+
+	return nil
+}
+
+// route returns the interface and next hop of the longest matching connected subnet or static route
+func (r *router) route(destination netip.Addr) (*routerInterface, netip.Addr, bool) {
+	var out *routerInterface
+	var nextHop netip.Addr
+	bits := -1
+
+	for _, iface := range r.interfaces {
+		for _, address := range iface.addresses {
+			if address.Masked().Contains(destination) && address.Bits() > bits {
+				out, nextHop, bits = iface, destination, address.Bits()
+			}
+		}
+	}
+
+	for _, route := range r.routes {
+		if !route.Prefix.Contains(destination) || route.Prefix.Bits() <= bits {
+			continue
+		}
+
+		iface := r.connected(route.Via)
+		if iface != nil {
+			out, nextHop, bits = iface, route.Via, route.Prefix.Bits()
+		}
+	}
+
+	return out, nextHop, out != nil
+}
+
+// handleNeighbor learns the hardware addresses of hosts on the link and answers requests for the addresses of the interface
+func (r *router) handleNeighbor(in *routerInterface, p neighborPacket) {
+	if p.bindable() && onLink(in.addresses, p.senderIP) {
+		r.learn(in, p.senderIP, p.senderMAC)
+	}
+
+	if !p.request || p.senderMAC == nil || p.gratuitous || !in.local(p.targetIP) {
+		return
+	}
+
+	switch p.source {
+	case BindingSourceARP:
+		in.send(arpReplyFrame(in.mac, p.targetIP, p.senderMAC, p.senderIP))
+	case BindingSourceND:
+		// duplicate address detection of other hosts is not answered
+		if p.senderIP.IsUnspecified() {
+			return
+		}
+
+		in.send(neighborAdvertisementFrame(in.mac, p.targetIP, p.senderMAC, p.senderIP))
+	}
+}
+
+// learn stores the hardware address of a neighbor and sends the packets waiting for it
+func (r *router) learn(in *routerInterface, ip netip.Addr, mac net.HardwareAddr) {
+	for _, p := range in.neighbors.learn(ip, mac) {
+		in.send(packetFrame(mac, in.mac, p.etherType, p.packet))
+	}
+}
+
+// forward routes an IP packet received on an interface, packets exceeding their hop limit are dropped
+func (r *router) forward(frame ethernet.Frame, info frameInfo, destination netip.Addr) {
+	if !destination.IsGlobalUnicast() {
+		return
+	}
+
+	packet, ok := ipPacket(frame, info)
+	if !ok {
+		return
+	}
+
+	etherType := ethernet.IPv4
+	if info.etherType == etherTypeIPv4 {
+		if packet[8] <= 1 {
+			return
+		}
+
+		packet[8]--
+		binary.BigEndian.PutUint16(packet[10:12], 0)
+		binary.BigEndian.PutUint16(packet[10:12], checksumFold(checksumAdd(0, packet[:int(packet[0]&0x0f)*4])))
+	} else {
+		// link-local sources must not leave their link
+		source, _ := netip.AddrFromSlice(info.sourceIP)
+		if packet[7] <= 1 || source.IsLinkLocalUnicast() {
+			return
+		}
+
+		packet[7]--
+		etherType = ethernet.IPv6
+	}
+
+	out, nextHop, ok := r.route(destination)
+	if !ok {
+		return
+	}
+
+	r.send(out, nextHop, etherType, packet)
+}
+
+// send sends a packet to a next hop, the packet waits for the resolution of the next hop if its hardware address is unknown
+func (r *router) send(out *routerInterface, nextHop netip.Addr, etherType ethernet.Ethertype, packet []byte) {
+	mac, ok, request := out.neighbors.resolve(nextHop, pendingPacket{etherType: etherType, packet: packet})
+	if ok {
+		out.send(packetFrame(mac, out.mac, etherType, packet))
+		return
+	}
+
+	if !request {
+		return
+	}
+
+	source, ok := sourceAddr(out.addresses, out.linkLocal, nextHop)
+	if ok {
+		out.send(resolutionFrame(out.mac, source, nextHop))
+	}
+}
+
+// answerEcho answers ICMP and ICMPv6 echo requests to the addresses of the router
+func (r *router) answerEcho(in *routerInterface, frame ethernet.Frame, info frameInfo) {
+	packet, ok := ipPacket(frame, info)
+	if !ok {
+		return
+	}
+
+	source, _ := netip.AddrFromSlice(info.sourceIP)
+	destination, _ := netip.AddrFromSlice(info.destinationIP)
+	source = source.Unmap()
+	destination = destination.Unmap()
+
+	switch {
+	case info.etherType == etherTypeIPv4 && info.protocol == ipProtocolICMP:
+		icmp := packet[int(packet[0]&0x0f)*4:]
+		if len(icmp) < 8 || icmp[0] != icmpEchoRequest {
+			return
+		}
+
+		reply := append([]byte{}, icmp...)
+		reply[0] = icmpEchoReply
+		binary.BigEndian.PutUint16(reply[2:4], 0)
+		binary.BigEndian.PutUint16(reply[2:4], checksumFold(checksumAdd(0, reply)))
+
+		in.send(ipv4Frame(in.mac, destination, frame.Source(), source, ipProtocolICMP, routerTTL, reply))
+	case info.etherType == etherTypeIPv6 && info.protocol == ipProtocolICMPv6:
+		icmp := packet[info.transportOffset-ethernetHeaderSize:]
+		if len(icmp) < 8 || icmp[0] != icmpv6EchoRequest {
+			return
+		}
+
+		reply := append([]byte{}, icmp...)
+		reply[0] = icmpv6EchoReply
+		binary.BigEndian.PutUint16(reply[2:4], 0)
+
+		in.send(ipv6Frame(in.mac, destination, frame.Source(), source, ipProtocolICMPv6, routerTTL, reply))
+	}
+}
+
+// ipPacket returns a copy of the IP packet of an untagged frame without ethernet padding
+func ipPacket(frame ethernet.Frame, info frameInfo) ([]byte, bool) {
+	payload := frame[ethernetHeaderSize:]
+
+	var size int
+	switch info.etherType {
+	case etherTypeIPv4:
+		size = int(binary.BigEndian.Uint16(payload[2:4]))
+		if size < int(payload[0]&0x0f)*4 {
+			return nil, false
+		}
+	case etherTypeIPv6:
+		size = ipv6HeaderSize + int(binary.BigEndian.Uint16(payload[4:6]))
+	default:
+		return nil, false
+	}
+
+	if size > len(payload) {
+		return nil, false
+	}
+
+	return append([]byte{}, payload[:size]...), true
+}
@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"encoding/binary"
+	"github.com/songgao/packets/ethernet"
+	"net"
+	"net/netip"
+	"time"
+)
+
+const (
+	defaultRouterAdvertisementInterval = 3 * time.Minute
+
+	icmpv6RouterSolicitation  = 133
+	icmpv6RouterAdvertisement = 134
+	ndOptionPrefixInfo        = 3
+	ndOptionRDNSS             = 25
+	raMinSize                 = 16
+	raHopLimit                = 64
+	// raFlagsOnLinkAutonomous marks a prefix as on-link and usable for stateless address autoconfiguration
+	raFlagsOnLinkAutonomous = 0xc0
+	raPrefixValidLifetime   = 30 * 24 * time.Hour
+	raPrefixPreferLifetime  = 7 * 24 * time.Hour
+	// raMaxRouterLifetime is the maximum router lifetime of an advertisement
+	raMaxRouterLifetime = 9000 * time.Second
+)
+
+var allNodesMAC = net.HardwareAddr{0x33, 0x33, 0x00, 0x00, 0x00, 0x01}
+var allNodesIP = netip.MustParseAddr("ff02::1")
+
+// RouterAdvertisementConfig are the IPv6 router advertisements of the DHCP server
+type RouterAdvertisementConfig struct {
+	// Prefixes are the /64 prefixes announced for autoconfiguration, router advertisements are disabled if empty
+	Prefixes []netip.Prefix
+	// Interval is the interval unsolicited advertisements are sent in, 3 minutes if 0
+	Interval time.Duration
+	// RouterLifetime announces the server as default router if not 0, the server does not route itself
+	RouterLifetime time.Duration
+	// DNS are the recursive DNS servers announced to hosts, at most MaxDNSServers
+	DNS []netip.Addr
+}
+
+// advertise sends unsolicited router advertisements until the server is closed
+func (s *dhcpServer) advertise() {
+	ticker := time.NewTicker(s.cfg.RouterAdvertisement.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.send(s.routerAdvertisementFrame())
+
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// answerRouterSolicitation sends a router advertisement to all nodes if the frame is a router solicitation
+func (s *dhcpServer) answerRouterSolicitation(frame ethernet.Frame) {
+	if len(s.cfg.RouterAdvertisement.Prefixes) == 0 {
+		return
+	}
+
+	payload := frame[ethernetHeaderSize:]
+	if len(payload) < ipv6HeaderSize+8 || payload[7] != ndHopLimit || payload[ipv6HeaderSize] != icmpv6RouterSolicitation {
+		return
+	}
+
+	s.send(s.routerAdvertisementFrame())
+}
+
+func (s *dhcpServer) routerAdvertisementFrame() ethernet.Frame {
+	ra := s.cfg.RouterAdvertisement
+
+	icmp := make([]byte, raMinSize)
+	icmp[0] = icmpv6RouterAdvertisement
+	icmp[4] = raHopLimit
+	binary.BigEndian.PutUint16(icmp[6:8], uint16(min(ra.RouterLifetime, raMaxRouterLifetime)/time.Second))
+
+	icmp = append(icmp, ndOptionSourceLinkAddr, 1)
+	icmp = append(icmp, s.mac...)
+
+	for _, prefix := range ra.Prefixes {
+		icmp = append(icmp, ndOptionPrefixInfo, 4, byte(prefix.Bits()), raFlagsOnLinkAutonomous)
+		icmp = binary.BigEndian.AppendUint32(icmp, uint32(raPrefixValidLifetime/time.Second))
+		icmp = binary.BigEndian.AppendUint32(icmp, uint32(raPrefixPreferLifetime/time.Second))
+		icmp = append(icmp, 0, 0, 0, 0)
+		icmp = append(icmp, prefix.Masked().Addr().AsSlice()...)
+	}
+
+	if len(ra.DNS) > 0 {
+		// the servers stay valid for three intervals so a lost advertisement does not remove them
+		icmp = append(icmp, ndOptionRDNSS, byte(1+2*len(ra.DNS)), 0, 0)
+		icmp = binary.BigEndian.AppendUint32(icmp, uint32(3*ra.Interval/time.Second))
+
+		for _, dns := range ra.DNS {
+			icmp = append(icmp, dns.AsSlice()...)
+		}
+	}
+
+	return ipv6Frame(s.mac, s.linkLocal, allNodesMAC, allNodesIP, ipProtocolICMPv6, ndHopLimit, icmp)
+}
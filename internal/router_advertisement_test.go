@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/songgao/packets/ethernet"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// testRouterSolicitation returns a router solicitation of a host
+func testRouterSolicitation(hopLimit uint8) ethernet.Frame {
+	allRoutersMAC := testMAC("33:33:00:00:00:02")
+	return ipv6Frame(testMAC("02:00:00:00:00:01"), netip.MustParseAddr("fe80::1"), allRoutersMAC, netip.MustParseAddr("ff02::2"),
+		ipProtocolICMPv6, hopLimit, []byte{icmpv6RouterSolicitation, 0, 0, 0, 0, 0, 0, 0})
+}
+
+func TestDHCPServerRouterAdvertisement(t *testing.T) {
+	cfg := DHCPServerConfig{
+		MAC: testServerMAC,
+		RouterAdvertisement: RouterAdvertisementConfig{
+			Prefixes:       []netip.Prefix{netip.MustParsePrefix("2001:db8::/64")},
+			Interval:       time.Hour,
+			RouterLifetime: time.Hour,
+			DNS:            []netip.Addr{netip.MustParseAddr("2001:db8::53")},
+		},
+	}
+
+	s := newTestDHCPServer(t, cfg)
+
+	// an advertisement is sent on start and as answer to solicitations
+	frames := []ethernet.Frame{expectServerFrame(t, s, true)}
+
+	err := s.Write(testRouterSolicitation(ndHopLimit))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames = append(frames, expectServerFrame(t, s, true))
+
+	for _, frame := range frames {
+		if !bytes.Equal(frame.Destination(), allNodesMAC) {
+			t.Fatalf("advertisement was sent to %s", frame.Destination())
+		}
+
+		packet := frame[ethernetHeaderSize:]
+		icmp := packet[ipv6HeaderSize:]
+		source := netip.AddrFrom16([16]byte(packet[8:24]))
+
+		if icmp[0] != icmpv6RouterAdvertisement || source != linkLocalAddr(testServerMAC) {
+			t.Fatalf("frame of %s is not a router advertisement", source)
+		}
+
+		if pseudoHeaderChecksum(source, allNodesIP, ipProtocolICMPv6, icmp) != 0 {
+			t.Fatal("checksum is invalid")
+		}
+
+		if binary.BigEndian.Uint16(icmp[6:8]) != uint16(time.Hour/time.Second) {
+			t.Fatalf("router lifetime is %d", binary.BigEndian.Uint16(icmp[6:8]))
+		}
+
+		// source link address, prefix information and dns options
+		options := map[byte][]byte{}
+		for o := icmp[raMinSize:]; len(o) >= 8; o = o[int(o[1])*8:] {
+			options[o[0]] = o[2 : int(o[1])*8]
+		}
+
+		prefix, ok := options[ndOptionPrefixInfo]
+		if !ok || prefix[0] != 64 || netip.AddrFrom16([16]byte(prefix[14:30])) != netip.MustParseAddr("2001:db8::") {
+			t.Fatal("prefix information is invalid")
+		}
+
+		dns, ok := options[ndOptionRDNSS]
+		if !ok || netip.AddrFrom16([16]byte(dns[6:22])) != netip.MustParseAddr("2001:db8::53") {
+			t.Fatal("dns option is invalid")
+		}
+
+		if !bytes.Equal(options[ndOptionSourceLinkAddr], testServerMAC) {
+			t.Fatal("source link address is invalid")
+		}
+	}
+
+	// solicitations that were routed are ignored
+	err = s.Write(testRouterSolicitation(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectServerFrame(t, s, false)
+}
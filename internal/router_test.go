@@ -0,0 +1,473 @@
+package internal
+
+import (
+	"bytes"
+	"github.com/songgao/packets/ethernet"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+var (
+	testRouterMACA = testMAC("02:00:00:00:01:0a")
+	testRouterMACB = testMAC("02:00:00:00:01:0b")
+	testHostMACA   = testMAC("02:00:00:00:00:0a")
+	testHostMACB   = testMAC("02:00:00:00:00:0b")
+)
+
+// testRouterConfig returns a router between 10.0.1.0/24 and fd01::/64 on interface a and 10.0.2.0/24 and fd02::/64
+// on interface b, 192.168.0.0/16 and 2001:db8::/32 are routed to hosts on b and 192.168.1.0/24 to a host on a
+func testRouterConfig() RouterConfig {
+	return RouterConfig{
+		Name: "test",
+		Interfaces: []RouterInterfaceConfig{
+			{
+				Name:      "a",
+				MAC:       testRouterMACA,
+				Addresses: []netip.Prefix{netip.MustParsePrefix("10.0.1.1/24"), netip.MustParsePrefix("fd01::1/64")},
+			},
+			{
+				Name:      "b",
+				MAC:       testRouterMACB,
+				Addresses: []netip.Prefix{netip.MustParsePrefix("10.0.2.1/24"), netip.MustParsePrefix("fd02::1/64")},
+			},
+		},
+		Routes: []Route{
+			{Prefix: netip.MustParsePrefix("192.168.0.0/16"), Via: netip.MustParseAddr("10.0.2.20")},
+			{Prefix: netip.MustParsePrefix("192.168.1.0/24"), Via: netip.MustParseAddr("10.0.1.20")},
+			{Prefix: netip.MustParsePrefix("2001:db8::/32"), Via: netip.MustParseAddr("fd02::20")},
+		},
+	}
+}
+
+func newTestRouter(t *testing.T) *router {
+	t.Helper()
+
+	r, err := NewRouter(testRouterConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		for _, port := range r.Interfaces() {
+			_ = port.Close()
+		}
+	})
+
+	// every interface announces its IPv4 address once started
+	for _, iface := range r.(*router).interfaces {
+		expectInterfaceFrame(t, iface, true)
+	}
+
+	return r.(*router)
+}
+
+// expectInterfaceFrame returns the next frame sent by a router interface
+func expectInterfaceFrame(t *testing.T, i *routerInterface, expected bool) ethernet.Frame {
+	t.Helper()
+
+	return expectQueuedFrame(t, "switch of interface "+i.name, i.frames, expected)
+}
+
+// expectNeighborPacket returns the ARP or neighbor discovery packet of the next frame sent by a router interface
+func expectNeighborPacket(t *testing.T, i *routerInterface) neighborPacket {
+	t.Helper()
+
+	frame := expectInterfaceFrame(t, i, true)
+	p, ok := parseNeighborPacket(frame, parseFrame(frame))
+	if !ok {
+		t.Fatalf("interface %s sent frame to %s that is not an ARP or neighbor discovery packet", i.name, frame.Destination())
+	}
+
+	return p
+}
+
+// testEcho returns an ICMP or ICMPv6 echo request
+func testEcho(echoType byte) []byte {
+	echo := []byte{echoType, 0, 0, 0, 0, 1, 0, 1, 't', 'e', 's', 't'}
+	if echoType == icmpEchoRequest {
+		c := checksumFold(checksumAdd(0, echo))
+		echo[2], echo[3] = byte(c>>8), byte(c)
+	}
+
+	return echo
+}
+
+func TestNewRouterRejectsUnreachableNextHop(t *testing.T) {
+	cfg := testRouterConfig()
+	cfg.Routes = append(cfg.Routes, Route{Prefix: netip.MustParsePrefix("172.16.0.0/12"), Via: netip.MustParseAddr("10.0.3.1")})
+
+	_, err := NewRouter(cfg)
+	if err == nil {
+		t.Fatal("router with unreachable next hop was created")
+	}
+}
+
+func TestRouterRoute(t *testing.T) {
+	r := newTestRouter(t)
+
+	tests := []struct {
+		name        string
+		destination string
+		ok          bool
+		iface       string
+		nextHop     string
+	}{
+		{name: "connected", destination: "10.0.1.5", ok: true, iface: "a", nextHop: "10.0.1.5"},
+		{name: "connected ipv6", destination: "fd02::5", ok: true, iface: "b", nextHop: "fd02::5"},
+		{name: "static", destination: "192.168.5.5", ok: true, iface: "b", nextHop: "10.0.2.20"},
+		{name: "longest prefix", destination: "192.168.1.5", ok: true, iface: "a", nextHop: "10.0.1.20"},
+		{name: "static ipv6", destination: "2001:db8::5", ok: true, iface: "b", nextHop: "fd02::20"},
+		{name: "no route", destination: "172.16.0.1"},
+		{name: "no route ipv6", destination: "2001:db9::1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			iface, nextHop, ok := r.route(netip.MustParseAddr(test.destination))
+			if ok != test.ok {
+				t.Fatalf("route to %s found %t, expected %t", test.destination, ok, test.ok)
+			}
+
+			if !ok {
+				return
+			}
+
+			if iface.name != test.iface || nextHop != netip.MustParseAddr(test.nextHop) {
+				t.Fatalf("route to %s is via %s on %s, expected %s on %s", test.destination, nextHop, iface.name, test.nextHop, test.iface)
+			}
+		})
+	}
+}
+
+func TestRouterForward(t *testing.T) {
+	payload := udpDatagram(1000, 2000, []byte("test"))
+
+	tests := []struct {
+		name string
+		// frame is received on interface a and forwarded to the host with nextHop on interface b
+		frame   ethernet.Frame
+		nextHop string
+		// hopLimit is the offset of the TTL or hop limit in the packet, the bytes from unchanged on are not changed by forwarding
+		hopLimit  int
+		unchanged int
+		// answer answers the resolution of the next hop by the router
+		answer func(p neighborPacket) ethernet.Frame
+	}{
+		{
+			name:      "connected",
+			frame:     ipv4Frame(testHostMACA, netip.MustParseAddr("10.0.1.10"), testRouterMACA, netip.MustParseAddr("10.0.2.10"), ipProtocolUDP, 64, payload),
+			nextHop:   "10.0.2.10",
+			hopLimit:  8,
+			unchanged: 12,
+			answer: func(p neighborPacket) ethernet.Frame {
+				return arpReplyFrame(testHostMACB, p.targetIP, p.senderMAC, p.senderIP)
+			},
+		},
+		{
+			name:      "static",
+			frame:     ipv4Frame(testHostMACA, netip.MustParseAddr("10.0.1.10"), testRouterMACA, netip.MustParseAddr("192.168.5.5"), ipProtocolUDP, 64, payload),
+			nextHop:   "10.0.2.20",
+			hopLimit:  8,
+			unchanged: 12,
+			answer: func(p neighborPacket) ethernet.Frame {
+				return arpReplyFrame(testHostMACB, p.targetIP, p.senderMAC, p.senderIP)
+			},
+		},
+		{
+			name:      "connected ipv6",
+			frame:     ipv6Frame(testHostMACA, netip.MustParseAddr("fd01::10"), testRouterMACA, netip.MustParseAddr("fd02::10"), ipProtocolUDP, 64, payload),
+			nextHop:   "fd02::10",
+			hopLimit:  7,
+			unchanged: 8,
+			answer: func(p neighborPacket) ethernet.Frame {
+				return neighborAdvertisementFrame(testHostMACB, p.targetIP, p.senderMAC, p.senderIP)
+			},
+		},
+		{
+			name:      "static ipv6",
+			frame:     ipv6Frame(testHostMACA, netip.MustParseAddr("fd01::10"), testRouterMACA, netip.MustParseAddr("2001:db8::5"), ipProtocolUDP, 64, payload),
+			nextHop:   "fd02::20",
+			hopLimit:  7,
+			unchanged: 8,
+			answer: func(p neighborPacket) ethernet.Frame {
+				return neighborAdvertisementFrame(testHostMACB, p.targetIP, p.senderMAC, p.senderIP)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			a, b := r.interfaces[0], r.interfaces[1]
+
+			// the packet waits for the resolution of its next hop
+			_ = a.Write(append(ethernet.Frame{}, test.frame...))
+
+			p := expectNeighborPacket(t, b)
+			if !p.request || p.targetIP != netip.MustParseAddr(test.nextHop) || !bytes.Equal(p.senderMAC, testRouterMACB) {
+				t.Fatalf("interface b sent %+v, expected request for %s", p, test.nextHop)
+			}
+
+			if !b.local(p.senderIP) {
+				t.Fatalf("request is sent from %s that is not an address of interface b", p.senderIP)
+			}
+
+			_ = b.Write(test.answer(p))
+
+			// packets to a resolved next hop are forwarded without resolution
+			_ = a.Write(append(ethernet.Frame{}, test.frame...))
+
+			for range 2 {
+				frame := expectInterfaceFrame(t, b, true)
+				if !bytes.Equal(frame.Destination(), testHostMACB) || !bytes.Equal(frame.Source(), testRouterMACB) {
+					t.Fatalf("frame was forwarded from %s to %s, expected from %s to %s", frame.Source(), frame.Destination(), testRouterMACB, testHostMACB)
+				}
+
+				packet, expected := frame.Payload(), test.frame.Payload()
+				if packet[test.hopLimit] != expected[test.hopLimit]-1 {
+					t.Fatalf("forwarded packet has hop limit %d, expected %d", packet[test.hopLimit], expected[test.hopLimit]-1)
+				}
+
+				if test.frame.Ethertype() == ethernet.IPv4 && checksumFold(checksumAdd(0, packet[:ipv4MinHeaderSize])) != 0 {
+					t.Fatal("forwarded packet has invalid header checksum")
+				}
+
+				if !bytes.Equal(packet[:test.hopLimit], expected[:test.hopLimit]) || !bytes.Equal(packet[test.unchanged:], expected[test.unchanged:]) {
+					t.Fatal("forwarded packet differs from the received packet")
+				}
+			}
+
+			expectInterfaceFrame(t, a, false)
+			expectInterfaceFrame(t, b, false)
+		})
+	}
+}
+
+func TestRouterForwardDrops(t *testing.T) {
+	payload := udpDatagram(1000, 2000, []byte("test"))
+	hostA := netip.MustParseAddr("10.0.1.10")
+	hostA6 := netip.MustParseAddr("fd01::10")
+
+	tests := []struct {
+		name  string
+		frame ethernet.Frame
+	}{
+		{
+			name:  "ttl exceeded",
+			frame: ipv4Frame(testHostMACA, hostA, testRouterMACA, netip.MustParseAddr("10.0.2.10"), ipProtocolUDP, 1, payload),
+		},
+		{
+			name:  "hop limit exceeded",
+			frame: ipv6Frame(testHostMACA, hostA6, testRouterMACA, netip.MustParseAddr("fd02::10"), ipProtocolUDP, 1, payload),
+		},
+		{
+			name:  "link-local source",
+			frame: ipv6Frame(testHostMACA, netip.MustParseAddr("fe80::10"), testRouterMACA, netip.MustParseAddr("fd02::10"), ipProtocolUDP, 64, payload),
+		},
+		{
+			name:  "other destination mac",
+			frame: ipv4Frame(testHostMACA, hostA, testHostMACB, netip.MustParseAddr("10.0.2.10"), ipProtocolUDP, 64, payload),
+		},
+		{
+			name:  "link-local destination",
+			frame: ipv4Frame(testHostMACA, hostA, testRouterMACA, netip.MustParseAddr("169.254.0.10"), ipProtocolUDP, 64, payload),
+		},
+		{
+			name:  "multicast destination",
+			frame: ipv6Frame(testHostMACA, hostA6, testRouterMACA, netip.MustParseAddr("ff0e::10"), ipProtocolUDP, 64, payload),
+		},
+		{
+			name:  "no route",
+			frame: ipv4Frame(testHostMACA, hostA, testRouterMACA, netip.MustParseAddr("172.16.0.1"), ipProtocolUDP, 64, payload),
+		},
+		{
+			name:  "double tagged",
+			frame: testStacked(ipv4Frame(testHostMACA, hostA, testRouterMACA, netip.MustParseAddr("10.0.2.10"), ipProtocolUDP, 64, payload), 0x88a8),
+		},
+		{
+			name:  "truncated packet",
+			frame: ipv4Frame(testHostMACA, hostA, testRouterMACA, netip.MustParseAddr("10.0.2.10"), ipProtocolUDP, 64, payload)[:ethernetHeaderSize+ipv4MinHeaderSize+4],
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newTestRouter(t)
+
+			_ = r.interfaces[0].Write(test.frame)
+
+			expectInterfaceFrame(t, r.interfaces[0], false)
+			expectInterfaceFrame(t, r.interfaces[1], false)
+		})
+	}
+}
+
+func TestRouterAnswersEcho(t *testing.T) {
+	hostA := netip.MustParseAddr("10.0.1.10")
+	hostA6 := netip.MustParseAddr("fd01::10")
+
+	tests := []struct {
+		name     string
+		frame    ethernet.Frame
+		answered bool
+	}{
+		{
+			name:     "echo request",
+			frame:    ipv4Frame(testHostMACA, hostA, testRouterMACA, netip.MustParseAddr("10.0.1.1"), ipProtocolICMP, 64, testEcho(icmpEchoRequest)),
+			answered: true,
+		},
+		{
+			name:     "echo request to other interface",
+			frame:    ipv4Frame(testHostMACA, hostA, testRouterMACA, netip.MustParseAddr("10.0.2.1"), ipProtocolICMP, 64, testEcho(icmpEchoRequest)),
+			answered: true,
+		},
+		{
+			name:     "ipv6 echo request",
+			frame:    ipv6Frame(testHostMACA, hostA6, testRouterMACA, netip.MustParseAddr("fd01::1"), ipProtocolICMPv6, 64, testEcho(icmpv6EchoRequest)),
+			answered: true,
+		},
+		{
+			name:     "link-local echo request",
+			frame:    ipv6Frame(testHostMACA, netip.MustParseAddr("fe80::10"), testRouterMACA, linkLocalAddr(testRouterMACA), ipProtocolICMPv6, 64, testEcho(icmpv6EchoRequest)),
+			answered: true,
+		},
+		{
+			name:  "echo reply",
+			frame: ipv4Frame(testHostMACA, hostA, testRouterMACA, netip.MustParseAddr("10.0.1.1"), ipProtocolICMP, 64, testEcho(icmpEchoReply)),
+		},
+		{
+			name:  "udp",
+			frame: ipv4Frame(testHostMACA, hostA, testRouterMACA, netip.MustParseAddr("10.0.1.1"), ipProtocolUDP, 64, udpDatagram(1000, 2000, nil)),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			a := r.interfaces[0]
+
+			_ = a.Write(test.frame)
+
+			reply := expectInterfaceFrame(t, a, test.answered)
+			expectInterfaceFrame(t, r.interfaces[1], false)
+
+			if !test.answered {
+				return
+			}
+
+			if !bytes.Equal(reply.Destination(), testHostMACA) || !bytes.Equal(reply.Source(), testRouterMACA) {
+				t.Fatalf("reply was sent from %s to %s, expected from %s to %s", reply.Source(), reply.Destination(), testRouterMACA, testHostMACA)
+			}
+
+			request, replyInfo := parseFrame(test.frame), parseFrame(reply)
+			if !bytes.Equal(replyInfo.sourceIP, request.destinationIP) || !bytes.Equal(replyInfo.destinationIP, request.sourceIP) {
+				t.Fatalf("reply was sent from %s to %s, expected from %s to %s",
+					net.IP(replyInfo.sourceIP), net.IP(replyInfo.destinationIP), net.IP(request.destinationIP), net.IP(request.sourceIP))
+			}
+
+			echo := reply[replyInfo.transportOffset:]
+			source, _ := netip.AddrFromSlice(replyInfo.sourceIP)
+			destination, _ := netip.AddrFromSlice(replyInfo.destinationIP)
+
+			switch replyInfo.protocol {
+			case ipProtocolICMP:
+				if echo[0] != icmpEchoReply || checksumFold(checksumAdd(0, echo)) != 0 {
+					t.Fatalf("reply has type %d and checksum %x, expected a valid echo reply", echo[0], echo[2:4])
+				}
+			case ipProtocolICMPv6:
+				if echo[0] != icmpv6EchoReply || pseudoHeaderChecksum(source, destination, ipProtocolICMPv6, echo) != 0 {
+					t.Fatalf("reply has type %d and checksum %x, expected a valid echo reply", echo[0], echo[2:4])
+				}
+			}
+
+			if !bytes.Equal(echo[4:], test.frame[parseFrame(test.frame).transportOffset+4:]) {
+				t.Fatal("reply differs from the request")
+			}
+		})
+	}
+}
+
+func TestRouterAnswersNeighbors(t *testing.T) {
+	hostA := netip.MustParseAddr("10.0.1.10")
+	hostA6 := netip.MustParseAddr("fd01::10")
+
+	tests := []struct {
+		name     string
+		frame    ethernet.Frame
+		answered bool
+	}{
+		{
+			name:     "arp request",
+			frame:    arpRequestFrame(testHostMACA, hostA, netip.MustParseAddr("10.0.1.1")),
+			answered: true,
+		},
+		{
+			name:     "neighbor solicitation",
+			frame:    neighborSolicitationFrame(testHostMACA, hostA6, netip.MustParseAddr("fd01::1")),
+			answered: true,
+		},
+		{
+			name:     "link-local neighbor solicitation",
+			frame:    neighborSolicitationFrame(testHostMACA, netip.MustParseAddr("fe80::10"), linkLocalAddr(testRouterMACA)),
+			answered: true,
+		},
+		{
+			name:  "arp request for other host",
+			frame: arpRequestFrame(testHostMACA, hostA, netip.MustParseAddr("10.0.1.20")),
+		},
+		{
+			name:  "arp request for other interface",
+			frame: arpRequestFrame(testHostMACA, hostA, netip.MustParseAddr("10.0.2.1")),
+		},
+		{
+			name:  "gratuitous arp",
+			frame: arpRequestFrame(testHostMACA, netip.MustParseAddr("10.0.1.1"), netip.MustParseAddr("10.0.1.1")),
+		},
+		{
+			name:  "duplicate address detection",
+			frame: neighborSolicitationFrame(testHostMACA, netip.IPv6Unspecified(), netip.MustParseAddr("fd01::1")),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			a := r.interfaces[0]
+
+			_ = a.Write(test.frame)
+
+			if !test.answered {
+				expectInterfaceFrame(t, a, false)
+				return
+			}
+
+			request, _ := parseNeighborPacket(test.frame, parseFrame(test.frame))
+
+			p := expectNeighborPacket(t, a)
+			if p.request || p.gratuitous || p.senderIP != request.targetIP || !bytes.Equal(p.senderMAC, testRouterMACA) {
+				t.Fatalf("interface a sent %+v, expected reply for %s", p, request.targetIP)
+			}
+		})
+	}
+}
+
+func TestRouterLearnsNeighbors(t *testing.T) {
+	r := newTestRouter(t)
+	a := r.interfaces[0]
+
+	// requests of hosts on the link teach the router their hardware address
+	_ = a.Write(arpRequestFrame(testHostMACA, netip.MustParseAddr("10.0.1.10"), netip.MustParseAddr("10.0.1.1")))
+	expectInterfaceFrame(t, a, true)
+
+	// hosts outside the connected subnets are not learned
+	_ = a.Write(arpRequestFrame(testHostMACB, netip.MustParseAddr("10.0.3.10"), netip.MustParseAddr("10.0.1.1")))
+	expectInterfaceFrame(t, a, true)
+
+	for _, ip := range []string{"10.0.1.10", "10.0.3.10"} {
+		_, ok := a.neighbors.neighbors[netip.MustParseAddr(ip)]
+		if ok != (ip == "10.0.1.10") {
+			t.Fatalf("neighbor %s learned %t", ip, ok)
+		}
+	}
+}
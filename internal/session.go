@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"crypto/cipher"
+	"errors"
+	"github.com/lucasl0st/trestle/internal/util"
+	"github.com/lucasl0st/trestle/pkg/packet"
+	"golang.org/x/crypto/chacha20poly1305"
+	"google.golang.org/protobuf/proto"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// session holds the transport keys of an established peer session
+type session struct {
+	remoteStatic [KeySize]byte
+	localIndex   uint32
+	remoteIndex  uint32
+
+	send    cipher.AEAD
+	receive cipher.AEAD
+
+	sendCounter atomic.Uint64
+	window      *util.ReplayWindow
+
+	received  atomic.Uint64
+	replayed  atomic.Uint64
+	reordered atomic.Uint64
+	dropped   atomic.Uint64
+
+	// unix nanoseconds of the last authenticated packet
+	lastReceivedAt atomic.Int64
+}
+
+// SessionStatistics are the receive statistics of a peer session
+type SessionStatistics struct {
+	// Received is the amount of authenticated packets received
+	Received uint64
+	// Replayed is the amount of packets dropped because their counter was already seen or is too old
+	Replayed uint64
+	// Reordered is the amount of packets received with a lower counter than an earlier packet
+	Reordered uint64
+	// Lost is the amount of packets with a counter lower than the highest seen counter that were never received
+	Lost uint64
+	// Dropped is the amount of authenticated packets dropped because the port of the peer was congested
+	Dropped uint64
+}
+
+func newSession(hs *handshake) (*session, error) {
+	sendKey, receiveKey := hs.transportKeys()
+
+	send, err := chacha20poly1305.New(sendKey[:])
+	if err != nil {
+		return nil, err
+	}
+
+	receive, err := chacha20poly1305.New(receiveKey[:])
+	if err != nil {
+		return nil, err
+	}
+
+	s := &session{
+		remoteStatic: hs.remoteStatic,
+		localIndex:   hs.localIndex,
+		remoteIndex:  hs.remoteIndex,
+		send:         send,
+		receive:      receive,
+		window:       util.NewReplayWindow(),
+	}
+
+	s.lastReceivedAt.Store(time.Now().UnixNano())
+	return s, nil
+}
+
+// transportOverhead returns the amount of bytes a packet grows when sealed into a TRANSPORT packet
+func transportOverhead(networkMTU uint32) int {
+	p := &packet.Packet{
+		Type: packet.PacketType_TRANSPORT,
+		Payload: &packet.Packet_Transport{
+			Transport: &packet.Transport{
+				Counter:    math.MaxUint64,
+				Ciphertext: make([]byte, networkMTU),
+				Receiver:   math.MaxUint32,
+			},
+		},
+	}
+
+	b, err := proto.Marshal(p)
+	if err != nil {
+		panic(err)
+	}
+
+	return len(b) - int(networkMTU) + chacha20poly1305.Overhead
+}
+
+func (s *session) seal(p *packet.Packet) (*packet.Packet, error) {
+	plaintext, err := proto.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	counter := s.sendCounter.Add(1) - 1
+	if counter == math.MaxUint64 {
+		return nil, errors.New("session counter exhausted")
+	}
+
+	return &packet.Packet{
+		Type: packet.PacketType_TRANSPORT,
+		Payload: &packet.Packet_Transport{
+			Transport: &packet.Transport{
+				Counter:    counter,
+				Ciphertext: s.send.Seal(nil, noiseNonce(counter), plaintext, nil),
+				Receiver:   s.remoteIndex,
+			},
+		},
+	}, nil
+}
+
+func (s *session) open(t *packet.Transport) (*packet.Packet, error) {
+	// cheap check before decrypting, the counter is only marked as seen once the packet is authenticated
+	if !s.window.Check(t.Counter) {
+		s.replayed.Add(1)
+		return nil, errors.New("replayed counter")
+	}
+
+	plaintext, err := s.receive.Open(nil, noiseNonce(t.Counter), t.Ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	reordered := t.Counter < s.window.Highest()
+
+	if !s.window.Accept(t.Counter) {
+		s.replayed.Add(1)
+		return nil, errors.New("replayed counter")
+	}
+
+	s.received.Add(1)
+	s.lastReceivedAt.Store(time.Now().UnixNano())
+	if reordered {
+		s.reordered.Add(1)
+	}
+
+	var p packet.Packet
+	err = proto.Unmarshal(plaintext, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (s *session) lastReceived() time.Time {
+	return time.Unix(0, s.lastReceivedAt.Load())
+}
+
+func (s *session) statistics() SessionStatistics {
+	received := s.received.Load()
+
+	var lost uint64
+	if received > 0 && s.window.Highest()+1 > received {
+		lost = s.window.Highest() + 1 - received
+	}
+
+	return SessionStatistics{
+		Received:  received,
+		Replayed:  s.replayed.Load(),
+		Reordered: s.reordered.Load(),
+		Lost:      lost,
+		Dropped:   s.dropped.Load(),
+	}
+}
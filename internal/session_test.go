@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"github.com/lucasl0st/trestle/pkg/packet"
+	"google.golang.org/protobuf/proto"
+	"testing"
+)
+
+// testSessions returns the sessions of both sides of a completed handshake
+func testSessions(t *testing.T) (*session, *session) {
+	t.Helper()
+
+	initiator, responder, err := testHandshake(t, testKeyPair(t), testKeyPair(t), [KeySize]byte{}, [KeySize]byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initiator.localIndex, initiator.remoteIndex = 1, 2
+	responder.localIndex, responder.remoteIndex = 2, 1
+
+	a, err := newSession(initiator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := newSession(responder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a, b
+}
+
+func testPacket() *packet.Packet {
+	return &packet.Packet{
+		Type: packet.PacketType_FRAGMENTED_DATA,
+		Payload: &packet.Packet_FragmentedData{
+			FragmentedData: &packet.FragmentedData{Id: 1, FragmentMax: 1, Payload: []byte("frame")},
+		},
+	}
+}
+
+func TestSessionSealOpen(t *testing.T) {
+	a, b := testSessions(t)
+
+	for i := 0; i < 3; i++ {
+		sealed, err := a.seal(testPacket())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		transport := sealed.GetTransport()
+		if transport.Receiver != b.localIndex {
+			t.Fatalf("receiver index is %d, expected %d", transport.Receiver, b.localIndex)
+		}
+
+		opened, err := b.open(transport)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !proto.Equal(opened, testPacket()) {
+			t.Fatalf("opened packet is %v", opened)
+		}
+	}
+
+	if b.statistics().Received != 3 {
+		t.Fatalf("received is %d, expected 3", b.statistics().Received)
+	}
+}
+
+func TestSessionTamperedCiphertext(t *testing.T) {
+	a, b := testSessions(t)
+
+	sealed, err := a.seal(testPacket())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := sealed.GetTransport()
+	transport.Ciphertext[0] ^= 0x01
+
+	_, err = b.open(transport)
+	if err == nil {
+		t.Fatal("tampered ciphertext was accepted")
+	}
+
+	// a failed authentication must not mark the counter as seen
+	transport.Ciphertext[0] ^= 0x01
+
+	_, err = b.open(transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionTamperedCounter(t *testing.T) {
+	a, b := testSessions(t)
+
+	sealed, err := a.seal(testPacket())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := sealed.GetTransport()
+	transport.Counter++
+
+	_, err = b.open(transport)
+	if err == nil {
+		t.Fatal("packet with a changed counter was accepted")
+	}
+}
+
+func TestSessionReplay(t *testing.T) {
+	a, b := testSessions(t)
+
+	sealed, err := a.seal(testPacket())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = b.open(sealed.GetTransport())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = b.open(sealed.GetTransport())
+	if err == nil {
+		t.Fatal("replayed packet was accepted")
+	}
+
+	if b.statistics().Replayed != 1 {
+		t.Fatalf("replayed is %d, expected 1", b.statistics().Replayed)
+	}
+}
+
+func TestSessionWrongDirection(t *testing.T) {
+	a, _ := testSessions(t)
+
+	sealed, err := a.seal(testPacket())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the send and receive keys differ, so a reflected packet does not authenticate
+	_, err = a.open(sealed.GetTransport())
+	if err == nil {
+		t.Fatal("reflected packet was accepted")
+	}
+}
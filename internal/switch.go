@@ -2,70 +2,243 @@ package internal
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/lucasl0st/trestle/internal/util"
 	"github.com/songgao/packets/ethernet"
 	"log/slog"
+	"sort"
+	"sync/atomic"
+	"time"
 )
 
 type Switch interface {
-	AddPort(port Port) uint
+	AddPort(port Port, cfg PortConfig) uint
 	RemovePort(uint)
+	Status() SwitchStatus
+	// SetMirroring enables or disables the port mirroring session of the switch
+	SetMirroring(enabled bool)
+	Mirroring() bool
+	// Bindings returns the known IP to hardware address bindings including snooped DHCP leases
+	Bindings() []Binding
 	Close() error
 }
 
-type ethernetSwitch struct {
-	name string
+const defaultMACAgingTime = 5 * time.Minute
+
+// logInterval is the interval events that hosts or peers can cause at a high rate are logged in at most once
+const logInterval = time.Second
+
+type SwitchConfig struct {
+	Name string
+	// MACAgingTime is the duration after which learned hardware addresses that were not seen are removed
+	MACAgingTime time.Duration
+	// MaxMACs is the maximum amount of hardware addresses learned on the switch, 0 is unlimited
+	MaxMACs int
+	// Mirror is the port mirroring session of the switch, mirroring is not possible without monitor port
+	Mirror MirrorConfig
+	// Capture is the capture of the traffic of the switch into pcapng files
+	Capture CaptureConfig
+	// Neighbor is the snooping of ARP and IPv6 neighbor discovery
+	Neighbor NeighborConfig
+	// DHCPSnooping drops DHCP server messages from untrusted ports and binds the leases of trusted servers
+	DHCPSnooping bool
+}
 
-	ports      *util.SafeMap[uint, Port]
-	portActive *util.SafeMap[uint, bool]
+// SwitchStatus are the counters of a switch for debugging
+type SwitchStatus struct {
+	MACs             int
+	MACMoves         uint64
+	MACLimitExceeded uint64
+	// Bindings is the amount of known IP to hardware address bindings
+	Bindings int
+	// NeighborDrops is the amount of ARP and neighbor discovery packets dropped for contradicting a binding
+	NeighborDrops uint64
+	// NeighborReplies is the amount of ARP requests and neighbor solicitations answered by the switch
+	NeighborReplies uint64
+	// DHCPDrops is the amount of DHCP server messages dropped for being received on an untrusted port
+	DHCPDrops uint64
+	Ports     []PortStatus
+}
 
-	hardwareAddr   *util.SafeMap[string, uint]
-	outgoingFrames *util.SafeMap[uint, *util.Queue[ethernet.Frame]]
+// PortStatus are the counters of a port for debugging
+type PortStatus struct {
+	Id   uint
+	Name string
+	// Queued is the amount of frames waiting in the egress queue
+	Queued int
+	// Drops is the amount of frames dropped because the port was congested
+	Drops   uint64
+	Classes []ClassStatus
+	// IngressRateDrops is the amount of received frames dropped by the ingress rate limit
+	IngressRateDrops uint64
+	// EgressRateDrops is the amount of frames dropped by the egress rate limit
+	EgressRateDrops uint64
+	// StormDrops is the amount of received frames dropped by storm control
+	StormDrops uint64
+	// IngressACLDrops is the amount of received frames denied by the ingress ACL
+	IngressACLDrops uint64
+	// EgressACLDrops is the amount of frames denied by the egress ACL
+	EgressACLDrops uint64
+	// SecurityViolations is the amount of received frames violating the port security
+	SecurityViolations uint64
+	// Shutdown is set if the port was shut down by a port security violation
+	Shutdown bool
+}
 
-	portId uint
+type ethernetSwitch struct {
+	name         string
+	macAgingTime time.Duration
+	done         chan struct{}
+
+	ports       *util.SafeMap[uint, Port]
+	portNames   *util.SafeMap[string, uint]
+	portActive  *util.SafeMap[uint, bool]
+	portConfigs *util.SafeMap[uint, PortConfig]
+	limiters    *util.SafeMap[uint, *portLimiter]
+	aclDrops    *util.SafeMap[uint, *aclCounters]
+	security    *util.SafeMap[uint, *portSecurityState]
+
+	hardwareAddr *macTable
+	// mac -> portId the mac is secured on
+	secureMACs     *util.SafeMap[[6]byte, uint]
+	outgoingFrames *util.SafeMap[uint, *egressQueue]
+
+	// portId is the id of the next added port, ports are added concurrently by the listener and main
+	portId atomic.Uint64
+
+	macMoves         atomic.Uint64
+	macLimitExceeded atomic.Uint64
+	macMoveLog       *util.LogLimiter
+
+	mirror    MirrorConfig
+	mirroring atomic.Bool
+
+	capture *capture
+
+	neighbor        NeighborConfig
+	bindings        *bindingTable
+	neighborDrops   atomic.Uint64
+	neighborReplies atomic.Uint64
+	neighborLog     *util.LogLimiter
+
+	dhcpSnooping bool
+	dhcpDrops    atomic.Uint64
+	dhcpLog      *util.LogLimiter
 }
 
 var broadcastMac = []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
 
-func NewSwitch(name string) Switch {
-	return &ethernetSwitch{
-		name:           name,
+const ethernetHeaderSize = 14
+
+type floodType int
+
+const (
+	floodBroadcast floodType = iota
+	floodMulticast
+	floodUnknownUnicast
+)
+
+func NewSwitch(cfg SwitchConfig) (Switch, error) {
+	if cfg.MACAgingTime == 0 {
+		cfg.MACAgingTime = defaultMACAgingTime
+	}
+
+	if cfg.Neighbor.BindingTimeout == 0 {
+		cfg.Neighbor.BindingTimeout = cfg.MACAgingTime
+	}
+
+	c, err := newCapture(cfg.Name, cfg.Capture)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start capture with error: %v", err)
+	}
+
+	e := &ethernetSwitch{
+		name:           cfg.Name,
+		macAgingTime:   cfg.MACAgingTime,
+		done:           make(chan struct{}),
 		ports:          util.NewSafeMap[uint, Port](),
+		portNames:      util.NewSafeMap[string, uint](),
 		portActive:     util.NewSafeMap[uint, bool](),
-		hardwareAddr:   util.NewSafeMap[string, uint](),
-		outgoingFrames: util.NewSafeMap[uint, *util.Queue[ethernet.Frame]](),
+		portConfigs:    util.NewSafeMap[uint, PortConfig](),
+		limiters:       util.NewSafeMap[uint, *portLimiter](),
+		aclDrops:       util.NewSafeMap[uint, *aclCounters](),
+		security:       util.NewSafeMap[uint, *portSecurityState](),
+		secureMACs:     util.NewSafeMap[[6]byte, uint](),
+		hardwareAddr:   newMacTable(cfg.MaxMACs),
+		outgoingFrames: util.NewSafeMap[uint, *egressQueue](),
+		mirror:         cfg.Mirror,
+		capture:        c,
+		neighbor:       cfg.Neighbor,
+		bindings:       newBindingTable(),
+		dhcpSnooping:   cfg.DHCPSnooping,
+		macMoveLog:     util.NewLogLimiter(logInterval),
+		neighborLog:    util.NewLogLimiter(logInterval),
+		dhcpLog:        util.NewLogLimiter(logInterval),
 	}
+
+	e.SetMirroring(cfg.Mirror.Enabled)
+
+	go e.ageMACs()
+	return e, nil
 }
 
-func (e *ethernetSwitch) AddPort(port Port) uint {
-	portId := e.portId
-	e.portId++
+func (e *ethernetSwitch) AddPort(port Port, cfg PortConfig) uint {
+	portId := uint(e.portId.Add(1) - 1)
 
+	e.ports.Set(portId, port)
+	e.portNames.Set(port.Name(), portId)
+	e.portConfigs.Set(portId, cfg)
+	e.limiters.Set(portId, newPortLimiter(cfg))
+	e.aclDrops.Set(portId, &aclCounters{})
+	e.security.Set(portId, &portSecurityState{log: util.NewLogLimiter(logInterval)})
+	e.addSecureMACs(portId, cfg)
 	e.portActive.Set(portId, true)
-	e.outgoingFrames.Set(portId, util.NewQueue[ethernet.Frame](500))
+	queue := newEgressQueue(cfg.Queue, cfg.QoS)
+	e.outgoingFrames.Set(portId, queue)
 
 	go e.read(port, portId)
-	go e.write(port, portId)
+	go e.write(port, portId, queue)
 
-	slog.Info("added port", "switch", e.name, "portId", portId)
+	slog.Info("added port", "switch", e.name, "portId", portId, "port", port.Name())
 	return portId
 }
 
 func (e *ethernetSwitch) RemovePort(portId uint) {
 	e.portActive.Set(portId, false)
-	e.outgoingFrames.Delete(portId)
+
+	queue, ok := e.outgoingFrames.Get(portId)
+	if ok {
+		e.outgoingFrames.Delete(portId)
+		queue.close()
+	}
+
+	e.hardwareAddr.removePort(portId)
+	e.removeSecureMACs(portId)
+	e.bindings.removePort(portId)
 
 	port, ok := e.ports.Get(portId)
 	if !ok {
 		return
 	}
 
+	e.ports.Delete(portId)
+	e.portConfigs.Delete(portId)
+
+	namedPortId, ok := e.portNames.Get(port.Name())
+	if ok && namedPortId == portId {
+		e.portNames.Delete(port.Name())
+	}
+
+	e.limiters.Delete(portId)
+	e.aclDrops.Delete(portId)
+	e.security.Delete(portId)
+
 	err := port.Close()
 	if err != nil {
-		slog.Error("failed to close port", "switch", e.name, "portId", portId, "error", err)
+		slog.Error("failed to close port", "switch", e.name, "portId", portId, "port", port.Name(), "error", err)
 	}
 
-	slog.Info("removed port", "switch", e.name, "portId", portId)
+	slog.Info("removed port", "switch", e.name, "portId", portId, "port", port.Name())
 }
 
 func (e *ethernetSwitch) read(port Port, portId uint) {
@@ -77,66 +250,163 @@ func (e *ethernetSwitch) read(port Port, portId uint) {
 
 		frame, err := port.Read()
 		if err != nil {
-			slog.Error("failed to read frame of port", "switch", e.name, "portId", portId, "error", err)
+			active, ok = e.portActive.Get(portId)
+			if !ok || !active {
+				return
+			}
+
+			slog.Error("failed to read frame of port", "switch", e.name, "portId", portId, "port", port.Name(), "error", err)
 			e.RemovePort(portId)
 			return
 		}
 
+		e.capture.write(portId, port.Name(), frame, captureInbound)
 		e.transportFrame(frame, portId)
 	}
 }
 
-func (e *ethernetSwitch) write(port Port, portId uint) {
-	queue, ok := e.outgoingFrames.Get(portId)
-	if !ok {
-		panic("queue not found")
-	}
-
+func (e *ethernetSwitch) write(port Port, portId uint, queue *egressQueue) {
 	for {
 		active, ok := e.portActive.Get(portId)
 		if !ok || !active {
 			return
 		}
 
-		frame := queue.Grab()
+		frame, ok := queue.grab()
+		if !ok {
+			return
+		}
+
+		e.capture.write(portId, port.Name(), frame, captureOutbound)
+
 		err := port.Write(frame)
 		if err != nil {
-			slog.Error("failed to write frame to port", "switch", e.name, "portId", portId, "error", err)
+			slog.Error("failed to write frame to port", "switch", e.name, "portId", portId, "port", port.Name(), "error", err)
 			e.RemovePort(portId)
 			return
 		}
 	}
 }
 
+func isGroupAddr(mac []byte) bool {
+	return mac[0]&0x01 == 0x01
+}
+
 func (e *ethernetSwitch) transportFrame(frame ethernet.Frame, sourcePortId uint) {
-	e.hardwareAddr.Set(frame.Source().String(), sourcePortId)
+	if len(frame) < ethernetHeaderSize {
+		return
+	}
+
+	// group addresses are never valid as source
+	if isGroupAddr(frame.Source()) {
+		return
+	}
+
+	// the monitor port only receives mirrored frames
+	if e.isMonitorPort(sourcePortId) {
+		return
+	}
+
+	limiter, ok := e.limiters.Get(sourcePortId)
+	if !ok || !limiter.allowIngress(len(frame)) {
+		return
+	}
+
+	rawFrame := frame
+
+	sourceCfg, _ := e.portConfigs.Get(sourcePortId)
+
+	security, ok := e.security.Get(sourcePortId)
+	if !ok || e.isShutdown(sourcePortId, sourceCfg) || !e.secure(frame.Source(), sourcePortId, sourceCfg, security) {
+		return
+	}
+
+	frame, tagged, vlan, pcp := untagFrame(frame)
+	vlan, ok = sourceCfg.ingressVLAN(tagged, vlan)
+	if !ok {
+		return
+	}
+
+	e.mirrorFrame(rawFrame, sourcePortId, vlan, MirrorIngress)
+
+	info := parseFrame(frame)
+
+	if !sourceCfg.IngressACL.allows(frame, vlan, info) {
+		counters, ok := e.aclDrops.Get(sourcePortId)
+		if ok {
+			counters.ingress.Add(1)
+		}
+
+		return
+	}
+
+	priority := sourceCfg.QoS.classify(info, tagged, pcp)
+
+	f := switchFrame{frame: frame, vlan: vlan, priority: priority, splitHorizon: sourceCfg.SplitHorizon, info: info}
+
+	if !e.snoopDHCP(f, sourcePortId, sourceCfg) {
+		return
+	}
+
+	if !e.inspectNeighbors(f, sourcePortId) {
+		return
+	}
+
+	e.learn(newMacKey(vlan, frame.Source()), sourcePortId)
+
+	if e.suppressNeighbors(f, sourcePortId, sourceCfg) {
+		return
+	}
 
 	if bytes.Equal(frame.Destination(), broadcastMac) {
-		e.broadcastFrame(frame, sourcePortId)
+		e.floodFrame(f, sourcePortId, limiter, floodBroadcast)
 		return
 	}
 
-	e.singlecastFrame(frame, sourcePortId)
+	if isGroupAddr(frame.Destination()) {
+		e.floodFrame(f, sourcePortId, limiter, floodMulticast)
+		return
+	}
+
+	e.singlecastFrame(f, sourcePortId, limiter)
 }
 
-func (e *ethernetSwitch) broadcastFrame(frame ethernet.Frame, sourcePortId uint) {
-	e.outgoingFrames.Range(func(portId uint, queue *util.Queue[ethernet.Frame]) bool {
-		if portId == sourcePortId {
+// floodFrame sends a frame to all ports of its VLAN except the source port, ports suppressing the flood type
+// and split horizon ports if the frame was received on one, frames exceeding the storm control limits of the source port are dropped
+func (e *ethernetSwitch) floodFrame(f switchFrame, sourcePortId uint, sourceLimiter *portLimiter, flood floodType) {
+	if !sourceLimiter.allowFlood(flood) {
+		return
+	}
+
+	e.outgoingFrames.Range(func(portId uint, queue *egressQueue) bool {
+		if portId == sourcePortId || e.isMonitorPort(portId) {
 			return true
 		}
 
-		queue.Add(frame)
+		cfg, _ := e.portConfigs.Get(portId)
+		if f.splitHorizon && cfg.SplitHorizon {
+			return true
+		}
+
+		if flood == floodBroadcast && cfg.SuppressBroadcast ||
+			flood == floodMulticast && cfg.SuppressMulticast ||
+			flood == floodUnknownUnicast && cfg.SuppressUnknownUnicast {
+			return true
+		}
+
+		e.enqueueFrame(f, portId, cfg, queue)
 		return true
 	})
 }
 
-func (e *ethernetSwitch) singlecastFrame(frame ethernet.Frame, sourcePortId uint) {
-	targetPortId, ok := e.hardwareAddr.Get(frame.Destination().String())
+func (e *ethernetSwitch) singlecastFrame(f switchFrame, sourcePortId uint, sourceLimiter *portLimiter) {
+	targetPortId, ok := e.hardwareAddr.lookup(newMacKey(f.vlan, f.frame.Destination()))
 	if !ok {
+		e.floodFrame(f, sourcePortId, sourceLimiter, floodUnknownUnicast)
 		return
 	}
 
-	if targetPortId == sourcePortId {
+	if targetPortId == sourcePortId || e.isMonitorPort(targetPortId) {
 		return
 	}
 
@@ -145,14 +415,150 @@ func (e *ethernetSwitch) singlecastFrame(frame ethernet.Frame, sourcePortId uint
 		return
 	}
 
-	queue.Add(frame)
+	cfg, _ := e.portConfigs.Get(targetPortId)
+	if f.splitHorizon && cfg.SplitHorizon {
+		return
+	}
+
+	e.enqueueFrame(f, targetPortId, cfg, queue)
+}
+
+// enqueueFrame adds a frame to the queue of a port if the port is a member of the frames VLAN, tagging it if required,
+// frames are dropped if the queue is congested so a slow port never blocks the switch
+func (e *ethernetSwitch) enqueueFrame(f switchFrame, portId uint, cfg PortConfig, queue *egressQueue) {
+	member, tagged := cfg.egress(f.vlan)
+	if !member || e.isShutdown(portId, cfg) {
+		return
+	}
+
+	if !cfg.EgressACL.allows(f.frame, f.vlan, f.info) {
+		counters, ok := e.aclDrops.Get(portId)
+		if ok {
+			counters.egress.Add(1)
+		}
+
+		return
+	}
+
+	limiter, ok := e.limiters.Get(portId)
+	if !ok || !limiter.allowEgress(len(f.frame)) {
+		return
+	}
+
+	frame := f.frame
+	if tagged {
+		frame = tagFrame(f.frame, f.vlan, f.priority)
+	}
+
+	e.mirrorFrame(frame, portId, f.vlan, MirrorEgress)
+	queue.add(frame, f.priority)
+}
+
+func (e *ethernetSwitch) learn(mac macKey, portId uint) {
+	cfg, _ := e.portConfigs.Get(portId)
+
+	result, previousPortId := e.hardwareAddr.learn(mac, portId, cfg.MaxMACs)
+
+	switch result {
+	case learnMoved:
+		moves := e.macMoves.Add(1)
+
+		if e.macMoveLog.Allow() {
+			slog.Warn("mac moved between ports", "switch", e.name, "mac", mac.String(), "previousPortId", previousPortId, "portId", portId, "moves", moves)
+		}
+	case learnPortLimit, learnSwitchLimit:
+		e.macLimitExceeded.Add(1)
+	}
+}
+
+func (e *ethernetSwitch) ageMACs() {
+	ticker := time.NewTicker(e.macAgingTime / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+			expired := e.hardwareAddr.expire(e.macAgingTime)
+			if expired > 0 {
+				slog.Debug("expired macs", "switch", e.name, "amount", expired)
+			}
+
+			expired = e.bindings.expire()
+			if expired > 0 {
+				slog.Debug("expired bindings", "switch", e.name, "amount", expired)
+			}
+		}
+	}
+}
+
+func (e *ethernetSwitch) Status() SwitchStatus {
+	status := SwitchStatus{
+		MACs:             e.hardwareAddr.size(),
+		MACMoves:         e.macMoves.Load(),
+		MACLimitExceeded: e.macLimitExceeded.Load(),
+		Bindings:         e.bindings.size(),
+		NeighborDrops:    e.neighborDrops.Load(),
+		NeighborReplies:  e.neighborReplies.Load(),
+		DHCPDrops:        e.dhcpDrops.Load(),
+	}
+
+	e.ports.Range(func(portId uint, port Port) bool {
+		portStatus := PortStatus{Id: portId, Name: port.Name()}
+
+		queue, ok := e.outgoingFrames.Get(portId)
+		if ok {
+			portStatus.Classes = queue.status()
+		}
+
+		limiter, ok := e.limiters.Get(portId)
+		if ok {
+			portStatus.IngressRateDrops = limiter.ingressDrops.Load()
+			portStatus.EgressRateDrops = limiter.egressDrops.Load()
+			portStatus.StormDrops = limiter.stormDrops.Load()
+		}
+
+		counters, ok := e.aclDrops.Get(portId)
+		if ok {
+			portStatus.IngressACLDrops = counters.ingress.Load()
+			portStatus.EgressACLDrops = counters.egress.Load()
+		}
+
+		security, ok := e.security.Get(portId)
+		if ok {
+			portStatus.SecurityViolations = security.violations.Load()
+			cfg, _ := e.portConfigs.Get(portId)
+			portStatus.Shutdown = e.isShutdown(portId, cfg)
+		}
+
+		for _, class := range portStatus.Classes {
+			portStatus.Queued += class.Queued
+			portStatus.Drops += class.Drops
+		}
+
+		status.Ports = append(status.Ports, portStatus)
+		return true
+	})
+
+	sort.Slice(status.Ports, func(i, j int) bool {
+		return status.Ports[i].Id < status.Ports[j].Id
+	})
+
+	return status
+}
+
+func (e *ethernetSwitch) Bindings() []Binding {
+	return e.bindings.list()
 }
 
 func (e *ethernetSwitch) Close() error {
+	close(e.done)
+
 	e.ports.Range(func(portId uint, port Port) bool {
 		e.RemovePort(portId)
 		return true
 	})
 
-	return nil
+	return e.capture.close()
 }
@@ -0,0 +1,305 @@
+package internal
+
+import (
+	"errors"
+	"github.com/songgao/packets/ethernet"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPort is a port that receives the frames sent to in and sends the frames written by the switch to out
+type testPort struct {
+	name string
+	in   chan ethernet.Frame
+	out  chan ethernet.Frame
+}
+
+func newTestPort(name string) *testPort {
+	return &testPort{name: name, in: make(chan ethernet.Frame, 128), out: make(chan ethernet.Frame, 128)}
+}
+
+func (p *testPort) Name() string {
+	return p.name
+}
+
+func (p *testPort) Write(frame ethernet.Frame) error {
+	p.out <- frame
+	return nil
+}
+
+func (p *testPort) Read() (ethernet.Frame, error) {
+	frame, ok := <-p.in
+	if !ok {
+		return nil, errors.New("test port closed")
+	}
+
+	return frame, nil
+}
+
+func (p *testPort) Close() error {
+	return nil
+}
+
+func testMAC(s string) net.HardwareAddr {
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return mac
+}
+
+// testFrame returns an untagged IPv4 frame with a zero payload
+func testFrame(destination string, source string) ethernet.Frame {
+	var frame ethernet.Frame
+	frame.Prepare(testMAC(destination), testMAC(source), ethernet.NotTagged, ethernet.IPv4, 46)
+	return frame
+}
+
+// expectFrame returns the next frame written to a port, it fails the test if a frame is expected and none
+// arrives or if a frame arrives that is not expected
+func expectFrame(t *testing.T, p *testPort, expected bool) ethernet.Frame {
+	t.Helper()
+
+	return expectQueuedFrame(t, "port "+p.name, p.out, expected)
+}
+
+// expectQueuedFrame returns the next frame of a queue like expectFrame
+func expectQueuedFrame(t *testing.T, name string, frames chan ethernet.Frame, expected bool) ethernet.Frame {
+	t.Helper()
+
+	timeout := 20 * time.Millisecond
+	if expected {
+		timeout = time.Second
+	}
+
+	select {
+	case frame := <-frames:
+		if !expected {
+			t.Fatalf("%s received unexpected frame to %s", name, frame.Destination())
+		}
+
+		return frame
+	case <-time.After(timeout):
+		if expected {
+			t.Fatalf("%s received no frame", name)
+		}
+
+		return nil
+	}
+}
+
+func newTestSwitch(t *testing.T, cfg SwitchConfig) Switch {
+	t.Helper()
+
+	if cfg.Name == "" {
+		cfg.Name = "test"
+	}
+
+	sw, err := NewSwitch(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = sw.Close()
+	})
+
+	return sw
+}
+
+func TestSwitchAddPortConcurrently(t *testing.T) {
+	sw := newTestSwitch(t, SwitchConfig{})
+
+	var wg sync.WaitGroup
+	ids := make(chan uint, 64)
+
+	for i := 0; i < cap(ids); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			ids <- sw.AddPort(newTestPort("port"), PortConfig{})
+		}()
+	}
+
+	wg.Wait()
+	close(ids)
+
+	seen := map[uint]bool{}
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("port id %d was handed out twice", id)
+		}
+
+		seen[id] = true
+	}
+}
+
+func TestSwitchForwarding(t *testing.T) {
+	sw := newTestSwitch(t, SwitchConfig{})
+	a, b, c := newTestPort("a"), newTestPort("b"), newTestPort("c")
+	sw.AddPort(a, PortConfig{})
+	sw.AddPort(b, PortConfig{})
+	sw.AddPort(c, PortConfig{})
+
+	// the destination is unknown, so the frame is flooded
+	a.in <- testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0a")
+	expectFrame(t, b, true)
+	expectFrame(t, c, true)
+	expectFrame(t, a, false)
+
+	// the source of the first frame was learned on a
+	b.in <- testFrame("02:00:00:00:00:0a", "02:00:00:00:00:0b")
+	expectFrame(t, a, true)
+	expectFrame(t, c, false)
+}
+
+func TestSwitchFloodSuppression(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		cfg         PortConfig
+		flooded     bool
+	}{
+		{
+			name:        "broadcast",
+			destination: "ff:ff:ff:ff:ff:ff",
+			flooded:     true,
+		},
+		{
+			name:        "suppressed broadcast",
+			destination: "ff:ff:ff:ff:ff:ff",
+			cfg:         PortConfig{SuppressBroadcast: true},
+		},
+		{
+			name:        "multicast",
+			destination: "01:00:5e:00:00:01",
+			cfg:         PortConfig{SuppressBroadcast: true, SuppressUnknownUnicast: true},
+			flooded:     true,
+		},
+		{
+			name:        "suppressed multicast",
+			destination: "01:00:5e:00:00:01",
+			cfg:         PortConfig{SuppressMulticast: true},
+		},
+		{
+			name:        "unknown unicast",
+			destination: "02:00:00:00:00:0f",
+			cfg:         PortConfig{SuppressBroadcast: true, SuppressMulticast: true},
+			flooded:     true,
+		},
+		{
+			name:        "suppressed unknown unicast",
+			destination: "02:00:00:00:00:0f",
+			cfg:         PortConfig{SuppressUnknownUnicast: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sw := newTestSwitch(t, SwitchConfig{})
+			a, b, c := newTestPort("a"), newTestPort("b"), newTestPort("c")
+			sw.AddPort(a, PortConfig{})
+			sw.AddPort(b, PortConfig{})
+			sw.AddPort(c, test.cfg)
+
+			a.in <- testFrame(test.destination, "02:00:00:00:00:0a")
+			expectFrame(t, b, true)
+			expectFrame(t, c, test.flooded)
+		})
+	}
+}
+
+func TestSwitchSuppressionDoesNotAffectKnownUnicast(t *testing.T) {
+	sw := newTestSwitch(t, SwitchConfig{})
+	a, b := newTestPort("a"), newTestPort("b")
+	sw.AddPort(a, PortConfig{})
+	sw.AddPort(b, PortConfig{SuppressUnknownUnicast: true})
+
+	b.in <- testFrame("ff:ff:ff:ff:ff:ff", "02:00:00:00:00:0b")
+	expectFrame(t, a, true)
+
+	a.in <- testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0a")
+	expectFrame(t, b, true)
+}
+
+func TestSwitchSplitHorizon(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+	}{
+		{name: "flooded", destination: "ff:ff:ff:ff:ff:ff"},
+		{name: "unicast", destination: "02:00:00:00:00:0b"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sw := newTestSwitch(t, SwitchConfig{})
+			a, b, c := newTestPort("a"), newTestPort("b"), newTestPort("c")
+			sw.AddPort(a, PortConfig{SplitHorizon: true})
+			sw.AddPort(b, PortConfig{SplitHorizon: true})
+			sw.AddPort(c, PortConfig{})
+
+			// b and c learn their hardware addresses
+			b.in <- testFrame("ff:ff:ff:ff:ff:ff", "02:00:00:00:00:0b")
+			expectFrame(t, c, true)
+			expectFrame(t, a, false)
+
+			c.in <- testFrame("ff:ff:ff:ff:ff:ff", "02:00:00:00:00:0c")
+			expectFrame(t, a, true)
+			expectFrame(t, b, true)
+
+			// frames of split horizon ports are not sent to other split horizon ports
+			a.in <- testFrame(test.destination, "02:00:00:00:00:0a")
+			expectFrame(t, b, false)
+
+			// but still reach ports without split horizon
+			a.in <- testFrame("02:00:00:00:00:0c", "02:00:00:00:00:0a")
+			expectFrame(t, c, true)
+		})
+	}
+}
+
+// blockedPort is a port whose writes block until the test ends
+type blockedPort struct {
+	*testPort
+	done chan struct{}
+}
+
+func (p *blockedPort) Write(frame ethernet.Frame) error {
+	<-p.done
+	return nil
+}
+
+func TestSwitchCongestedPortDoesNotBlock(t *testing.T) {
+	sw := newTestSwitch(t, SwitchConfig{})
+	a, b := newTestPort("a"), newTestPort("b")
+	blocked := &blockedPort{testPort: newTestPort("blocked"), done: make(chan struct{})}
+	t.Cleanup(func() {
+		close(blocked.done)
+	})
+
+	sw.AddPort(a, PortConfig{})
+	sw.AddPort(b, PortConfig{})
+	blockedId := sw.AddPort(blocked, PortConfig{Queue: QueueConfig{Size: 2}})
+
+	// more frames than fit into the queue of the blocked port are flooded
+	for range 10 {
+		a.in <- testFrame("ff:ff:ff:ff:ff:ff", "02:00:00:00:00:0a")
+		expectFrame(t, b, true)
+	}
+
+	for _, port := range sw.Status().Ports {
+		if port.Id != blockedId {
+			continue
+		}
+
+		// up to one frame is blocked in the write, the queue is full and the rest is dropped
+		if port.Queued != 2 || port.Drops < 7 {
+			t.Fatalf("blocked port queued %d and dropped %d frames, expected 2 queued and at least 7 dropped", port.Queued, port.Drops)
+		}
+	}
+}
@@ -7,7 +7,8 @@ import (
 )
 
 type tapNic struct {
-	mtu uint16
+	name string
+	mtu  uint16
 
 	nic *water.Interface
 }
@@ -41,11 +42,16 @@ func NewTAPNIC(name string, mtu uint16) (Port, error) {
 	}
 
 	return &tapNic{
-		mtu: mtu,
-		nic: i,
+		name: i.Name(),
+		mtu:  mtu,
+		nic:  i,
 	}, nil
 }
 
+func (n *tapNic) Name() string {
+	return n.name
+}
+
 func (n *tapNic) Write(frame ethernet.Frame) error {
 	_, err := n.nic.Write(frame)
 	return err
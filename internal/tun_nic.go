@@ -0,0 +1,314 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"github.com/milosgajdos/tenus"
+	"github.com/songgao/packets/ethernet"
+	"github.com/songgao/water"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+)
+
+const tunQueueSize = 256
+
+// TUNNICConfig is a layer 3 TUN device, the switch sees the host of the device as a host with a synthetic hardware address
+type TUNNICConfig struct {
+	Name string
+	MTU  uint16
+	// MAC is the synthetic hardware address of the host, a random locally administered address if empty
+	MAC net.HardwareAddr
+	// Addresses are assigned to the device, ARP requests and neighbor solicitations for them are answered
+	Addresses []netip.Prefix
+	// Gateways are the IPv4 and IPv6 next hops of packets to destinations outside the subnets of the addresses
+	Gateways []netip.Addr
+}
+
+type tunNic struct {
+	name      string
+	mtu       uint16
+	mac       net.HardwareAddr
+	addresses []netip.Prefix
+	gateways  []netip.Addr
+	linkLocal netip.Addr
+	neighbors *neighborCache
+
+	nic *water.Interface
+
+	// frames converted from packets of the device and answers to the switch
+	frames     chan ethernet.Frame
+	readErrors chan error
+	done       chan struct{}
+	once       sync.Once
+}
+
+func NewTUNNIC(cfg TUNNICConfig) (Port, error) {
+	mac := cfg.MAC
+	if mac == nil {
+		var err error
+		mac, err = randomMAC()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	i, err := water.New(water.Config{
+		PlatformSpecificParams: water.PlatformSpecificParams{
+			Name: cfg.Name,
+		},
+		DeviceType: water.TUN,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = configureTUNLink(i.Name(), cfg)
+	if err != nil {
+		_ = i.Close()
+		return nil, err
+	}
+
+	n := &tunNic{
+		name:       i.Name(),
+		mtu:        cfg.MTU,
+		mac:        mac,
+		addresses:  cfg.Addresses,
+		gateways:   cfg.Gateways,
+		linkLocal:  linkLocalAddr(mac),
+		neighbors:  newNeighborCache(),
+		nic:        i,
+		frames:     make(chan ethernet.Frame, tunQueueSize),
+		readErrors: make(chan error, 1),
+		done:       make(chan struct{}),
+	}
+
+	// announcing the addresses lets the switch learn the hardware address of the host
+	for _, address := range n.addresses {
+		if address.Addr().Is4() {
+			n.send(arpReplyFrame(mac, address.Addr(), broadcastMac, address.Addr()))
+		} else {
+			n.send(unsolicitedNeighborAdvertisementFrame(mac, address.Addr()))
+		}
+	}
+
+	go n.readPackets()
+
+	slog.Info("created tun nic", "port", n.name, "mac", n.mac.String())
+	return n, nil
+}
+
+// configureTUNLink sets the MTU and the addresses of a TUN device and brings it up
+func configureTUNLink(name string, cfg TUNNICConfig) error {
+	link, err := tenus.NewLinkFrom(name)
+	if err != nil {
+		return err
+	}
+
+	err = link.SetLinkMTU(int(cfg.MTU))
+	if err != nil {
+		return err
+	}
+
+	for _, address := range cfg.Addresses {
+		ip := net.IP(address.Addr().AsSlice())
+		network := &net.IPNet{IP: net.IP(address.Masked().Addr().AsSlice()), Mask: net.CIDRMask(address.Bits(), address.Addr().BitLen())}
+
+		err = link.SetLinkIp(ip, network)
+		if err != nil {
+			return err
+		}
+	}
+
+	return link.SetLinkUp()
+}
+
+func (n *tunNic) Name() string {
+	return n.name
+}
+
+// Write converts a frame sent to the host into an IP packet of the device, neighbor discovery is answered by the port
+func (n *tunNic) Write(frame ethernet.Frame) error {
+	if len(frame) < ethernetHeaderSize {
+		return nil
+	}
+
+	info := parseFrame(frame)
+	if info.stacked {
+		return nil
+	}
+
+	p, ok := parseNeighborPacket(frame, info)
+	if ok {
+		n.handleNeighbor(p)
+		return nil
+	}
+
+	// unknown unicast is flooded to the port as well
+	if !info.ip || !bytes.Equal(frame.Destination(), n.mac) && !isGroupAddr(frame.Destination()) {
+		return nil
+	}
+
+	packet, ok := ipPacket(frame, info)
+	if !ok {
+		return nil
+	}
+
+	_, err := n.nic.Write(packet)
+	return err
+}
+
+// Read returns the next frame of the host
+func (n *tunNic) Read() (ethernet.Frame, error) {
+	select {
+	case frame := <-n.frames:
+		return frame, nil
+	case err := <-n.readErrors:
+		return nil, err
+	case <-n.done:
+		return nil, errors.New("tun nic closed")
+	}
+}
+
+func (n *tunNic) Close() error {
+	var err error
+
+	n.once.Do(func() {
+		close(n.done)
+		err = n.nic.Close()
+	})
+
+	return err
+}
+
+// send queues a frame to be read by the switch, frames are dropped if the switch does not keep up
+func (n *tunNic) send(frame ethernet.Frame) {
+	select {
+	case n.frames <- frame:
+	default:
+	}
+}
+
+// readPackets converts the packets of the device into frames until the device is closed
+func (n *tunNic) readPackets() {
+	for {
+		packet := make([]byte, n.mtu)
+
+		c, err := n.nic.Read(packet)
+		if err != nil {
+			n.readErrors <- err
+			return
+		}
+
+		n.sendPacket(packet[:c])
+	}
+}
+
+// sendPacket sends an IP packet of the host to its destination or next hop, the packet waits for the resolution
+// of the next hop if its hardware address is unknown
+func (n *tunNic) sendPacket(packet []byte) {
+	var destination netip.Addr
+	var etherType ethernet.Ethertype
+
+	switch {
+	case len(packet) >= ipv4MinHeaderSize && packet[0]>>4 == 4:
+		destination = netip.AddrFrom4([4]byte(packet[16:20]))
+		etherType = ethernet.IPv4
+	case len(packet) >= ipv6HeaderSize && packet[0]>>4 == 6:
+		destination = netip.AddrFrom16([16]byte(packet[24:40]))
+		etherType = ethernet.IPv6
+	default:
+		return
+	}
+
+	mac, ok := n.groupMAC(destination)
+	if ok {
+		n.send(packetFrame(mac, n.mac, etherType, packet))
+		return
+	}
+
+	nextHop, ok := n.nextHop(destination)
+	if !ok {
+		return
+	}
+
+	mac, ok, request := n.neighbors.resolve(nextHop, pendingPacket{etherType: etherType, packet: packet})
+	if ok {
+		n.send(packetFrame(mac, n.mac, etherType, packet))
+		return
+	}
+
+	if !request {
+		return
+	}
+
+	source, ok := sourceAddr(n.addresses, n.linkLocal, nextHop)
+	if ok {
+		n.send(resolutionFrame(n.mac, source, nextHop))
+	}
+}
+
+// groupMAC returns the group hardware address of broadcast and multicast destinations
+func (n *tunNic) groupMAC(destination netip.Addr) (net.HardwareAddr, bool) {
+	if destination.IsMulticast() {
+		ip := destination.AsSlice()
+		if destination.Is4() {
+			return net.HardwareAddr{0x01, 0x00, 0x5e, ip[1] & 0x7f, ip[2], ip[3]}, true
+		}
+
+		return net.HardwareAddr{0x33, 0x33, ip[12], ip[13], ip[14], ip[15]}, true
+	}
+
+	if destination == netip.AddrFrom4([4]byte{255, 255, 255, 255}) {
+		return broadcastMac, true
+	}
+
+	for _, address := range n.addresses {
+		if address.Addr().Is4() && destination == broadcastAddr(address) {
+			return broadcastMac, true
+		}
+	}
+
+	return nil, false
+}
+
+// nextHop returns the destination if it is on the link, otherwise the gateway of its address family
+func (n *tunNic) nextHop(destination netip.Addr) (netip.Addr, bool) {
+	if onLink(n.addresses, destination) {
+		return destination, true
+	}
+
+	for _, gateway := range n.gateways {
+		if gateway.Is4() == destination.Is4() {
+			return gateway, true
+		}
+	}
+
+	return netip.Addr{}, false
+}
+
+// handleNeighbor learns the hardware addresses of hosts on the link and answers requests for the addresses of the host
+func (n *tunNic) handleNeighbor(p neighborPacket) {
+	if p.bindable() && onLink(n.addresses, p.senderIP) {
+		for _, pending := range n.neighbors.learn(p.senderIP, p.senderMAC) {
+			n.send(packetFrame(p.senderMAC, n.mac, pending.etherType, pending.packet))
+		}
+	}
+
+	if !p.request || p.senderMAC == nil || p.gratuitous || !isLocalAddr(n.addresses, n.linkLocal, p.targetIP) {
+		return
+	}
+
+	switch p.source {
+	case BindingSourceARP:
+		n.send(arpReplyFrame(n.mac, p.targetIP, p.senderMAC, p.senderIP))
+	case BindingSourceND:
+		// duplicate address detection of other hosts is not answered
+		if p.senderIP.IsUnspecified() {
+			return
+		}
+
+		n.send(neighborAdvertisementFrame(n.mac, p.targetIP, p.senderMAC, p.senderIP))
+	}
+}
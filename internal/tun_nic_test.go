@@ -0,0 +1,299 @@
+package internal
+
+import (
+	"bytes"
+	"github.com/songgao/packets/ethernet"
+	"net/netip"
+	"testing"
+)
+
+var (
+	testTUNMAC     = testMAC("02:00:00:00:00:99")
+	testGatewayMAC = testMAC("02:00:00:00:00:01")
+)
+
+// newTestTUNNIC returns a port of the host 10.0.0.5/24 and fd00::5/64 behind the gateways 10.0.0.1 and fd00::1
+// without device, packets of the host are passed to sendPacket
+func newTestTUNNIC() *tunNic {
+	return &tunNic{
+		name:      "tun",
+		mtu:       1500,
+		mac:       testTUNMAC,
+		addresses: []netip.Prefix{netip.MustParsePrefix("10.0.0.5/24"), netip.MustParsePrefix("fd00::5/64")},
+		gateways:  []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("fd00::1")},
+		linkLocal: linkLocalAddr(testTUNMAC),
+		neighbors: newNeighborCache(),
+		frames:    make(chan ethernet.Frame, tunQueueSize),
+		done:      make(chan struct{}),
+	}
+}
+
+// expectTUNFrame returns the next frame of the host
+func expectTUNFrame(t *testing.T, n *tunNic, expected bool) ethernet.Frame {
+	t.Helper()
+
+	return expectQueuedFrame(t, "switch of "+n.name, n.frames, expected)
+}
+
+// testHostPacket returns an IP packet of the host to destination
+func testHostPacket(destination string) []byte {
+	ip := netip.MustParseAddr(destination)
+	if ip.Is4() {
+		return ipv4Frame(testTUNMAC, netip.MustParseAddr("10.0.0.5"), testTUNMAC, ip, ipProtocolUDP, 64, udpDatagram(1000, 2000, nil)).Payload()
+	}
+
+	return ipv6Frame(testTUNMAC, netip.MustParseAddr("fd00::5"), testTUNMAC, ip, ipProtocolUDP, 64, udpDatagram(1000, 2000, nil)).Payload()
+}
+
+func TestTUNNICNextHop(t *testing.T) {
+	n := newTestTUNNIC()
+
+	tests := []struct {
+		destination string
+		expected    string
+	}{
+		{destination: "10.0.0.10", expected: "10.0.0.10"},
+		{destination: "192.0.2.1", expected: "10.0.0.1"},
+		{destination: "fd00::10", expected: "fd00::10"},
+		{destination: "fe80::10", expected: "fe80::10"},
+		{destination: "2001:db8::1", expected: "fd00::1"},
+	}
+
+	for _, test := range tests {
+		nextHop, ok := n.nextHop(netip.MustParseAddr(test.destination))
+		if !ok || nextHop != netip.MustParseAddr(test.expected) {
+			t.Fatalf("next hop of %s is %s, expected %s", test.destination, nextHop, test.expected)
+		}
+	}
+
+	// destinations outside the subnets are dropped without gateway of their address family
+	n.gateways = n.gateways[:1]
+
+	_, ok := n.nextHop(netip.MustParseAddr("2001:db8::1"))
+	if ok {
+		t.Fatal("found next hop without ipv6 gateway")
+	}
+}
+
+func TestTUNNICGroupMAC(t *testing.T) {
+	n := newTestTUNNIC()
+
+	tests := []struct {
+		destination string
+		ok          bool
+		expected    string
+	}{
+		{destination: "255.255.255.255", ok: true, expected: "ff:ff:ff:ff:ff:ff"},
+		{destination: "10.0.0.255", ok: true, expected: "ff:ff:ff:ff:ff:ff"},
+		{destination: "224.0.0.251", ok: true, expected: "01:00:5e:00:00:fb"},
+		{destination: "239.129.2.3", ok: true, expected: "01:00:5e:01:02:03"},
+		{destination: "ff02::1:ff00:5", ok: true, expected: "33:33:ff:00:00:05"},
+		{destination: "10.0.0.10"},
+		{destination: "192.0.2.255"},
+		{destination: "fd00::10"},
+	}
+
+	for _, test := range tests {
+		mac, ok := n.groupMAC(netip.MustParseAddr(test.destination))
+		if ok != test.ok || ok && !bytes.Equal(mac, testMAC(test.expected)) {
+			t.Fatalf("group mac of %s is %s, expected %s", test.destination, mac, test.expected)
+		}
+	}
+}
+
+func TestTUNNICSendPacket(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		// nextHop is resolved before the packet is sent to the gateway mac, group destinations are sent without resolution
+		nextHop  string
+		answer   func(p neighborPacket) ethernet.Frame
+		expected string
+	}{
+		{
+			name:        "on link",
+			destination: "10.0.0.10",
+			nextHop:     "10.0.0.10",
+			answer: func(p neighborPacket) ethernet.Frame {
+				return arpReplyFrame(testGatewayMAC, p.targetIP, p.senderMAC, p.senderIP)
+			},
+			expected: "02:00:00:00:00:01",
+		},
+		{
+			name:        "via gateway",
+			destination: "192.0.2.1",
+			nextHop:     "10.0.0.1",
+			answer: func(p neighborPacket) ethernet.Frame {
+				return arpReplyFrame(testGatewayMAC, p.targetIP, p.senderMAC, p.senderIP)
+			},
+			expected: "02:00:00:00:00:01",
+		},
+		{
+			name:        "ipv6 via gateway",
+			destination: "2001:db8::1",
+			nextHop:     "fd00::1",
+			answer: func(p neighborPacket) ethernet.Frame {
+				return neighborAdvertisementFrame(testGatewayMAC, p.targetIP, p.senderMAC, p.senderIP)
+			},
+			expected: "02:00:00:00:00:01",
+		},
+		{
+			name:        "broadcast",
+			destination: "10.0.0.255",
+			expected:    "ff:ff:ff:ff:ff:ff",
+		},
+		{
+			name:        "multicast",
+			destination: "ff02::1",
+			expected:    "33:33:00:00:00:01",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n := newTestTUNNIC()
+			packet := testHostPacket(test.destination)
+
+			n.sendPacket(packet)
+
+			if test.nextHop != "" {
+				frame := expectTUNFrame(t, n, true)
+
+				p, ok := parseNeighborPacket(frame, parseFrame(frame))
+				if !ok || !p.request || p.targetIP != netip.MustParseAddr(test.nextHop) || !bytes.Equal(p.senderMAC, testTUNMAC) {
+					t.Fatalf("host sent %+v, expected request for %s", p, test.nextHop)
+				}
+
+				if !isLocalAddr(n.addresses, n.linkLocal, p.senderIP) {
+					t.Fatalf("request is sent from %s that is not an address of the host", p.senderIP)
+				}
+
+				_ = n.Write(test.answer(p))
+			}
+
+			frame := expectTUNFrame(t, n, true)
+			if !bytes.Equal(frame.Destination(), testMAC(test.expected)) || !bytes.Equal(frame.Source(), testTUNMAC) {
+				t.Fatalf("packet was sent from %s to %s, expected from %s to %s", frame.Source(), frame.Destination(), testTUNMAC, test.expected)
+			}
+
+			if !bytes.Equal(frame.Payload(), packet) {
+				t.Fatal("sent packet differs from the packet of the host")
+			}
+
+			expectTUNFrame(t, n, false)
+		})
+	}
+}
+
+func TestTUNNICSendPacketDrops(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+	}{
+		{name: "empty", packet: nil},
+		{name: "truncated ipv4", packet: testHostPacket("10.0.0.10")[:ipv4MinHeaderSize-1]},
+		{name: "truncated ipv6", packet: testHostPacket("fd00::10")[:ipv6HeaderSize-1]},
+		{name: "other version", packet: append([]byte{5 << 4}, make([]byte, ipv6HeaderSize)...)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n := newTestTUNNIC()
+			n.sendPacket(test.packet)
+			expectTUNFrame(t, n, false)
+		})
+	}
+}
+
+func TestTUNNICAnswersNeighbors(t *testing.T) {
+	gateway := netip.MustParseAddr("10.0.0.1")
+
+	tests := []struct {
+		name     string
+		frame    ethernet.Frame
+		answered bool
+	}{
+		{
+			name:     "arp request",
+			frame:    arpRequestFrame(testGatewayMAC, gateway, netip.MustParseAddr("10.0.0.5")),
+			answered: true,
+		},
+		{
+			name:     "neighbor solicitation",
+			frame:    neighborSolicitationFrame(testGatewayMAC, netip.MustParseAddr("fd00::1"), netip.MustParseAddr("fd00::5")),
+			answered: true,
+		},
+		{
+			name:     "link-local neighbor solicitation",
+			frame:    neighborSolicitationFrame(testGatewayMAC, netip.MustParseAddr("fe80::1"), linkLocalAddr(testTUNMAC)),
+			answered: true,
+		},
+		{
+			name:  "arp request for other host",
+			frame: arpRequestFrame(testGatewayMAC, gateway, netip.MustParseAddr("10.0.0.10")),
+		},
+		{
+			name:  "duplicate address detection",
+			frame: neighborSolicitationFrame(testGatewayMAC, netip.IPv6Unspecified(), netip.MustParseAddr("fd00::5")),
+		},
+		{
+			name:  "double tagged",
+			frame: testStacked(arpRequestFrame(testGatewayMAC, gateway, netip.MustParseAddr("10.0.0.5")), 0x88a8),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n := newTestTUNNIC()
+
+			_ = n.Write(test.frame)
+
+			reply := expectTUNFrame(t, n, test.answered)
+			if !test.answered {
+				return
+			}
+
+			request, _ := parseNeighborPacket(test.frame, parseFrame(test.frame))
+
+			p, ok := parseNeighborPacket(reply, parseFrame(reply))
+			if !ok || p.request || p.senderIP != request.targetIP || !bytes.Equal(p.senderMAC, testTUNMAC) {
+				t.Fatalf("host sent %+v, expected reply for %s", p, request.targetIP)
+			}
+
+			if !bytes.Equal(reply.Destination(), testGatewayMAC) {
+				t.Fatalf("reply was sent to %s, expected %s", reply.Destination(), testGatewayMAC)
+			}
+		})
+	}
+}
+
+func TestTUNNICWriteIgnoresFrames(t *testing.T) {
+	payload := udpDatagram(1000, 2000, nil)
+	source := netip.MustParseAddr("10.0.0.10")
+	host := netip.MustParseAddr("10.0.0.5")
+
+	// frames that are not for the host are dropped before reaching the device, the test port has none
+	tests := []struct {
+		name  string
+		frame ethernet.Frame
+	}{
+		{name: "truncated", frame: testFrame("02:00:00:00:00:99", "02:00:00:00:00:0a")[:ethernetHeaderSize-1]},
+		{name: "not ip", frame: testFrame("02:00:00:00:00:99", "02:00:00:00:00:0a")},
+		{name: "other unicast", frame: ipv4Frame(testGatewayMAC, source, testMAC("02:00:00:00:00:0b"), host, ipProtocolUDP, 64, payload)},
+		{name: "double tagged", frame: testStacked(ipv4Frame(testGatewayMAC, source, testTUNMAC, host, ipProtocolUDP, 64, payload), 0x88a8)},
+		{name: "truncated packet", frame: ipv4Frame(testGatewayMAC, source, testTUNMAC, host, ipProtocolUDP, 64, payload)[:ethernetHeaderSize+ipv4MinHeaderSize+4]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n := newTestTUNNIC()
+
+			err := n.Write(test.frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectTUNFrame(t, n, false)
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package util
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// LogLimiter is a thread-safe limit of logs to at most one per interval, for events a peer or host
+// can cause at a high rate which would flood the log otherwise
+type LogLimiter struct {
+	interval time.Duration
+	// unix nanoseconds of the last allowed log
+	last atomic.Int64
+}
+
+// NewLogLimiter creates a new LogLimiter
+func NewLogLimiter(interval time.Duration) *LogLimiter {
+	return &LogLimiter{interval: interval}
+}
+
+// Allow returns whether a log is allowed, only one caller is allowed per interval
+func (l *LogLimiter) Allow() bool {
+	now := time.Now().UnixNano()
+	last := l.last.Load()
+
+	return now-last > int64(l.interval) && l.last.CompareAndSwap(last, now)
+}
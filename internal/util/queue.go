@@ -8,46 +8,87 @@ import (
 type Queue[T any] struct {
 	sync.Mutex
 
-	signalLock sync.Mutex
-	signal     *sync.Cond
-	notFull    *sync.Cond
+	signal  *sync.Cond
+	notFull *sync.Cond
 
 	items    []T
 	maxItems int
+	closed   bool
 }
 
 // NewQueue creates a new Queue with a maximum size
 func NewQueue[T any](maxItems int) *Queue[T] {
 	q := &Queue[T]{maxItems: maxItems}
 
-	q.signal = sync.NewCond(&q.signalLock)
-	q.notFull = sync.NewCond(&q.signalLock)
+	q.signal = sync.NewCond(&q.Mutex)
+	q.notFull = sync.NewCond(&q.Mutex)
 	return q
 }
 
-// Add adds an item to the queue, blocking if the queue is full
+// Add adds an item to the queue, blocking if the queue is full, items added to a closed queue are discarded
 func (q *Queue[T]) Add(item T) {
 	q.Lock()
 	defer q.Unlock()
 
 	// Block if the queue is full
-	for len(q.items) >= q.maxItems {
-		q.Unlock()
-		q.signalLock.Lock()
+	for len(q.items) >= q.maxItems && !q.closed {
 		// wait until queue is not full
 		q.notFull.Wait()
-		q.signalLock.Unlock()
-		q.Lock()
+	}
+
+	if q.closed {
+		return
 	}
 
 	q.items = append(q.items, item)
 
-	q.signalLock.Lock()
-	defer q.signalLock.Unlock()
 	// signal that queue is not empty
 	q.signal.Signal()
 }
 
+// TryAdd adds an item to the queue without blocking, returns false if the queue is full or closed
+func (q *Queue[T]) TryAdd(item T) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.closed || len(q.items) >= q.maxItems {
+		return false
+	}
+
+	q.items = append(q.items, item)
+
+	// signal that queue is not empty
+	q.signal.Signal()
+	return true
+}
+
+// TryGrab returns the first item from the queue without blocking, returns false if the queue is empty or closed
+func (q *Queue[T]) TryGrab() (T, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.closed || len(q.items) == 0 {
+		var empty T
+		return empty, false
+	}
+
+	i := q.items[0]
+	q.items = q.items[1:]
+
+	// signal that queue is not full
+	q.notFull.Signal()
+
+	return i, true
+}
+
+// Len returns the amount of items in the queue
+func (q *Queue[T]) Len() int {
+	q.Lock()
+	defer q.Unlock()
+
+	return len(q.items)
+}
+
 // IsEmpty checks if the queue is empty
 func (q *Queue[T]) IsEmpty() bool {
 	q.Lock()
@@ -56,30 +97,39 @@ func (q *Queue[T]) IsEmpty() bool {
 	return len(q.items) == 0
 }
 
-// Grab returns the first item from the queue, blocking until the queue is not empty
-func (q *Queue[T]) Grab() T {
+// Grab returns the first item from the queue, blocking until the queue is not empty,
+// returns false once the queue is closed
+func (q *Queue[T]) Grab() (T, bool) {
 	q.Lock()
+	defer q.Unlock()
 
-	for len(q.items) == 0 {
-		q.Unlock()
-
-		q.signalLock.Lock()
+	for len(q.items) == 0 && !q.closed {
 		// wait until queue is not empty
 		q.signal.Wait()
-		q.signalLock.Unlock()
+	}
 
-		q.Lock()
+	if q.closed {
+		var empty T
+		return empty, false
 	}
 
 	i := q.items[0]
 	q.items = q.items[1:]
 
-	q.Unlock()
-
-	q.signalLock.Lock()
-	defer q.signalLock.Unlock()
 	// signal that queue is not full
 	q.notFull.Signal()
 
-	return i
+	return i, true
+}
+
+// Close closes the queue, discarding all items and releasing all blocked callers
+func (q *Queue[T]) Close() {
+	q.Lock()
+	defer q.Unlock()
+
+	q.closed = true
+	q.items = nil
+
+	q.signal.Broadcast()
+	q.notFull.Broadcast()
 }
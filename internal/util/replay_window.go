@@ -0,0 +1,82 @@
+package util
+
+import "sync"
+
+const replayWindowBlockBits = 64
+const replayWindowBlocks = 32
+
+// ReplayWindowSize is the amount of counters behind the highest seen counter that are still accepted
+const ReplayWindowSize = (replayWindowBlocks - 1) * replayWindowBlockBits
+
+// ReplayWindow is a thread-safe sliding window to detect replayed counters
+type ReplayWindow struct {
+	sync.Mutex
+
+	highest uint64
+	ring    [replayWindowBlocks]uint64
+}
+
+// NewReplayWindow creates a new ReplayWindow
+func NewReplayWindow() *ReplayWindow {
+	return &ReplayWindow{}
+}
+
+// Check returns whether the counter could be accepted, without marking it as seen
+func (w *ReplayWindow) Check(counter uint64) bool {
+	w.Lock()
+	defer w.Unlock()
+
+	if counter > w.highest {
+		return true
+	}
+
+	if w.highest-counter > ReplayWindowSize {
+		return false
+	}
+
+	block, bit := w.position(counter)
+	return w.ring[block]&bit == 0
+}
+
+// Accept marks the counter as seen, returns false if the counter was already seen or is too old
+func (w *ReplayWindow) Accept(counter uint64) bool {
+	w.Lock()
+	defer w.Unlock()
+
+	if counter > w.highest {
+		// clear all blocks the window moves over
+		current := w.highest / replayWindowBlockBits
+		diff := counter/replayWindowBlockBits - current
+		if diff > replayWindowBlocks {
+			diff = replayWindowBlocks
+		}
+
+		for i := current + 1; i <= current+diff; i++ {
+			w.ring[i%replayWindowBlocks] = 0
+		}
+
+		w.highest = counter
+	} else if w.highest-counter > ReplayWindowSize {
+		return false
+	}
+
+	block, bit := w.position(counter)
+	if w.ring[block]&bit != 0 {
+		return false
+	}
+
+	w.ring[block] |= bit
+	return true
+}
+
+// Highest returns the highest accepted counter
+func (w *ReplayWindow) Highest() uint64 {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.highest
+}
+
+func (w *ReplayWindow) position(counter uint64) (uint64, uint64) {
+	return (counter / replayWindowBlockBits) % replayWindowBlocks, 1 << (counter % replayWindowBlockBits)
+}
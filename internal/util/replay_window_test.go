@@ -0,0 +1,131 @@
+package util
+
+import "testing"
+
+func TestReplayWindow(t *testing.T) {
+	type step struct {
+		counter  uint64
+		accepted bool
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name:  "counter 0",
+			steps: []step{{0, true}, {0, false}, {1, true}},
+		},
+		{
+			name:  "in order",
+			steps: []step{{0, true}, {1, true}, {2, true}, {3, true}, {64, true}, {65, true}},
+		},
+		{
+			name:  "reordered inside the window",
+			steps: []step{{10, true}, {7, true}, {9, true}, {8, true}, {0, true}, {11, true}},
+		},
+		{
+			name:  "duplicates",
+			steps: []step{{5, true}, {5, false}, {3, true}, {3, false}, {6, true}, {5, false}},
+		},
+		{
+			name: "oldest counter of the window",
+			steps: []step{
+				{ReplayWindowSize + 10, true},
+				{10, true},
+				{9, false},
+				{10, false},
+			},
+		},
+		{
+			name: "older than the window",
+			steps: []step{
+				{0, true},
+				{ReplayWindowSize + 1, true},
+				{0, false},
+				{1, true},
+			},
+		},
+		{
+			name: "jump over one block",
+			steps: []step{
+				{63, true},
+				{64 + 63, true},
+				{63, false},
+				{64, true},
+			},
+		},
+		{
+			name: "jump onto the same ring position",
+			steps: []step{
+				{1, true},
+				{1 + replayWindowBlocks*replayWindowBlockBits, true},
+				{1, false},
+				{1 + (replayWindowBlocks-1)*replayWindowBlockBits, true},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := NewReplayWindow()
+
+			for i, s := range test.steps {
+				if w.Check(s.counter) != s.accepted {
+					t.Fatalf("check of counter %d at step %d is %t, expected %t", s.counter, i, !s.accepted, s.accepted)
+				}
+
+				if w.Accept(s.counter) != s.accepted {
+					t.Fatalf("accept of counter %d at step %d is %t, expected %t", s.counter, i, !s.accepted, s.accepted)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayWindowJumpClearsRing(t *testing.T) {
+	w := NewReplayWindow()
+
+	// fill every block of the ring
+	for counter := uint64(0); counter < replayWindowBlocks*replayWindowBlockBits; counter++ {
+		if !w.Accept(counter) {
+			t.Fatalf("counter %d was not accepted", counter)
+		}
+	}
+
+	highest := uint64(10*replayWindowBlocks*replayWindowBlockBits + 7)
+	if !w.Accept(highest) {
+		t.Fatal("jump was not accepted")
+	}
+
+	if w.Highest() != highest {
+		t.Fatalf("highest is %d, expected %d", w.Highest(), highest)
+	}
+
+	// every counter of the new window must be unseen, stale bits of the old window would reject them
+	for counter := highest - ReplayWindowSize; counter < highest; counter++ {
+		if !w.Accept(counter) {
+			t.Fatalf("counter %d inside the window was rejected after the jump", counter)
+		}
+	}
+
+	if w.Check(highest - ReplayWindowSize - 1) {
+		t.Fatal("counter older than the window was accepted")
+	}
+}
+
+func TestReplayWindowCheckDoesNotMark(t *testing.T) {
+	w := NewReplayWindow()
+
+	if !w.Check(3) || !w.Check(3) {
+		t.Fatal("check rejected an unseen counter")
+	}
+
+	if w.Highest() != 0 {
+		t.Fatalf("check moved the window to %d", w.Highest())
+	}
+
+	if !w.Accept(3) {
+		t.Fatal("counter was not accepted after check")
+	}
+}
@@ -0,0 +1,43 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket is a thread-safe token bucket that is refilled at a constant rate up to its burst size
+type TokenBucket struct {
+	sync.Mutex
+
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a new full TokenBucket refilled with rate tokens per second
+func NewTokenBucket(rate float64, burst float64) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// Take removes n tokens from the bucket, returns false without removing any tokens if there are not enough
+func (b *TokenBucket) Take(n float64) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens < n {
+		return false
+	}
+
+	b.tokens -= n
+	return true
+}
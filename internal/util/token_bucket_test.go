@@ -0,0 +1,62 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	type step struct {
+		elapsed time.Duration
+		take    float64
+		allowed bool
+	}
+
+	tests := []struct {
+		name  string
+		rate  float64
+		burst float64
+		steps []step
+	}{
+		{
+			name:  "burst",
+			rate:  10,
+			burst: 3,
+			steps: []step{{0, 1, true}, {0, 1, true}, {0, 1, true}, {0, 1, false}},
+		},
+		{
+			name:  "take above available tokens",
+			rate:  10,
+			burst: 3,
+			steps: []step{{0, 4, false}, {0, 3, true}},
+		},
+		{
+			name:  "refill",
+			rate:  10,
+			burst: 3,
+			steps: []step{{0, 3, true}, {0, 1, false}, {100 * time.Millisecond, 1, true}, {0, 1, false}},
+		},
+		{
+			name:  "refill up to burst",
+			rate:  10,
+			burst: 3,
+			steps: []step{{0, 3, true}, {time.Minute, 3, true}, {0, 1, false}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewTokenBucket(test.rate, test.burst)
+
+			for i, s := range test.steps {
+				// move the last refill back instead of waiting
+				b.last = b.last.Add(-s.elapsed)
+
+				allowed := b.Take(s.take)
+				if allowed != s.allowed {
+					t.Fatalf("take %d of %f tokens returned %t, expected %t", i, s.take, allowed, s.allowed)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"encoding/binary"
+	"github.com/songgao/packets/ethernet"
+	"slices"
+)
+
+const defaultVLAN = 1
+const MaxVLAN = 4094
+
+const vlanTagSize = 4
+const vlanTPID = 0x8100
+
+type VLANMode string
+
+const (
+	// VLANModeAccess ports send and receive untagged frames of a single VLAN
+	VLANModeAccess VLANMode = "access"
+	// VLANModeTrunk ports send and receive tagged frames of all allowed VLANs and untagged frames of the native VLAN
+	VLANModeTrunk VLANMode = "trunk"
+)
+
+// switchFrame is an untagged frame together with the VLAN it is switched in
+type switchFrame struct {
+	frame    ethernet.Frame
+	vlan     uint16
+	priority uint8
+	// splitHorizon is set if the frame was received on a split horizon port
+	splitHorizon bool
+	info         frameInfo
+}
+
+// untagFrame removes the outer 802.1Q tag of a frame, returns whether it was tagged and the VLAN id and priority of the tag
+func untagFrame(frame ethernet.Frame) (ethernet.Frame, bool, uint16, uint8) {
+	if frame.Tagging() != ethernet.Tagged || len(frame) < ethernetHeaderSize+vlanTagSize {
+		return frame, false, 0, 0
+	}
+
+	tci := binary.BigEndian.Uint16(frame[14:16])
+
+	untagged := make(ethernet.Frame, 0, len(frame)-vlanTagSize)
+	untagged = append(untagged, frame[:12]...)
+	untagged = append(untagged, frame[12+vlanTagSize:]...)
+
+	return untagged, true, tci & 0x0fff, uint8(tci >> 13)
+}
+
+// tagFrame inserts an 802.1Q tag into an untagged frame
+func tagFrame(frame ethernet.Frame, vlan uint16, priority uint8) ethernet.Frame {
+	tagged := make(ethernet.Frame, 0, len(frame)+vlanTagSize)
+	tagged = append(tagged, frame[:12]...)
+	tagged = binary.BigEndian.AppendUint16(tagged, vlanTPID)
+	tagged = binary.BigEndian.AppendUint16(tagged, uint16(priority)<<13|vlan&0x0fff)
+	tagged = append(tagged, frame[12:]...)
+	return tagged
+}
+
+func (c PortConfig) vlanMode() VLANMode {
+	if c.VLANMode == "" {
+		return VLANModeAccess
+	}
+
+	return c.VLANMode
+}
+
+func (c PortConfig) pvid() uint16 {
+	if c.PVID == 0 && c.vlanMode() == VLANModeAccess {
+		return defaultVLAN
+	}
+
+	return c.PVID
+}
+
+// ingressVLAN returns the VLAN a frame received on the port belongs to, returns false if the frame is not allowed
+func (c PortConfig) ingressVLAN(tagged bool, vlan uint16) (uint16, bool) {
+	// priority tagged frames are handled like untagged frames
+	if !tagged || vlan == 0 {
+		pvid := c.pvid()
+		return pvid, pvid != 0
+	}
+
+	if c.vlanMode() == VLANModeAccess {
+		return vlan, vlan == c.pvid()
+	}
+
+	return vlan, c.allowed(vlan)
+}
+
+// egress returns whether the port is a member of the VLAN and if frames of the VLAN are sent tagged
+func (c PortConfig) egress(vlan uint16) (bool, bool) {
+	if vlan == c.pvid() {
+		return true, false
+	}
+
+	if c.vlanMode() == VLANModeAccess {
+		return false, false
+	}
+
+	return c.allowed(vlan), true
+}
+
+func (c PortConfig) allowed(vlan uint16) bool {
+	if vlan == 0 || vlan > MaxVLAN {
+		return false
+	}
+
+	// trunks without allowed VLANs carry all VLANs
+	return len(c.AllowedVLANs) == 0 || slices.Contains(c.AllowedVLANs, vlan)
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"bytes"
+	"github.com/songgao/packets/ethernet"
+	"testing"
+)
+
+func TestTagFrame(t *testing.T) {
+	frame := testFrame("02:00:00:00:00:0b", "02:00:00:00:00:0a")
+
+	tagged := tagFrame(frame, 10, 5)
+	if tagged.Tagging() != ethernet.Tagged || len(tagged) != len(frame)+vlanTagSize {
+		t.Fatal("frame was not tagged")
+	}
+
+	untagged, wasTagged, vlan, priority := untagFrame(tagged)
+	if !wasTagged || vlan != 10 || priority != 5 {
+		t.Fatalf("untagged vlan %d with priority %d, expected vlan 10 with priority 5", vlan, priority)
+	}
+
+	if !bytes.Equal(untagged, frame) {
+		t.Fatal("untagged frame differs from the original frame")
+	}
+
+	untagged, wasTagged, _, _ = untagFrame(frame)
+	if wasTagged || !bytes.Equal(untagged, frame) {
+		t.Fatal("untagged frame was changed")
+	}
+}
+
+func TestPortConfigIngressVLAN(t *testing.T) {
+	access := PortConfig{PVID: 10}
+	trunk := PortConfig{VLANMode: VLANModeTrunk, PVID: 10, AllowedVLANs: []uint16{10, 20}}
+
+	tests := []struct {
+		name    string
+		cfg     PortConfig
+		tagged  bool
+		vlan    uint16
+		ingress uint16
+		allowed bool
+	}{
+		{name: "access untagged", cfg: access, ingress: 10, allowed: true},
+		{name: "access default vlan", cfg: PortConfig{}, ingress: defaultVLAN, allowed: true},
+		{name: "access priority tagged", cfg: access, tagged: true, vlan: 0, ingress: 10, allowed: true},
+		{name: "access tagged with pvid", cfg: access, tagged: true, vlan: 10, ingress: 10, allowed: true},
+		{name: "access tagged with other vlan", cfg: access, tagged: true, vlan: 20, ingress: 20},
+		{name: "trunk untagged", cfg: trunk, ingress: 10, allowed: true},
+		{name: "trunk untagged without native vlan", cfg: PortConfig{VLANMode: VLANModeTrunk}},
+		{name: "trunk allowed vlan", cfg: trunk, tagged: true, vlan: 20, ingress: 20, allowed: true},
+		{name: "trunk disallowed vlan", cfg: trunk, tagged: true, vlan: 30, ingress: 30},
+		{name: "trunk without allowed vlans", cfg: PortConfig{VLANMode: VLANModeTrunk}, tagged: true, vlan: 30, ingress: 30, allowed: true},
+		{name: "trunk vlan above max", cfg: PortConfig{VLANMode: VLANModeTrunk}, tagged: true, vlan: 4095, ingress: 4095},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vlan, allowed := test.cfg.ingressVLAN(test.tagged, test.vlan)
+			if vlan != test.ingress || allowed != test.allowed {
+				t.Fatalf("ingress vlan is %d allowed %t, expected %d allowed %t", vlan, allowed, test.ingress, test.allowed)
+			}
+		})
+	}
+}
+
+func TestPortConfigEgress(t *testing.T) {
+	access := PortConfig{PVID: 10}
+	trunk := PortConfig{VLANMode: VLANModeTrunk, PVID: 10, AllowedVLANs: []uint16{10, 20}}
+
+	tests := []struct {
+		name   string
+		cfg    PortConfig
+		vlan   uint16
+		member bool
+		tagged bool
+	}{
+		{name: "access pvid", cfg: access, vlan: 10, member: true},
+		{name: "access other vlan", cfg: access, vlan: 20},
+		{name: "trunk native vlan", cfg: trunk, vlan: 10, member: true},
+		{name: "trunk allowed vlan", cfg: trunk, vlan: 20, member: true, tagged: true},
+		{name: "trunk disallowed vlan", cfg: trunk, vlan: 30, tagged: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			member, tagged := test.cfg.egress(test.vlan)
+			if member != test.member || tagged != test.tagged {
+				t.Fatalf("egress is member %t tagged %t, expected member %t tagged %t", member, tagged, test.member, test.tagged)
+			}
+		})
+	}
+}
+
+func TestSwitchVLANs(t *testing.T) {
+	sw := newTestSwitch(t, SwitchConfig{})
+	a, b, c := newTestPort("a"), newTestPort("b"), newTestPort("c")
+	sw.AddPort(a, PortConfig{PVID: 10})
+	sw.AddPort(b, PortConfig{PVID: 20})
+	sw.AddPort(c, PortConfig{VLANMode: VLANModeTrunk, AllowedVLANs: []uint16{10, 20}})
+
+	// frames of access ports are sent tagged on trunks and not to other VLANs
+	a.in <- testFrame("ff:ff:ff:ff:ff:ff", "02:00:00:00:00:0a")
+
+	_, tagged, vlan, _ := untagFrame(expectFrame(t, c, true))
+	if !tagged || vlan != 10 {
+		t.Fatalf("trunk received frame tagged %t with vlan %d, expected vlan 10", tagged, vlan)
+	}
+
+	expectFrame(t, b, false)
+
+	// tagged frames of trunks are sent untagged on access ports of the VLAN
+	c.in <- tagFrame(testFrame("ff:ff:ff:ff:ff:ff", "02:00:00:00:00:0c"), 20, 0)
+
+	frame := expectFrame(t, b, true)
+	if frame.Tagging() != ethernet.NotTagged {
+		t.Fatal("access port received tagged frame")
+	}
+
+	expectFrame(t, a, false)
+
+	// frames of VLANs not allowed on the trunk are dropped
+	c.in <- tagFrame(testFrame("ff:ff:ff:ff:ff:ff", "02:00:00:00:00:0c"), 30, 0)
+	expectFrame(t, a, false)
+	expectFrame(t, b, false)
+}
@@ -4,7 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/go-yaml/yaml"
+	"github.com/lucasl0st/trestle/internal"
+	"net"
+	"net/netip"
 	"os"
+	"time"
 )
 
 func ParseConfig(filePath string) (*Config, error) {
@@ -29,6 +33,7 @@ func ParseConfig(filePath string) (*Config, error) {
 
 type Config struct {
 	Switches []Switch `yaml:"switches"`
+	Routers  []Router `yaml:"routers"`
 }
 
 func (c Config) Validate() error {
@@ -36,24 +41,96 @@ func (c Config) Validate() error {
 		return errors.New("no switches defined")
 	}
 
+	// switch name -> port names
+	switchPorts := map[string]map[string]bool{}
+	// switch name -> port name -> patch
+	patches := map[string]map[string]Patch{}
+
 	for i, s := range c.Switches {
 		err := s.Validate()
 		if err != nil {
 			return fmt.Errorf("failed to validate switch config index %d with error: %v", i, err)
 		}
+
+		if switchPorts[s.Name] != nil {
+			return fmt.Errorf("switch name %s at index %d is not unique", s.Name, i)
+		}
+
+		switchPorts[s.Name] = s.portNames()
+		patches[s.Name] = map[string]Patch{}
+
+		for _, port := range s.Ports {
+			if port.Patch.Name != "" {
+				patches[s.Name][port.Patch.Name] = port.Patch
+			}
+		}
+	}
+
+	for switchName, switchPatches := range patches {
+		for name, patch := range switchPatches {
+			if patch.Switch == switchName {
+				return fmt.Errorf("patch %s of switch %s is patched to its own switch", name, switchName)
+			}
+
+			remote, ok := patches[patch.Switch][patch.Port]
+			if !ok {
+				return fmt.Errorf("patch %s of switch %s references patch %s of switch %s that does not exist", name, switchName, patch.Port, patch.Switch)
+			}
+
+			if remote.Switch != switchName || remote.Port != name {
+				return fmt.Errorf("patch %s of switch %s is not patched back by patch %s of switch %s", name, switchName, patch.Port, patch.Switch)
+			}
+		}
+	}
+
+	routerNames := map[string]bool{}
+
+	for i, r := range c.Routers {
+		err := r.Validate(switchPorts)
+		if err != nil {
+			return fmt.Errorf("failed to validate router config index %d with error: %v", i, err)
+		}
+
+		if routerNames[r.Name] {
+			return fmt.Errorf("router name %s at index %d is not unique", r.Name, i)
+		}
+
+		routerNames[r.Name] = true
+
+		for _, iface := range r.Interfaces {
+			switchPorts[iface.Switch][iface.PortName(r.Name)] = true
+		}
 	}
 
 	return nil
 }
 
+// Switch is a virtual switch
 type Switch struct {
-	Name       string   `yaml:"name"`
-	MTU        uint16   `yaml:"mtu"`
-	NetworkMTU uint16   `yaml:"network_mtu"`
-	Listener   Listener `yaml:"listener"`
-	Ports      []Port   `yaml:"ports"`
+	Name         string        `yaml:"name"`
+	MTU          uint16        `yaml:"mtu"`
+	NetworkMTU   uint16        `yaml:"network_mtu"`
+	PrivateKey   string        `yaml:"private_key"`
+	MACAgingTime time.Duration `yaml:"mac_aging_time"`
+	MaxMACs      int           `yaml:"max_macs"`
+	// SplitHorizon stops forwarding between peers, required if peers of multiple switches form a full mesh
+	SplitHorizon bool     `yaml:"split_horizon"`
+	Mirror       Mirror   `yaml:"mirror"`
+	Capture      Capture  `yaml:"capture"`
+	Neighbor     Neighbor `yaml:"neighbor"`
+	// DHCPSnooping drops DHCP server messages from ports that are not dhcp_trusted
+	DHCPSnooping bool       `yaml:"dhcp_snooping"`
+	DHCPServer   DHCPServer `yaml:"dhcp_server"`
+	Listener     Listener   `yaml:"listener"`
+	Ports        []Port     `yaml:"ports"`
 }
 
+// minNetworkMTU is the minimum datagram size every IPv4 host accepts
+const minNetworkMTU = 576
+
+// minMACAgingTime is the minimum mac_aging_time
+const minMACAgingTime = time.Second
+
 func (s Switch) Validate() error {
 	if s.Name == "" {
 		return errors.New("name is empty")
@@ -63,11 +140,28 @@ func (s Switch) Validate() error {
 		return errors.New("mtu is 0")
 	}
 
-	if s.NetworkMTU == 0 {
-		return errors.New("network_mtu is 0")
+	if s.NetworkMTU < minNetworkMTU {
+		return fmt.Errorf("network_mtu %d is lower than %d", s.NetworkMTU, minNetworkMTU)
+	}
+
+	_, err := DecodeKey(s.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to decode private_key with error: %v", err)
+	}
+
+	if s.MACAgingTime < 0 {
+		return errors.New("mac_aging_time is negative")
+	}
+
+	if s.MACAgingTime != 0 && s.MACAgingTime < minMACAgingTime {
+		return fmt.Errorf("mac_aging_time %s is lower than %s", s.MACAgingTime, minMACAgingTime)
+	}
+
+	if s.MaxMACs < 0 {
+		return errors.New("max_macs is negative")
 	}
 
-	err := s.Listener.Validate()
+	err = s.Listener.Validate()
 	if err != nil {
 		return fmt.Errorf("failed to validate listener with error: %v", err)
 	}
@@ -76,19 +170,532 @@ func (s Switch) Validate() error {
 		return errors.New("no ports defined")
 	}
 
+	peerKeys := map[string]bool{}
+	// mirror and capture resolve ports by name, so port names must be unique
+	portNames := map[string]bool{}
+
 	for i, port := range s.Ports {
 		err = port.Validate()
 		if err != nil {
 			return fmt.Errorf("failed to validate port at index %d with error: %v", i, err)
 		}
+
+		if portNames[port.Name()] {
+			return fmt.Errorf("port name %s at index %d is not unique", port.Name(), i)
+		}
+
+		portNames[port.Name()] = true
+
+		if s.DHCPServer.Enabled && port.Name() == dhcpServerPortName {
+			return fmt.Errorf("port name %s at index %d is reserved for the dhcp server", port.Name(), i)
+		}
+
+		if port.Peer.Name == "" {
+			continue
+		}
+
+		if peerKeys[port.Peer.PublicKey] {
+			return fmt.Errorf("peer public_key at index %d is not unique", i)
+		}
+
+		peerKeys[port.Peer.PublicKey] = true
+	}
+
+	err = s.DHCPServer.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate dhcp_server with error: %v", err)
+	}
+
+	if s.DHCPServer.Enabled {
+		portNames[dhcpServerPortName] = true
+	}
+
+	err = s.Mirror.Validate(portNames)
+	if err != nil {
+		return fmt.Errorf("failed to validate mirror with error: %v", err)
+	}
+
+	err = s.Capture.Validate(portNames)
+	if err != nil {
+		return fmt.Errorf("failed to validate capture with error: %v", err)
+	}
+
+	if s.Neighbor.BindingTimeout < 0 {
+		return errors.New("neighbor binding_timeout is negative")
+	}
+
+	return nil
+}
+
+// Neighbor snoops ARP and IPv6 neighbor discovery to bind IPs to macs
+type Neighbor struct {
+	// Inspection drops packets contradicting known bindings
+	Inspection bool `yaml:"inspection"`
+	// Suppression answers requests for known bindings instead of flooding them
+	Suppression    bool          `yaml:"suppression"`
+	BindingTimeout time.Duration `yaml:"binding_timeout"`
+}
+
+// portNames returns the names of all ports of the switch including the dhcp server
+func (s Switch) portNames() map[string]bool {
+	portNames := map[string]bool{}
+	for _, port := range s.Ports {
+		portNames[port.Name()] = true
+	}
+
+	if s.DHCPServer.Enabled {
+		portNames[dhcpServerPortName] = true
+	}
+
+	return portNames
+}
+
+// Router routes IPv4 and IPv6 between the subnets of its interfaces
+type Router struct {
+	Name       string            `yaml:"name"`
+	Interfaces []RouterInterface `yaml:"interfaces"`
+	Routes     []Route           `yaml:"routes"`
+}
+
+func (r Router) Validate(switchPorts map[string]map[string]bool) error {
+	if r.Name == "" {
+		return errors.New("name is empty")
+	}
+
+	if len(r.Interfaces) == 0 {
+		return errors.New("no interfaces defined")
+	}
+
+	// switch name -> port names of the interfaces
+	interfacePorts := map[string]map[string]bool{}
+	var subnets []netip.Prefix
+
+	for i, iface := range r.Interfaces {
+		portNames, ok := switchPorts[iface.Switch]
+		if !ok {
+			return fmt.Errorf("switch %s of interface at index %d does not exist", iface.Switch, i)
+		}
+
+		name := iface.PortName(r.Name)
+		if portNames[name] || interfacePorts[iface.Switch][name] {
+			return fmt.Errorf("port name %s of interface at index %d is not unique on switch %s", name, i, iface.Switch)
+		}
+
+		if interfacePorts[iface.Switch] == nil {
+			interfacePorts[iface.Switch] = map[string]bool{}
+		}
+
+		interfacePorts[iface.Switch][name] = true
+
+		if iface.MAC != "" {
+			_, err := parseUnicastMAC(iface.MAC)
+			if err != nil {
+				return fmt.Errorf("failed to parse mac of interface at index %d with error: %v", i, err)
+			}
+		}
+
+		if iface.VLAN > internal.MaxVLAN {
+			return fmt.Errorf("vlan %d of interface at index %d is out of range", iface.VLAN, i)
+		}
+
+		if len(iface.Addresses) == 0 {
+			return fmt.Errorf("interface at index %d has no addresses", i)
+		}
+
+		for _, a := range iface.Addresses {
+			address, err := netip.ParsePrefix(a)
+			if err != nil {
+				return fmt.Errorf("failed to parse address of interface at index %d with error: %v", i, err)
+			}
+
+			for _, subnet := range subnets {
+				if subnet.Overlaps(address) {
+					return fmt.Errorf("address %s of interface at index %d overlaps subnet %s", a, i, subnet)
+				}
+			}
+
+			subnets = append(subnets, address.Masked())
+		}
+	}
+
+	for i, route := range r.Routes {
+		prefix, err := netip.ParsePrefix(route.Prefix)
+		if err != nil {
+			return fmt.Errorf("failed to parse prefix of route at index %d with error: %v", i, err)
+		}
+
+		via, err := netip.ParseAddr(route.Via)
+		if err != nil {
+			return fmt.Errorf("failed to parse via of route at index %d with error: %v", i, err)
+		}
+
+		if prefix.Addr().Is4() != via.Is4() {
+			return fmt.Errorf("via of route at index %d is not of the address family of the prefix", i)
+		}
+
+		connected := false
+		for _, subnet := range subnets {
+			if subnet.Contains(via) {
+				connected = true
+				break
+			}
+		}
+
+		if !connected {
+			return fmt.Errorf("via %s of route at index %d is not in a subnet of an interface", route.Via, i)
+		}
+	}
+
+	return nil
+}
+
+// RouterInterface is a port of a router on a switch
+type RouterInterface struct {
+	Switch string `yaml:"switch"`
+	// Name is the name of the port on the switch, the name of the router if empty
+	Name string `yaml:"name"`
+	// MAC is random if empty
+	MAC string `yaml:"mac"`
+	// VLAN is the access vlan of the port
+	VLAN      uint16   `yaml:"vlan"`
+	Addresses []string `yaml:"addresses"`
+}
+
+func (i RouterInterface) PortName(routerName string) string {
+	if i.Name != "" {
+		return i.Name
+	}
+
+	return routerName
+}
+
+// Route is a static route of a prefix to a next hop
+type Route struct {
+	Prefix string `yaml:"prefix"`
+	Via    string `yaml:"via"`
+}
+
+// dhcpServerPortName is the name of the port of the dhcp server on its switch
+const dhcpServerPortName = "dhcp"
+
+// DHCPServer is a DHCPv4 server and IPv6 router advertisement daemon on a port named dhcp
+type DHCPServer struct {
+	Enabled bool `yaml:"enabled"`
+	// MAC is random if empty
+	MAC string `yaml:"mac"`
+	// VLAN is the access vlan of the server port
+	VLAN                uint16              `yaml:"vlan"`
+	Address             string              `yaml:"address"`
+	Pools               []DHCPPool          `yaml:"pools"`
+	Reservations        []DHCPReservation   `yaml:"reservations"`
+	Router              string              `yaml:"router"`
+	DNS                 []string            `yaml:"dns"`
+	Domain              string              `yaml:"domain"`
+	LeaseTime           time.Duration       `yaml:"lease_time"`
+	LeaseFile           string              `yaml:"lease_file"`
+	RouterAdvertisement RouterAdvertisement `yaml:"router_advertisement"`
+}
+
+func (d DHCPServer) Validate() error {
+	if !d.Enabled {
+		return nil
+	}
+
+	if d.MAC != "" {
+		_, err := parseUnicastMAC(d.MAC)
+		if err != nil {
+			return fmt.Errorf("failed to parse mac with error: %v", err)
+		}
+	}
+
+	if d.VLAN > internal.MaxVLAN {
+		return fmt.Errorf("vlan %d is out of range", d.VLAN)
+	}
+
+	if d.LeaseTime < 0 {
+		return errors.New("lease_time is negative")
+	}
+
+	if d.Address == "" {
+		if len(d.Pools) > 0 || len(d.Reservations) > 0 {
+			return errors.New("address is empty")
+		}
+
+		if len(d.RouterAdvertisement.Prefixes) == 0 {
+			return errors.New("neither address or router_advertisement prefixes defined")
+		}
+
+		return d.RouterAdvertisement.Validate()
+	}
+
+	address, err := netip.ParsePrefix(d.Address)
+	if err != nil {
+		return fmt.Errorf("failed to parse address with error: %v", err)
+	}
+
+	if !address.Addr().Is4() || address.Bits() > 30 {
+		return fmt.Errorf("address %s is not an ipv4 address with a subnet of at most /30", d.Address)
+	}
+
+	subnet := address.Masked()
+
+	for i, pool := range d.Pools {
+		start, err := parseSubnetIP(pool.Start, subnet)
+		if err != nil {
+			return fmt.Errorf("failed to parse start of pool at index %d with error: %v", i, err)
+		}
+
+		end, err := parseSubnetIP(pool.End, subnet)
+		if err != nil {
+			return fmt.Errorf("failed to parse end of pool at index %d with error: %v", i, err)
+		}
+
+		if end.Less(start) {
+			return fmt.Errorf("pool at index %d ends before its start", i)
+		}
+	}
+
+	macs := map[string]bool{}
+	ips := map[netip.Addr]bool{}
+
+	for i, r := range d.Reservations {
+		mac, err := parseUnicastMAC(r.MAC)
+		if err != nil {
+			return fmt.Errorf("failed to parse mac of reservation at index %d with error: %v", i, err)
+		}
+
+		ip, err := parseSubnetIP(r.IP, subnet)
+		if err != nil {
+			return fmt.Errorf("failed to parse ip of reservation at index %d with error: %v", i, err)
+		}
+
+		if macs[mac.String()] || ips[ip] {
+			return fmt.Errorf("reservation at index %d is not unique", i)
+		}
+
+		macs[mac.String()] = true
+		ips[ip] = true
+	}
+
+	if d.Router != "" {
+		_, err = parseSubnetIP(d.Router, subnet)
+		if err != nil {
+			return fmt.Errorf("failed to parse router with error: %v", err)
+		}
+	}
+
+	if len(d.DNS) > internal.MaxDNSServers {
+		return fmt.Errorf("dns has more than %d servers", internal.MaxDNSServers)
+	}
+
+	for _, dns := range d.DNS {
+		ip, err := netip.ParseAddr(dns)
+		if err != nil || !ip.Is4() {
+			return fmt.Errorf("dns %s is not an ipv4 address", dns)
+		}
+	}
+
+	if len(d.Domain) > 255 {
+		return errors.New("domain is too long")
+	}
+
+	return d.RouterAdvertisement.Validate()
+}
+
+// DHCPPool is an inclusive range of addresses in the subnet of the dhcp server
+type DHCPPool struct {
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+}
+
+// DHCPReservation always leases the same address to a client
+type DHCPReservation struct {
+	MAC string `yaml:"mac"`
+	IP  string `yaml:"ip"`
+}
+
+// RouterAdvertisement announces /64 prefixes for stateless address autoconfiguration
+type RouterAdvertisement struct {
+	Prefixes []string      `yaml:"prefixes"`
+	Interval time.Duration `yaml:"interval"`
+	// RouterLifetime announces the dhcp server as default router if set
+	RouterLifetime time.Duration `yaml:"router_lifetime"`
+	DNS            []string      `yaml:"dns"`
+}
+
+func (r RouterAdvertisement) Validate() error {
+	for _, p := range r.Prefixes {
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return fmt.Errorf("failed to parse prefix with error: %v", err)
+		}
+
+		if !prefix.Addr().Is6() || prefix.Addr().Is4In6() || prefix.Bits() != 64 {
+			return fmt.Errorf("prefix %s is not an ipv6 /64 prefix", p)
+		}
+	}
+
+	if r.Interval < 0 {
+		return errors.New("interval is negative")
+	}
+
+	if r.RouterLifetime < 0 {
+		return errors.New("router_lifetime is negative")
+	}
+
+	if len(r.DNS) > internal.MaxDNSServers {
+		return fmt.Errorf("dns has more than %d servers", internal.MaxDNSServers)
+	}
+
+	for _, dns := range r.DNS {
+		ip, err := netip.ParseAddr(dns)
+		if err != nil || !ip.Is6() || ip.Is4In6() {
+			return fmt.Errorf("dns %s is not an ipv6 address", dns)
+		}
+	}
+
+	return nil
+}
+
+// parseSubnetIP parses an ipv4 address that must be in a subnet
+func parseSubnetIP(s string, subnet netip.Prefix) (netip.Addr, error) {
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	if !subnet.Contains(ip) {
+		return netip.Addr{}, fmt.Errorf("%s is not in subnet %s", s, subnet)
+	}
+
+	return ip, nil
+}
+
+// parseEthernetMAC parses a 6 byte mac, net.ParseMAC also accepts longer addresses
+func parseEthernetMAC(s string) (net.HardwareAddr, error) {
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(mac) != 6 {
+		return nil, fmt.Errorf("%s is not an ethernet address", s)
+	}
+
+	return mac, nil
+}
+
+func parseUnicastMAC(s string) (net.HardwareAddr, error) {
+	mac, err := parseEthernetMAC(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if mac[0]&0x01 == 0x01 {
+		return nil, fmt.Errorf("%s is not an unicast ethernet address", s)
+	}
+
+	return mac, nil
+}
+
+// Capture writes the frames of ports into rotated pcapng files in a directory
+type Capture struct {
+	Directory string `yaml:"directory"`
+	// Ports are tapnic or peer names, all ports are captured if empty
+	Ports          []string      `yaml:"ports"`
+	MaxFileSize    int64         `yaml:"max_file_size"`
+	RotateInterval time.Duration `yaml:"rotate_interval"`
+	MaxFiles       int           `yaml:"max_files"`
+	SnapLength     int           `yaml:"snap_length"`
+}
+
+func (c Capture) Validate(portNames map[string]bool) error {
+	if c.Directory == "" {
+		return nil
+	}
+
+	for _, name := range c.Ports {
+		if !portNames[name] {
+			return fmt.Errorf("port %s does not exist", name)
+		}
+	}
+
+	if c.MaxFileSize < 0 {
+		return errors.New("max_file_size is negative")
+	}
+
+	if c.RotateInterval < 0 {
+		return errors.New("rotate_interval is negative")
+	}
+
+	if c.MaxFiles < 0 {
+		return errors.New("max_files is negative")
+	}
+
+	if c.SnapLength < 0 {
+		return errors.New("snap_length is negative")
+	}
+
+	return nil
+}
+
+// Mirror sends copies of the traffic of ports or VLANs to a monitor port
+type Mirror struct {
+	Enabled bool   `yaml:"enabled"`
+	Monitor string `yaml:"monitor"`
+	// Ports are tapnic or peer names
+	Ports []string `yaml:"ports"`
+	VLANs []uint16 `yaml:"vlans"`
+	// Direction is either ingress, egress or both
+	Direction string `yaml:"direction"`
+}
+
+func (m Mirror) Validate(portNames map[string]bool) error {
+	if m.Monitor == "" {
+		if m.Enabled || len(m.Ports) > 0 || len(m.VLANs) > 0 {
+			return errors.New("monitor is empty")
+		}
+
+		return nil
+	}
+
+	if !portNames[m.Monitor] {
+		return fmt.Errorf("monitor port %s does not exist", m.Monitor)
+	}
+
+	if len(m.Ports) == 0 && len(m.VLANs) == 0 {
+		return errors.New("neither ports or vlans defined")
+	}
+
+	for _, name := range m.Ports {
+		if !portNames[name] {
+			return fmt.Errorf("port %s does not exist", name)
+		}
+
+		if name == m.Monitor {
+			return errors.New("monitor port can not be mirrored")
+		}
+	}
+
+	for _, id := range m.VLANs {
+		if id == 0 || id > internal.MaxVLAN {
+			return fmt.Errorf("vlan %d is out of range", id)
+		}
+	}
+
+	if m.Direction != "" && m.Direction != "ingress" && m.Direction != "egress" && m.Direction != "both" {
+		return fmt.Errorf("direction %s is invalid, must be ingress, egress or both", m.Direction)
 	}
 
 	return nil
 }
 
 type Listener struct {
-	Hostname string `yaml:"hostname"`
-	Port     uint16 `yaml:"port"`
+	Hostname          string        `yaml:"hostname"`
+	Port              uint16        `yaml:"port"`
+	AcceptUnknown     bool          `yaml:"accept_unknown"`
+	KeepaliveInterval time.Duration `yaml:"keepalive_interval"`
+	PeerTimeout       time.Duration `yaml:"peer_timeout"`
 }
 
 func (l Listener) Validate() error {
@@ -96,21 +703,97 @@ func (l Listener) Validate() error {
 		return errors.New("hostname is empty")
 	}
 
+	if l.KeepaliveInterval < 0 {
+		return errors.New("keepalive_interval is negative")
+	}
+
+	if l.PeerTimeout < 0 {
+		return errors.New("peer_timeout is negative")
+	}
+
+	keepaliveInterval := l.KeepaliveInterval
+	if keepaliveInterval == 0 {
+		keepaliveInterval = internal.DefaultKeepaliveInterval
+	}
+
+	peerTimeout := l.PeerTimeout
+	if peerTimeout == 0 {
+		peerTimeout = internal.DefaultPeerTimeout
+	}
+
+	// a single lost keepalive must not close the session
+	if peerTimeout < 2*keepaliveInterval {
+		return fmt.Errorf("peer_timeout %s must be at least twice the keepalive_interval %s", peerTimeout, keepaliveInterval)
+	}
+
 	return nil
 }
 
 type Port struct {
-	TAPNIC TAPNIC `yaml:"tapnic"`
-	Peer   Peer   `yaml:"peer"`
+	TAPNIC           TAPNIC           `yaml:"tapnic"`
+	TUNNIC           TUNNIC           `yaml:"tunnic"`
+	Peer             Peer             `yaml:"peer"`
+	FloodSuppression FloodSuppression `yaml:"flood_suppression"`
+	MaxMACs          int              `yaml:"max_macs"`
+	VLAN             VLAN             `yaml:"vlan"`
+	Queue            Queue            `yaml:"queue"`
+	QoS              QoS              `yaml:"qos"`
+	RateLimit        RateLimit        `yaml:"rate_limit"`
+	StormControl     StormControl     `yaml:"storm_control"`
+	ACL              PortACL          `yaml:"acl"`
+	Security         PortSecurity     `yaml:"security"`
+	DHCPTrusted      bool             `yaml:"dhcp_trusted"`
+	Patch            Patch            `yaml:"patch"`
 }
 
 func (p Port) Validate() error {
-	if p.TAPNIC.Name != "" && p.Peer.Name != "" {
-		return errors.New("both tapnic and peer defined, choose one")
+	if p.MaxMACs < 0 {
+		return errors.New("max_macs is negative")
+	}
+
+	err := p.VLAN.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate vlan with error: %v", err)
+	}
+
+	err = p.Queue.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate queue with error: %v", err)
+	}
+
+	err = p.QoS.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate qos with error: %v", err)
+	}
+
+	err = p.ACL.Ingress.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate ingress acl with error: %v", err)
+	}
+
+	err = p.ACL.Egress.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate egress acl with error: %v", err)
+	}
+
+	err = p.Security.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate security with error: %v", err)
+	}
+
+	defined := 0
+	for _, name := range []string{p.TAPNIC.Name, p.TUNNIC.Name, p.Peer.Name, p.Patch.Name} {
+		if name != "" {
+			defined++
+		}
+	}
+
+	if defined > 1 {
+		return errors.New("more than one of tapnic, tunnic, peer and patch defined, choose one")
 	}
 
 	if p.TAPNIC.Name != "" {
-		err := p.TAPNIC.Validate()
+		err = p.TAPNIC.Validate()
 		if err != nil {
 			return fmt.Errorf("failed to validate tapnic with error: %v", err)
 		}
@@ -118,8 +801,17 @@ func (p Port) Validate() error {
 		return nil
 	}
 
+	if p.TUNNIC.Name != "" {
+		err = p.TUNNIC.Validate()
+		if err != nil {
+			return fmt.Errorf("failed to validate tunnic with error: %v", err)
+		}
+
+		return nil
+	}
+
 	if p.Peer.Name != "" {
-		err := p.Peer.Validate()
+		err = p.Peer.Validate()
 		if err != nil {
 			return fmt.Errorf("failed to validate peer with error: %v", err)
 		}
@@ -127,7 +819,354 @@ func (p Port) Validate() error {
 		return nil
 	}
 
-	return errors.New("neither tapnic or peer name defined")
+	if p.Patch.Name != "" {
+		err = p.Patch.Validate()
+		if err != nil {
+			return fmt.Errorf("failed to validate patch with error: %v", err)
+		}
+
+		return nil
+	}
+
+	return errors.New("neither tapnic, tunnic, peer or patch name defined")
+}
+
+// Name returns the name of the tapnic, tunnic, peer or patch of the port
+func (p Port) Name() string {
+	if p.TAPNIC.Name != "" {
+		return p.TAPNIC.Name
+	}
+
+	if p.TUNNIC.Name != "" {
+		return p.TUNNIC.Name
+	}
+
+	if p.Patch.Name != "" {
+		return p.Patch.Name
+	}
+
+	return p.Peer.Name
+}
+
+// Patch connects the switch to the patch port named port of another switch, which must patch back
+type Patch struct {
+	Name            string            `yaml:"name"`
+	Switch          string            `yaml:"switch"`
+	Port            string            `yaml:"port"`
+	VLANTranslation []VLANTranslation `yaml:"vlan_translation"`
+}
+
+func (p Patch) Validate() error {
+	if p.Switch == "" {
+		return errors.New("switch is empty")
+	}
+
+	if p.Port == "" {
+		return errors.New("port is empty")
+	}
+
+	locals := map[uint16]bool{}
+	remotes := map[uint16]bool{}
+
+	for i, t := range p.VLANTranslation {
+		if t.Local == 0 || t.Local > internal.MaxVLAN || t.Remote == 0 || t.Remote > internal.MaxVLAN {
+			return fmt.Errorf("vlan translation at index %d is out of range", i)
+		}
+
+		if locals[t.Local] || remotes[t.Remote] {
+			return fmt.Errorf("vlan translation at index %d is not unique", i)
+		}
+
+		locals[t.Local] = true
+		remotes[t.Remote] = true
+	}
+
+	return nil
+}
+
+// VLANTranslation translates the vlan local of the switch to the vlan remote on the patch and back
+type VLANTranslation struct {
+	Local  uint16 `yaml:"local"`
+	Remote uint16 `yaml:"remote"`
+}
+
+// VLAN is the 802.1Q configuration of a port, ports without configuration are access ports of VLAN 1
+type VLAN struct {
+	// Mode is either access or trunk
+	Mode string `yaml:"mode"`
+	// PVID is the VLAN of an access port or the native VLAN of a trunk port
+	PVID uint16 `yaml:"pvid"`
+	// Allowed are the VLANs carried by a trunk port, all VLANs if empty
+	Allowed []uint16 `yaml:"allowed"`
+}
+
+func (v VLAN) Validate() error {
+	if v.Mode != "" && v.Mode != "access" && v.Mode != "trunk" {
+		return fmt.Errorf("mode %s is invalid, must be access or trunk", v.Mode)
+	}
+
+	if v.PVID > internal.MaxVLAN {
+		return fmt.Errorf("pvid %d is out of range", v.PVID)
+	}
+
+	if v.Mode != "trunk" && len(v.Allowed) > 0 {
+		return errors.New("allowed is only valid for trunk ports")
+	}
+
+	for _, id := range v.Allowed {
+		if id == 0 || id > internal.MaxVLAN {
+			return fmt.Errorf("allowed vlan %d is out of range", id)
+		}
+	}
+
+	return nil
+}
+
+// Queue is the egress queue of a port
+type Queue struct {
+	Size int `yaml:"size"`
+	// DropPolicy is either tail or red
+	DropPolicy        string  `yaml:"drop_policy"`
+	REDMinThreshold   int     `yaml:"red_min_threshold"`
+	REDMaxThreshold   int     `yaml:"red_max_threshold"`
+	REDMaxProbability float64 `yaml:"red_max_probability"`
+}
+
+func (q Queue) Validate() error {
+	if q.Size < 0 {
+		return errors.New("size is negative")
+	}
+
+	if q.DropPolicy != "" && q.DropPolicy != "tail" && q.DropPolicy != "red" {
+		return fmt.Errorf("drop_policy %s is invalid, must be tail or red", q.DropPolicy)
+	}
+
+	if q.REDMinThreshold < 0 || q.REDMaxThreshold < 0 {
+		return errors.New("red thresholds are negative")
+	}
+
+	if q.REDMaxThreshold != 0 && q.REDMaxThreshold <= q.REDMinThreshold {
+		return errors.New("red_max_threshold must be greater than red_min_threshold")
+	}
+
+	if q.Size != 0 && q.REDMaxThreshold > q.Size {
+		return errors.New("red_max_threshold is greater than size")
+	}
+
+	if q.REDMaxProbability < 0 || q.REDMaxProbability > 1 {
+		return errors.New("red_max_probability must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// QoS classifies received frames by priority and schedules the egress queues of a port
+type QoS struct {
+	// Trust is either pcp, dscp or none
+	Trust           string    `yaml:"trust"`
+	DefaultPriority uint8     `yaml:"default_priority"`
+	Rules           []QoSRule `yaml:"rules"`
+	Classes         int       `yaml:"classes"`
+	// Scheduler is either strict or weighted
+	Scheduler string `yaml:"scheduler"`
+	Weights   []int  `yaml:"weights"`
+}
+
+func (q QoS) Validate() error {
+	if q.Trust != "" && q.Trust != "pcp" && q.Trust != "dscp" && q.Trust != "none" {
+		return fmt.Errorf("trust %s is invalid, must be pcp, dscp or none", q.Trust)
+	}
+
+	if q.DefaultPriority > internal.MaxPriority {
+		return fmt.Errorf("default_priority %d is out of range", q.DefaultPriority)
+	}
+
+	for i, rule := range q.Rules {
+		if rule.Priority > internal.MaxPriority {
+			return fmt.Errorf("priority %d of rule at index %d is out of range", rule.Priority, i)
+		}
+	}
+
+	if q.Classes < 0 || q.Classes > internal.TrafficClasses {
+		return fmt.Errorf("classes %d is out of range", q.Classes)
+	}
+
+	if q.Scheduler != "" && q.Scheduler != "strict" && q.Scheduler != "weighted" {
+		return fmt.Errorf("scheduler %s is invalid, must be strict or weighted", q.Scheduler)
+	}
+
+	if len(q.Weights) > 0 && len(q.Weights) != max(q.Classes, 1) {
+		return errors.New("amount of weights does not match classes")
+	}
+
+	for _, weight := range q.Weights {
+		if weight <= 0 {
+			return errors.New("weights must be positive")
+		}
+	}
+
+	return nil
+}
+
+// QoSRule sets the priority of matching frames, fields that are not set match everything
+type QoSRule struct {
+	EtherType  uint16 `yaml:"ether_type"`
+	IPProtocol uint8  `yaml:"ip_protocol"`
+	// Port matches the TCP or UDP source or destination port
+	Port     uint16 `yaml:"port"`
+	Priority uint8  `yaml:"priority"`
+}
+
+// PortSecurity restricts the source macs of a port to the allowed macs and the first sticky_macs seen macs
+type PortSecurity struct {
+	AllowedMACs []string `yaml:"allowed_macs"`
+	StickyMACs  int      `yaml:"sticky_macs"`
+	// Violation is either drop, log or shutdown
+	Violation string `yaml:"violation"`
+	// Recovery enables a shut down port again after the duration, never if 0
+	Recovery time.Duration `yaml:"recovery"`
+}
+
+func (s PortSecurity) Validate() error {
+	for _, mac := range s.AllowedMACs {
+		_, err := parseUnicastMAC(mac)
+		if err != nil {
+			return fmt.Errorf("failed to parse mac %s with error: %v", mac, err)
+		}
+	}
+
+	if s.StickyMACs < 0 {
+		return errors.New("sticky_macs is negative")
+	}
+
+	if s.Violation != "" && s.Violation != "drop" && s.Violation != "log" && s.Violation != "shutdown" {
+		return fmt.Errorf("violation %s is invalid, must be drop, log or shutdown", s.Violation)
+	}
+
+	if s.Recovery < 0 {
+		return errors.New("recovery is negative")
+	}
+
+	return nil
+}
+
+// PortACL filters the frames received on and sent to a port
+type PortACL struct {
+	Ingress ACL `yaml:"ingress"`
+	Egress  ACL `yaml:"egress"`
+}
+
+// ACL is an ordered list of rules, the action of the first matching rule is applied to a frame
+type ACL struct {
+	// DefaultAction is either allow or deny and applied to frames no rule matches
+	DefaultAction string    `yaml:"default_action"`
+	Rules         []ACLRule `yaml:"rules"`
+}
+
+func (a ACL) Validate() error {
+	if a.DefaultAction != "" && a.DefaultAction != "allow" && a.DefaultAction != "deny" {
+		return fmt.Errorf("default_action %s is invalid, must be allow or deny", a.DefaultAction)
+	}
+
+	for i, rule := range a.Rules {
+		err := rule.Validate()
+		if err != nil {
+			return fmt.Errorf("failed to validate rule at index %d with error: %v", i, err)
+		}
+	}
+
+	return nil
+}
+
+// ACLRule matches frames by their headers, fields that are not set match everything
+type ACLRule struct {
+	// Action is either allow or deny
+	Action         string `yaml:"action"`
+	SourceMAC      string `yaml:"source_mac"`
+	DestinationMAC string `yaml:"destination_mac"`
+	EtherType      uint16 `yaml:"ether_type"`
+	VLAN           uint16 `yaml:"vlan"`
+	// SourceIP and DestinationIP are addresses or CIDR networks
+	SourceIP        string `yaml:"source_ip"`
+	DestinationIP   string `yaml:"destination_ip"`
+	Protocol        uint8  `yaml:"protocol"`
+	SourcePort      uint16 `yaml:"source_port"`
+	DestinationPort uint16 `yaml:"destination_port"`
+}
+
+func (r ACLRule) Validate() error {
+	if r.Action != "allow" && r.Action != "deny" {
+		return fmt.Errorf("action %s is invalid, must be allow or deny", r.Action)
+	}
+
+	for _, mac := range []string{r.SourceMAC, r.DestinationMAC} {
+		if mac == "" {
+			continue
+		}
+
+		_, err := parseEthernetMAC(mac)
+		if err != nil {
+			return fmt.Errorf("failed to parse mac %s with error: %v", mac, err)
+		}
+	}
+
+	if r.VLAN > internal.MaxVLAN {
+		return fmt.Errorf("vlan %d is out of range", r.VLAN)
+	}
+
+	for _, ip := range []string{r.SourceIP, r.DestinationIP} {
+		if ip == "" {
+			continue
+		}
+
+		_, err := ParseIPNet(ip)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ParseIPNet parses an IP address or CIDR network, addresses are networks of a single address
+func ParseIPNet(s string) (*net.IPNet, error) {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err == nil {
+		return ipNet, nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("%s is neither an ip address or network", s)
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// RateLimit limits the traffic of a port, rates are in bits per second and bursts in bytes, 0 is unlimited
+type RateLimit struct {
+	Ingress      uint64 `yaml:"ingress"`
+	IngressBurst uint64 `yaml:"ingress_burst"`
+	Egress       uint64 `yaml:"egress"`
+	EgressBurst  uint64 `yaml:"egress_burst"`
+}
+
+// StormControl limits the flooded frames received on a port in frames per second, 0 is unlimited
+type StormControl struct {
+	Broadcast      uint64 `yaml:"broadcast"`
+	Multicast      uint64 `yaml:"multicast"`
+	UnknownUnicast uint64 `yaml:"unknown_unicast"`
+}
+
+// FloodSuppression stops flooded frames from being sent to a port
+type FloodSuppression struct {
+	Broadcast      bool `yaml:"broadcast"`
+	Multicast      bool `yaml:"multicast"`
+	UnknownUnicast bool `yaml:"unknown_unicast"`
 }
 
 type TAPNIC struct {
@@ -142,10 +1181,74 @@ func (t TAPNIC) Validate() error {
 	return nil
 }
 
+// TUNNIC is a layer 3 device the switch sees as a host with the addresses of the device
+type TUNNIC struct {
+	Name string `yaml:"name"`
+	// MAC is random if empty
+	MAC       string   `yaml:"mac"`
+	Addresses []string `yaml:"addresses"`
+	// Gateways are the next hops of destinations outside the subnets of the addresses
+	Gateways []string `yaml:"gateways"`
+}
+
+func (t TUNNIC) Validate() error {
+	if t.Name == "" {
+		return errors.New("name is empty")
+	}
+
+	if t.MAC != "" {
+		_, err := parseUnicastMAC(t.MAC)
+		if err != nil {
+			return fmt.Errorf("failed to parse mac with error: %v", err)
+		}
+	}
+
+	var subnets []netip.Prefix
+	for i, a := range t.Addresses {
+		address, err := netip.ParsePrefix(a)
+		if err != nil {
+			return fmt.Errorf("failed to parse address at index %d with error: %v", i, err)
+		}
+
+		subnets = append(subnets, address.Masked())
+	}
+
+	families := map[bool]bool{}
+	for i, g := range t.Gateways {
+		gateway, err := netip.ParseAddr(g)
+		if err != nil {
+			return fmt.Errorf("failed to parse gateway at index %d with error: %v", i, err)
+		}
+
+		if families[gateway.Is4()] {
+			return fmt.Errorf("gateway at index %d is not the only gateway of its address family", i)
+		}
+
+		families[gateway.Is4()] = true
+
+		connected := false
+		for _, subnet := range subnets {
+			if subnet.Contains(gateway) {
+				connected = true
+				break
+			}
+		}
+
+		if !connected && !(gateway.Is6() && gateway.IsLinkLocalUnicast()) {
+			return fmt.Errorf("gateway %s at index %d is not in a subnet of an address", g, i)
+		}
+	}
+
+	return nil
+}
+
+// Peer is a remote trestle instance, peers without a hostname are only accepted
 type Peer struct {
-	Name     string `yaml:"name"`
-	Hostname string `yaml:"hostname"`
-	Port     uint16 `yaml:"port"`
+	Name         string `yaml:"name"`
+	Hostname     string `yaml:"hostname"`
+	Port         uint16 `yaml:"port"`
+	PublicKey    string `yaml:"public_key"`
+	PresharedKey string `yaml:"preshared_key"`
 }
 
 func (p Peer) Validate() error {
@@ -153,12 +1256,20 @@ func (p Peer) Validate() error {
 		return errors.New("name is empty")
 	}
 
-	if p.Hostname == "" {
-		return errors.New("hostname is empty")
+	if p.Hostname != "" && p.Port == 0 {
+		return errors.New("port is 0")
 	}
 
-	if p.Port == 0 {
-		return errors.New("port is 0")
+	_, err := DecodeKey(p.PublicKey)
+	if err != nil {
+		return fmt.Errorf("failed to decode public_key with error: %v", err)
+	}
+
+	if p.PresharedKey != "" {
+		_, err = DecodeKey(p.PresharedKey)
+		if err != nil {
+			return fmt.Errorf("failed to decode preshared_key with error: %v", err)
+		}
 	}
 
 	return nil
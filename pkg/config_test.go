@@ -0,0 +1,1014 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/lucasl0st/trestle/internal"
+	"testing"
+	"time"
+)
+
+// addresses returns n addresses formatted by format from 1 on
+func addresses(format string, n int) []string {
+	var a []string
+	for i := 1; i <= n; i++ {
+		a = append(a, fmt.Sprintf(format, i))
+	}
+
+	return a
+}
+
+func TestDHCPServerValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		server DHCPServer
+		valid  bool
+	}{
+		{
+			name:   "disabled",
+			server: DHCPServer{Address: "invalid"},
+			valid:  true,
+		},
+		{
+			name: "valid",
+			server: DHCPServer{
+				Enabled:      true,
+				Address:      "10.0.0.1/24",
+				Pools:        []DHCPPool{{Start: "10.0.0.100", End: "10.0.0.200"}},
+				Reservations: []DHCPReservation{{MAC: "02:00:00:00:00:01", IP: "10.0.0.10"}},
+				Router:       "10.0.0.1",
+				DNS:          addresses("10.0.1.%d", 63),
+			},
+			valid: true,
+		},
+		{
+			name:   "too many dns servers",
+			server: DHCPServer{Enabled: true, Address: "10.0.0.1/24", DNS: addresses("10.0.1.%d", 64)},
+		},
+		{
+			name:   "ipv6 dns server",
+			server: DHCPServer{Enabled: true, Address: "10.0.0.1/24", DNS: []string{"2001:db8::1"}},
+		},
+		{
+			name:   "pool outside of subnet",
+			server: DHCPServer{Enabled: true, Address: "10.0.0.1/24", Pools: []DHCPPool{{Start: "10.0.1.100", End: "10.0.1.200"}}},
+		},
+		{
+			name:   "pool ends before its start",
+			server: DHCPServer{Enabled: true, Address: "10.0.0.1/24", Pools: []DHCPPool{{Start: "10.0.0.200", End: "10.0.0.100"}}},
+		},
+		{
+			name: "duplicate reservation",
+			server: DHCPServer{Enabled: true, Address: "10.0.0.1/24", Reservations: []DHCPReservation{
+				{MAC: "02:00:00:00:00:01", IP: "10.0.0.10"},
+				{MAC: "02:00:00:00:00:02", IP: "10.0.0.10"},
+			}},
+		},
+		{
+			name:   "pools without address",
+			server: DHCPServer{Enabled: true, Pools: []DHCPPool{{Start: "10.0.0.100", End: "10.0.0.200"}}},
+		},
+		{
+			name:   "router advertisement only",
+			server: DHCPServer{Enabled: true, RouterAdvertisement: RouterAdvertisement{Prefixes: []string{"2001:db8::/64"}}},
+			valid:  true,
+		},
+		{
+			name: "too many router advertisement dns servers",
+			server: DHCPServer{Enabled: true, RouterAdvertisement: RouterAdvertisement{
+				Prefixes: []string{"2001:db8::/64"},
+				DNS:      addresses("2001:db8::%x", 64),
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.server.Validate()
+			if test.valid && err != nil {
+				t.Fatalf("failed to validate with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("invalid server is valid")
+			}
+		})
+	}
+}
+
+func TestRouterAdvertisementValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		ra    RouterAdvertisement
+		valid bool
+	}{
+		{
+			name:  "valid",
+			ra:    RouterAdvertisement{Prefixes: []string{"2001:db8::/64"}, DNS: addresses("2001:db8::%x", 63)},
+			valid: true,
+		},
+		{
+			name: "too many dns servers",
+			ra:   RouterAdvertisement{Prefixes: []string{"2001:db8::/64"}, DNS: addresses("2001:db8::%x", 64)},
+		},
+		{
+			name: "ipv4 dns server",
+			ra:   RouterAdvertisement{Prefixes: []string{"2001:db8::/64"}, DNS: []string{"10.0.0.1"}},
+		},
+		{
+			name: "prefix is not /64",
+			ra:   RouterAdvertisement{Prefixes: []string{"2001:db8::/48"}},
+		},
+		{
+			name: "negative interval",
+			ra:   RouterAdvertisement{Prefixes: []string{"2001:db8::/64"}, Interval: -1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.ra.Validate()
+			if test.valid && err != nil {
+				t.Fatalf("failed to validate with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("invalid router advertisement is valid")
+			}
+		})
+	}
+}
+
+func TestListenerValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		listener Listener
+		valid    bool
+	}{
+		{
+			name:     "defaults",
+			listener: Listener{Hostname: "0.0.0.0"},
+			valid:    true,
+		},
+		{
+			name:     "empty hostname",
+			listener: Listener{},
+		},
+		{
+			name:     "negative keepalive interval",
+			listener: Listener{Hostname: "0.0.0.0", KeepaliveInterval: -time.Second},
+		},
+		{
+			name:     "negative peer timeout",
+			listener: Listener{Hostname: "0.0.0.0", PeerTimeout: -time.Second},
+		},
+		{
+			name:     "peer timeout of two keepalives",
+			listener: Listener{Hostname: "0.0.0.0", KeepaliveInterval: time.Second, PeerTimeout: 2 * time.Second},
+			valid:    true,
+		},
+		{
+			name:     "peer timeout below two keepalives",
+			listener: Listener{Hostname: "0.0.0.0", KeepaliveInterval: time.Second, PeerTimeout: 1500 * time.Millisecond},
+		},
+		{
+			name:     "peer timeout below two default keepalives",
+			listener: Listener{Hostname: "0.0.0.0", PeerTimeout: internal.DefaultKeepaliveInterval},
+		},
+		{
+			name:     "keepalive interval above the default peer timeout",
+			listener: Listener{Hostname: "0.0.0.0", KeepaliveInterval: internal.DefaultPeerTimeout},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.listener.Validate()
+			if test.valid && err != nil {
+				t.Fatalf("failed to validate with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("invalid listener is valid")
+			}
+		})
+	}
+}
+
+func TestVLANValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		vlan  VLAN
+		valid bool
+	}{
+		{
+			name:  "defaults",
+			vlan:  VLAN{},
+			valid: true,
+		},
+		{
+			name:  "access",
+			vlan:  VLAN{Mode: "access", PVID: 10},
+			valid: true,
+		},
+		{
+			name:  "trunk",
+			vlan:  VLAN{Mode: "trunk", PVID: 1, Allowed: []uint16{10, internal.MaxVLAN}},
+			valid: true,
+		},
+		{
+			name: "invalid mode",
+			vlan: VLAN{Mode: "hybrid"},
+		},
+		{
+			name: "pvid out of range",
+			vlan: VLAN{PVID: internal.MaxVLAN + 1},
+		},
+		{
+			name: "allowed on access port",
+			vlan: VLAN{Mode: "access", Allowed: []uint16{10}},
+		},
+		{
+			name: "allowed vlan 0",
+			vlan: VLAN{Mode: "trunk", Allowed: []uint16{0}},
+		},
+		{
+			name: "allowed vlan out of range",
+			vlan: VLAN{Mode: "trunk", Allowed: []uint16{internal.MaxVLAN + 1}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.vlan.Validate()
+			if test.valid && err != nil {
+				t.Fatalf("failed to validate with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("invalid vlan is valid")
+			}
+		})
+	}
+}
+
+func TestQueueValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		queue Queue
+		valid bool
+	}{
+		{
+			name:  "defaults",
+			queue: Queue{},
+			valid: true,
+		},
+		{
+			name:  "red",
+			queue: Queue{Size: 100, DropPolicy: "red", REDMinThreshold: 20, REDMaxThreshold: 80, REDMaxProbability: 0.5},
+			valid: true,
+		},
+		{
+			name:  "negative size",
+			queue: Queue{Size: -1},
+		},
+		{
+			name:  "invalid drop policy",
+			queue: Queue{DropPolicy: "head"},
+		},
+		{
+			name:  "negative threshold",
+			queue: Queue{REDMinThreshold: -1},
+		},
+		{
+			name:  "max threshold below min threshold",
+			queue: Queue{REDMinThreshold: 80, REDMaxThreshold: 20},
+		},
+		{
+			name:  "max threshold above size",
+			queue: Queue{Size: 100, REDMaxThreshold: 200},
+		},
+		{
+			name:  "max probability above 1",
+			queue: Queue{REDMaxProbability: 1.5},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.queue.Validate()
+			if test.valid && err != nil {
+				t.Fatalf("failed to validate with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("invalid queue is valid")
+			}
+		})
+	}
+}
+
+func TestQoSValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		qos   QoS
+		valid bool
+	}{
+		{
+			name:  "defaults",
+			qos:   QoS{},
+			valid: true,
+		},
+		{
+			name: "weighted",
+			qos: QoS{
+				Trust:     "dscp",
+				Rules:     []QoSRule{{IPProtocol: 17, Port: 5060, Priority: internal.MaxPriority}},
+				Classes:   2,
+				Scheduler: "weighted",
+				Weights:   []int{1, 4},
+			},
+			valid: true,
+		},
+		{
+			name: "invalid trust",
+			qos:  QoS{Trust: "tos"},
+		},
+		{
+			name: "default priority out of range",
+			qos:  QoS{DefaultPriority: internal.MaxPriority + 1},
+		},
+		{
+			name: "rule priority out of range",
+			qos:  QoS{Rules: []QoSRule{{Priority: internal.MaxPriority + 1}}},
+		},
+		{
+			name: "too many classes",
+			qos:  QoS{Classes: internal.TrafficClasses + 1},
+		},
+		{
+			name: "invalid scheduler",
+			qos:  QoS{Scheduler: "fair"},
+		},
+		{
+			name: "weights do not match classes",
+			qos:  QoS{Classes: 2, Scheduler: "weighted", Weights: []int{1}},
+		},
+		{
+			name: "weight is not positive",
+			qos:  QoS{Classes: 2, Scheduler: "weighted", Weights: []int{1, 0}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.qos.Validate()
+			if test.valid && err != nil {
+				t.Fatalf("failed to validate with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("invalid qos is valid")
+			}
+		})
+	}
+}
+
+func TestMirrorValidate(t *testing.T) {
+	portNames := map[string]bool{"a": true, "b": true, "m": true}
+
+	tests := []struct {
+		name   string
+		mirror Mirror
+		valid  bool
+	}{
+		{
+			name:   "disabled",
+			mirror: Mirror{},
+			valid:  true,
+		},
+		{
+			name:   "ports",
+			mirror: Mirror{Enabled: true, Monitor: "m", Ports: []string{"a", "b"}, Direction: "ingress"},
+			valid:  true,
+		},
+		{
+			name:   "vlans",
+			mirror: Mirror{Monitor: "m", VLANs: []uint16{1, internal.MaxVLAN}},
+			valid:  true,
+		},
+		{
+			name:   "enabled without monitor",
+			mirror: Mirror{Enabled: true},
+		},
+		{
+			name:   "ports without monitor",
+			mirror: Mirror{Ports: []string{"a"}},
+		},
+		{
+			name:   "unknown monitor",
+			mirror: Mirror{Monitor: "c", Ports: []string{"a"}},
+		},
+		{
+			name:   "neither ports or vlans",
+			mirror: Mirror{Monitor: "m"},
+		},
+		{
+			name:   "unknown port",
+			mirror: Mirror{Monitor: "m", Ports: []string{"c"}},
+		},
+		{
+			name:   "monitor is mirrored",
+			mirror: Mirror{Monitor: "m", Ports: []string{"m"}},
+		},
+		{
+			name:   "vlan out of range",
+			mirror: Mirror{Monitor: "m", VLANs: []uint16{internal.MaxVLAN + 1}},
+		},
+		{
+			name:   "invalid direction",
+			mirror: Mirror{Monitor: "m", Ports: []string{"a"}, Direction: "up"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.mirror.Validate(portNames)
+			if test.valid && err != nil {
+				t.Fatalf("failed to validate with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("invalid mirror is valid")
+			}
+		})
+	}
+}
+
+func TestCaptureValidate(t *testing.T) {
+	portNames := map[string]bool{"a": true}
+
+	tests := []struct {
+		name    string
+		capture Capture
+		valid   bool
+	}{
+		{
+			name:    "disabled",
+			capture: Capture{Ports: []string{"b"}, MaxFiles: -1},
+			valid:   true,
+		},
+		{
+			name:    "valid",
+			capture: Capture{Directory: "/tmp", Ports: []string{"a"}, MaxFileSize: 1 << 20, RotateInterval: time.Hour, MaxFiles: 10, SnapLength: 128},
+			valid:   true,
+		},
+		{
+			name:    "unknown port",
+			capture: Capture{Directory: "/tmp", Ports: []string{"b"}},
+		},
+		{
+			name:    "negative max file size",
+			capture: Capture{Directory: "/tmp", MaxFileSize: -1},
+		},
+		{
+			name:    "negative rotate interval",
+			capture: Capture{Directory: "/tmp", RotateInterval: -time.Second},
+		},
+		{
+			name:    "negative max files",
+			capture: Capture{Directory: "/tmp", MaxFiles: -1},
+		},
+		{
+			name:    "negative snap length",
+			capture: Capture{Directory: "/tmp", SnapLength: -1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.capture.Validate(portNames)
+			if test.valid && err != nil {
+				t.Fatalf("failed to validate with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("invalid capture is valid")
+			}
+		})
+	}
+}
+
+func TestACLValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		acl   ACL
+		valid bool
+	}{
+		{
+			name:  "defaults",
+			acl:   ACL{},
+			valid: true,
+		},
+		{
+			name: "valid",
+			acl: ACL{DefaultAction: "deny", Rules: []ACLRule{
+				{Action: "allow", SourceMAC: "02:00:00:00:00:01", DestinationMAC: "ff:ff:ff:ff:ff:ff", VLAN: internal.MaxVLAN},
+				{Action: "allow", SourceIP: "10.0.0.0/24", DestinationIP: "2001:db8::1", Protocol: 6, DestinationPort: 22},
+			}},
+			valid: true,
+		},
+		{
+			name: "invalid default action",
+			acl:  ACL{DefaultAction: "drop"},
+		},
+		{
+			name: "rule without action",
+			acl:  ACL{Rules: []ACLRule{{EtherType: 0x0806}}},
+		},
+		{
+			name: "invalid mac",
+			acl:  ACL{Rules: []ACLRule{{Action: "deny", SourceMAC: "02:00:00:00:00"}}},
+		},
+		{
+			name: "mac longer than 6 bytes",
+			acl:  ACL{Rules: []ACLRule{{Action: "deny", DestinationMAC: "02:00:00:00:00:00:00:01"}}},
+		},
+		{
+			name: "vlan out of range",
+			acl:  ACL{Rules: []ACLRule{{Action: "deny", VLAN: internal.MaxVLAN + 1}}},
+		},
+		{
+			name: "invalid ip",
+			acl:  ACL{Rules: []ACLRule{{Action: "deny", SourceIP: "10.0.0.256"}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.acl.Validate()
+			if test.valid && err != nil {
+				t.Fatalf("failed to validate with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("invalid acl is valid")
+			}
+		})
+	}
+}
+
+func TestParseIPNet(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected string
+	}{
+		{s: "10.0.0.1", expected: "10.0.0.1/32"},
+		{s: "10.0.0.1/24", expected: "10.0.0.0/24"},
+		{s: "2001:db8::1", expected: "2001:db8::1/128"},
+		{s: "2001:db8::1/64", expected: "2001:db8::/64"},
+		{s: "example.com"},
+	}
+
+	for _, test := range tests {
+		ipNet, err := ParseIPNet(test.s)
+		if test.expected == "" {
+			if err == nil {
+				t.Fatalf("parsed %s", test.s)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ipNet.String() != test.expected {
+			t.Fatalf("parsed %s as %s, expected %s", test.s, ipNet, test.expected)
+		}
+	}
+}
+
+func TestPortSecurityValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		security PortSecurity
+		valid    bool
+	}{
+		{
+			name:     "defaults",
+			security: PortSecurity{},
+			valid:    true,
+		},
+		{
+			name:     "valid",
+			security: PortSecurity{AllowedMACs: []string{"02:00:00:00:00:01"}, StickyMACs: 2, Violation: "shutdown", Recovery: time.Minute},
+			valid:    true,
+		},
+		{
+			name:     "multicast mac",
+			security: PortSecurity{AllowedMACs: []string{"01:00:5e:00:00:01"}},
+		},
+		{
+			name:     "invalid mac",
+			security: PortSecurity{AllowedMACs: []string{"02:00:00:00:00"}},
+		},
+		{
+			name:     "negative sticky macs",
+			security: PortSecurity{StickyMACs: -1},
+		},
+		{
+			name:     "invalid violation",
+			security: PortSecurity{Violation: "block"},
+		},
+		{
+			name:     "negative recovery",
+			security: PortSecurity{Violation: "shutdown", Recovery: -time.Second},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.security.Validate()
+			if test.valid && err != nil {
+				t.Fatalf("failed to validate with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("invalid port security is valid")
+			}
+		})
+	}
+}
+
+// testSwitch returns a valid switch with a tapnic and a peer port
+func testSwitch() Switch {
+	return Switch{
+		Name:       "sw",
+		MTU:        1500,
+		NetworkMTU: 1400,
+		PrivateKey: EncodeKey([KeySize]byte{1}),
+		Listener:   Listener{Hostname: "0.0.0.0"},
+		Ports: []Port{
+			{TAPNIC: TAPNIC{Name: "tap0"}},
+			{Peer: Peer{Name: "b", PublicKey: EncodeKey([KeySize]byte{2})}},
+		},
+	}
+}
+
+func TestSwitchValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(s *Switch)
+		valid  bool
+	}{
+		{
+			name:   "valid",
+			modify: func(s *Switch) {},
+			valid:  true,
+		},
+		{
+			name:   "network mtu below minimum",
+			modify: func(s *Switch) { s.NetworkMTU = minNetworkMTU - 1 },
+		},
+		{
+			name:   "mac aging time",
+			modify: func(s *Switch) { s.MACAgingTime = minMACAgingTime },
+			valid:  true,
+		},
+		{
+			name:   "mac aging time below minimum",
+			modify: func(s *Switch) { s.MACAgingTime = minMACAgingTime / 2 },
+		},
+		{
+			name:   "negative max macs",
+			modify: func(s *Switch) { s.MaxMACs = -1 },
+		},
+		{
+			name:   "negative port max macs",
+			modify: func(s *Switch) { s.Ports[0].MaxMACs = -1 },
+		},
+		{
+			name:   "no ports",
+			modify: func(s *Switch) { s.Ports = nil },
+		},
+		{
+			name:   "duplicate port names",
+			modify: func(s *Switch) { s.Ports = append(s.Ports, Port{TAPNIC: TAPNIC{Name: "tap0"}}) },
+		},
+		{
+			name: "duplicate peer keys",
+			modify: func(s *Switch) {
+				s.Ports = append(s.Ports, Port{Peer: Peer{Name: "c", PublicKey: s.Ports[1].Peer.PublicKey}})
+			},
+		},
+		{
+			name:   "port named like the dhcp server",
+			modify: func(s *Switch) { s.DHCPServer.Enabled = true; s.Ports[0].TAPNIC.Name = dhcpServerPortName },
+		},
+		{
+			name:   "mirror to a port",
+			modify: func(s *Switch) { s.Mirror = Mirror{Monitor: "tap0", Ports: []string{"b"}} },
+			valid:  true,
+		},
+		{
+			name:   "mirror of an unknown port",
+			modify: func(s *Switch) { s.Mirror = Mirror{Monitor: "tap0", Ports: []string{"c"}} },
+		},
+		{
+			name:   "negative neighbor binding timeout",
+			modify: func(s *Switch) { s.Neighbor.BindingTimeout = -time.Second },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := testSwitch()
+			test.modify(&s)
+
+			err := s.Validate()
+			if test.valid && err != nil {
+				t.Fatalf("failed to validate with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("invalid switch is valid")
+			}
+		})
+	}
+}
+
+// testRouter returns a valid router between the switches a and b
+func testRouter() Router {
+	return Router{
+		Name: "r",
+		Interfaces: []RouterInterface{
+			{Switch: "a", Addresses: []string{"10.0.1.1/24", "fd01::1/64"}},
+			{Switch: "b", Addresses: []string{"10.0.2.1/24"}},
+		},
+		Routes: []Route{{Prefix: "192.168.0.0/16", Via: "10.0.2.20"}},
+	}
+}
+
+func TestRouterValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(r *Router)
+		valid  bool
+	}{
+		{
+			name:   "valid",
+			modify: func(r *Router) {},
+			valid:  true,
+		},
+		{
+			name:   "empty name",
+			modify: func(r *Router) { r.Name = "" },
+		},
+		{
+			name:   "no interfaces",
+			modify: func(r *Router) { r.Interfaces = nil },
+		},
+		{
+			name:   "unknown switch",
+			modify: func(r *Router) { r.Interfaces[1].Switch = "c" },
+		},
+		{
+			name:   "port name of a switch port",
+			modify: func(r *Router) { r.Interfaces[0].Name = "tap0" },
+		},
+		{
+			name: "two interfaces on a switch",
+			modify: func(r *Router) {
+				r.Interfaces = append(r.Interfaces, RouterInterface{Switch: "a", Addresses: []string{"10.0.3.1/24"}})
+			},
+		},
+		{
+			name: "two named interfaces on a switch",
+			modify: func(r *Router) {
+				r.Interfaces = append(r.Interfaces, RouterInterface{Switch: "a", Name: "r2", VLAN: 10, Addresses: []string{"10.0.3.1/24"}})
+			},
+			valid: true,
+		},
+		{
+			name:   "multicast mac",
+			modify: func(r *Router) { r.Interfaces[0].MAC = "01:00:5e:00:00:01" },
+		},
+		{
+			name:   "vlan out of range",
+			modify: func(r *Router) { r.Interfaces[0].VLAN = 4095 },
+		},
+		{
+			name:   "no addresses",
+			modify: func(r *Router) { r.Interfaces[1].Addresses = nil },
+		},
+		{
+			name:   "invalid address",
+			modify: func(r *Router) { r.Interfaces[1].Addresses = []string{"10.0.2.1"} },
+		},
+		{
+			name:   "overlapping subnets",
+			modify: func(r *Router) { r.Interfaces[1].Addresses = []string{"10.0.0.1/16"} },
+		},
+		{
+			name:   "ipv6 route",
+			modify: func(r *Router) { r.Routes = append(r.Routes, Route{Prefix: "2001:db8::/32", Via: "fd01::20"}) },
+			valid:  true,
+		},
+		{
+			name:   "invalid prefix",
+			modify: func(r *Router) { r.Routes[0].Prefix = "192.168.0.0" },
+		},
+		{
+			name:   "invalid via",
+			modify: func(r *Router) { r.Routes[0].Via = "10.0.2" },
+		},
+		{
+			name:   "via of other address family",
+			modify: func(r *Router) { r.Routes[0].Via = "fd01::20" },
+		},
+		{
+			name:   "via outside the subnets",
+			modify: func(r *Router) { r.Routes[0].Via = "10.0.3.20" },
+		},
+	}
+
+	switchPorts := map[string]map[string]bool{
+		"a": {"tap0": true},
+		"b": {},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := testRouter()
+			test.modify(&r)
+
+			err := r.Validate(switchPorts)
+			if test.valid && err != nil {
+				t.Fatalf("failed to validate with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("invalid router is valid")
+			}
+		})
+	}
+}
+
+func TestPatchValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch Patch
+		valid bool
+	}{
+		{name: "valid", patch: Patch{Name: "to-b", Switch: "b", Port: "to-a"}, valid: true},
+		{name: "empty switch", patch: Patch{Name: "to-b", Port: "to-a"}},
+		{name: "empty port", patch: Patch{Name: "to-b", Switch: "b"}},
+		{
+			name:  "vlan translation",
+			patch: Patch{Name: "to-b", Switch: "b", Port: "to-a", VLANTranslation: []VLANTranslation{{Local: 10, Remote: 100}, {Local: 20, Remote: 10}}},
+			valid: true,
+		},
+		{
+			name:  "local vlan out of range",
+			patch: Patch{Name: "to-b", Switch: "b", Port: "to-a", VLANTranslation: []VLANTranslation{{Local: 0, Remote: 100}}},
+		},
+		{
+			name:  "remote vlan out of range",
+			patch: Patch{Name: "to-b", Switch: "b", Port: "to-a", VLANTranslation: []VLANTranslation{{Local: 10, Remote: 4095}}},
+		},
+		{
+			name:  "local vlan not unique",
+			patch: Patch{Name: "to-b", Switch: "b", Port: "to-a", VLANTranslation: []VLANTranslation{{Local: 10, Remote: 100}, {Local: 10, Remote: 200}}},
+		},
+		{
+			name:  "remote vlan not unique",
+			patch: Patch{Name: "to-b", Switch: "b", Port: "to-a", VLANTranslation: []VLANTranslation{{Local: 10, Remote: 100}, {Local: 20, Remote: 100}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.patch.Validate()
+			if test.valid && err != nil {
+				t.Fatalf("failed to validate with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("invalid patch is valid")
+			}
+		})
+	}
+}
+
+func TestTUNNICValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		nic   TUNNIC
+		valid bool
+	}{
+		{name: "valid", nic: TUNNIC{Name: "tun0"}, valid: true},
+		{name: "empty name", nic: TUNNIC{}},
+		{name: "mac", nic: TUNNIC{Name: "tun0", MAC: "02:00:00:00:00:01"}, valid: true},
+		{name: "multicast mac", nic: TUNNIC{Name: "tun0", MAC: "01:00:5e:00:00:01"}},
+		{name: "invalid address", nic: TUNNIC{Name: "tun0", Addresses: []string{"10.0.0.5"}}},
+		{
+			name:  "gateways",
+			nic:   TUNNIC{Name: "tun0", Addresses: []string{"10.0.0.5/24", "fd00::5/64"}, Gateways: []string{"10.0.0.1", "fd00::1"}},
+			valid: true,
+		},
+		{
+			name:  "link-local gateway",
+			nic:   TUNNIC{Name: "tun0", Addresses: []string{"fd00::5/64"}, Gateways: []string{"fe80::1"}},
+			valid: true,
+		},
+		{
+			name: "invalid gateway",
+			nic:  TUNNIC{Name: "tun0", Addresses: []string{"10.0.0.5/24"}, Gateways: []string{"10.0.0"}},
+		},
+		{
+			name: "two gateways of an address family",
+			nic:  TUNNIC{Name: "tun0", Addresses: []string{"10.0.0.5/24"}, Gateways: []string{"10.0.0.1", "10.0.0.2"}},
+		},
+		{
+			name: "gateway outside the subnets",
+			nic:  TUNNIC{Name: "tun0", Addresses: []string{"10.0.0.5/24"}, Gateways: []string{"10.0.1.1"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.nic.Validate()
+			if test.valid && err != nil {
+				t.Fatalf("failed to validate with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("invalid tun nic is valid")
+			}
+		})
+	}
+}
+
+func TestPortValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		port  Port
+		valid bool
+	}{
+		{name: "tapnic", port: Port{TAPNIC: TAPNIC{Name: "tap0"}}, valid: true},
+		{name: "tunnic", port: Port{TUNNIC: TUNNIC{Name: "tun0"}}, valid: true},
+		{name: "peer", port: Port{Peer: Peer{Name: "b", PublicKey: EncodeKey([KeySize]byte{2})}}, valid: true},
+		{name: "patch", port: Port{Patch: Patch{Name: "to-b", Switch: "b", Port: "to-a"}}, valid: true},
+		{name: "no port type", port: Port{}},
+		{name: "tapnic and tunnic", port: Port{TAPNIC: TAPNIC{Name: "tap0"}, TUNNIC: TUNNIC{Name: "tun0"}}},
+		{name: "tunnic and patch", port: Port{TUNNIC: TUNNIC{Name: "tun0"}, Patch: Patch{Name: "to-b", Switch: "b", Port: "to-a"}}},
+		{name: "invalid tunnic", port: Port{TUNNIC: TUNNIC{Name: "tun0", Addresses: []string{"10.0.0.5"}}}},
+		{name: "invalid patch", port: Port{Patch: Patch{Name: "to-b", Switch: "b"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.port.Validate()
+			if test.valid && err != nil {
+				t.Fatalf("failed to validate with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("invalid port is valid")
+			}
+		})
+	}
+}
+
+func TestPeerValidate(t *testing.T) {
+	key := EncodeKey([KeySize]byte{2})
+
+	tests := []struct {
+		name  string
+		peer  Peer
+		valid bool
+	}{
+		{name: "accepted peer", peer: Peer{Name: "b", PublicKey: key}, valid: true},
+		{name: "outbound peer", peer: Peer{Name: "b", Hostname: "b.example.com", Port: 8000, PublicKey: key}, valid: true},
+		{name: "preshared key", peer: Peer{Name: "b", PublicKey: key, PresharedKey: EncodeKey([KeySize]byte{3})}, valid: true},
+		{name: "empty name", peer: Peer{PublicKey: key}},
+		{name: "hostname without port", peer: Peer{Name: "b", Hostname: "b.example.com", PublicKey: key}},
+		{name: "no public key", peer: Peer{Name: "b"}},
+		{name: "invalid public key", peer: Peer{Name: "b", PublicKey: key[:len(key)-4]}},
+		{name: "invalid preshared key", peer: Peer{Name: "b", PublicKey: key, PresharedKey: "key"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.peer.Validate()
+			if test.valid && err != nil {
+				t.Fatalf("failed to validate with error: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("invalid peer is valid")
+			}
+		})
+	}
+}
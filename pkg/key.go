@@ -0,0 +1,35 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+const KeySize = 32
+
+// DecodeKey decodes a base64 encoded 32 byte key
+func DecodeKey(key string) ([KeySize]byte, error) {
+	var k [KeySize]byte
+
+	if key == "" {
+		return k, errors.New("key is empty")
+	}
+
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return k, err
+	}
+
+	if len(b) != KeySize {
+		return k, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(b))
+	}
+
+	copy(k[:], b)
+	return k, nil
+}
+
+// EncodeKey encodes a 32 byte key as base64
+func EncodeKey(key [KeySize]byte) string {
+	return base64.StdEncoding.EncodeToString(key[:])
+}
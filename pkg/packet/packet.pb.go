@@ -23,25 +23,31 @@ const (
 type PacketType int32
 
 const (
-	PacketType_HELO             PacketType = 0 // HELO package is just a package to initiate the connection, does not contain any data
-	PacketType_INITIATE_SESSION PacketType = 1 // the INITIATE_SESSION packet gets send by the initiator to start the session
-	PacketType_ACK_SESSION      PacketType = 2 // the ACK_SESSION packet gets send by the respondent to acknowledge the session
-	PacketType_FRAGMENTED_DATA  PacketType = 3 // FRAGMENTED_DATA is a data packet containing fragmented data
+	PacketType_HANDSHAKE_INITIATION PacketType = 0 // the HANDSHAKE_INITIATION packet gets send by the initiator to start the session
+	PacketType_HANDSHAKE_RESPONSE   PacketType = 1 // the HANDSHAKE_RESPONSE packet gets send by the respondent to complete the session
+	PacketType_TRANSPORT            PacketType = 2 // TRANSPORT is an encrypted and authenticated packet of an established session
+	PacketType_FRAGMENTED_DATA      PacketType = 3 // FRAGMENTED_DATA is a data packet containing fragmented data, only send inside of TRANSPORT packets
+	PacketType_KEEPALIVE            PacketType = 4 // KEEPALIVE is send periodically inside of TRANSPORT packets to keep the session alive, does not contain any data
+	PacketType_CLOSE_SESSION        PacketType = 5 // CLOSE_SESSION is send inside of a TRANSPORT packet to tear down the session, does not contain any data
 )
 
 // Enum value maps for PacketType.
 var (
 	PacketType_name = map[int32]string{
-		0: "HELO",
-		1: "INITIATE_SESSION",
-		2: "ACK_SESSION",
+		0: "HANDSHAKE_INITIATION",
+		1: "HANDSHAKE_RESPONSE",
+		2: "TRANSPORT",
 		3: "FRAGMENTED_DATA",
+		4: "KEEPALIVE",
+		5: "CLOSE_SESSION",
 	}
 	PacketType_value = map[string]int32{
-		"HELO":             0,
-		"INITIATE_SESSION": 1,
-		"ACK_SESSION":      2,
-		"FRAGMENTED_DATA":  3,
+		"HANDSHAKE_INITIATION": 0,
+		"HANDSHAKE_RESPONSE":   1,
+		"TRANSPORT":            2,
+		"FRAGMENTED_DATA":      3,
+		"KEEPALIVE":            4,
+		"CLOSE_SESSION":        5,
 	}
 )
 
@@ -80,10 +86,12 @@ type Packet struct {
 	Type PacketType `protobuf:"varint,1,opt,name=type,proto3,enum=internal.PacketType" json:"type,omitempty"`
 	// Types that are assignable to Payload:
 	//
-	//	*Packet_Helo
-	//	*Packet_InitiateSession
-	//	*Packet_AckSession
+	//	*Packet_HandshakeInitiation
+	//	*Packet_HandshakeResponse
+	//	*Packet_Transport
 	//	*Packet_FragmentedData
+	//	*Packet_Keepalive
+	//	*Packet_CloseSession
 	Payload isPacket_Payload `protobuf_oneof:"payload"`
 }
 
@@ -123,7 +131,7 @@ func (x *Packet) GetType() PacketType {
 	if x != nil {
 		return x.Type
 	}
-	return PacketType_HELO
+	return PacketType_HANDSHAKE_INITIATION
 }
 
 func (m *Packet) GetPayload() isPacket_Payload {
@@ -133,23 +141,23 @@ func (m *Packet) GetPayload() isPacket_Payload {
 	return nil
 }
 
-func (x *Packet) GetHelo() *Helo {
-	if x, ok := x.GetPayload().(*Packet_Helo); ok {
-		return x.Helo
+func (x *Packet) GetHandshakeInitiation() *HandshakeInitiation {
+	if x, ok := x.GetPayload().(*Packet_HandshakeInitiation); ok {
+		return x.HandshakeInitiation
 	}
 	return nil
 }
 
-func (x *Packet) GetInitiateSession() *InitiateSession {
-	if x, ok := x.GetPayload().(*Packet_InitiateSession); ok {
-		return x.InitiateSession
+func (x *Packet) GetHandshakeResponse() *HandshakeResponse {
+	if x, ok := x.GetPayload().(*Packet_HandshakeResponse); ok {
+		return x.HandshakeResponse
 	}
 	return nil
 }
 
-func (x *Packet) GetAckSession() *AckSession {
-	if x, ok := x.GetPayload().(*Packet_AckSession); ok {
-		return x.AckSession
+func (x *Packet) GetTransport() *Transport {
+	if x, ok := x.GetPayload().(*Packet_Transport); ok {
+		return x.Transport
 	}
 	return nil
 }
@@ -161,42 +169,73 @@ func (x *Packet) GetFragmentedData() *FragmentedData {
 	return nil
 }
 
+func (x *Packet) GetKeepalive() *Keepalive {
+	if x, ok := x.GetPayload().(*Packet_Keepalive); ok {
+		return x.Keepalive
+	}
+	return nil
+}
+
+func (x *Packet) GetCloseSession() *CloseSession {
+	if x, ok := x.GetPayload().(*Packet_CloseSession); ok {
+		return x.CloseSession
+	}
+	return nil
+}
+
 type isPacket_Payload interface {
 	isPacket_Payload()
 }
 
-type Packet_Helo struct {
-	Helo *Helo `protobuf:"bytes,2,opt,name=helo,proto3,oneof"`
+type Packet_HandshakeInitiation struct {
+	HandshakeInitiation *HandshakeInitiation `protobuf:"bytes,2,opt,name=handshakeInitiation,proto3,oneof"`
 }
 
-type Packet_InitiateSession struct {
-	InitiateSession *InitiateSession `protobuf:"bytes,3,opt,name=initiateSession,proto3,oneof"`
+type Packet_HandshakeResponse struct {
+	HandshakeResponse *HandshakeResponse `protobuf:"bytes,3,opt,name=handshakeResponse,proto3,oneof"`
 }
 
-type Packet_AckSession struct {
-	AckSession *AckSession `protobuf:"bytes,4,opt,name=ackSession,proto3,oneof"`
+type Packet_Transport struct {
+	Transport *Transport `protobuf:"bytes,4,opt,name=transport,proto3,oneof"`
 }
 
 type Packet_FragmentedData struct {
 	FragmentedData *FragmentedData `protobuf:"bytes,5,opt,name=fragmentedData,proto3,oneof"`
 }
 
-func (*Packet_Helo) isPacket_Payload() {}
+type Packet_Keepalive struct {
+	Keepalive *Keepalive `protobuf:"bytes,6,opt,name=keepalive,proto3,oneof"`
+}
+
+type Packet_CloseSession struct {
+	CloseSession *CloseSession `protobuf:"bytes,7,opt,name=closeSession,proto3,oneof"`
+}
+
+func (*Packet_HandshakeInitiation) isPacket_Payload() {}
 
-func (*Packet_InitiateSession) isPacket_Payload() {}
+func (*Packet_HandshakeResponse) isPacket_Payload() {}
 
-func (*Packet_AckSession) isPacket_Payload() {}
+func (*Packet_Transport) isPacket_Payload() {}
 
 func (*Packet_FragmentedData) isPacket_Payload() {}
 
-type Helo struct {
+func (*Packet_Keepalive) isPacket_Payload() {}
+
+func (*Packet_CloseSession) isPacket_Payload() {}
+
+type HandshakeInitiation struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
+
+	Ephemeral []byte `protobuf:"bytes,1,opt,name=ephemeral,proto3" json:"ephemeral,omitempty"`
+	Static    []byte `protobuf:"bytes,2,opt,name=static,proto3" json:"static,omitempty"`   // encrypted static public key of the initiator
+	Payload   []byte `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"` // encrypted SessionParameters
+	Sender    uint32 `protobuf:"varint,4,opt,name=sender,proto3" json:"sender,omitempty"`  // session index of the initiator
 }
 
-func (x *Helo) Reset() {
-	*x = Helo{}
+func (x *HandshakeInitiation) Reset() {
+	*x = HandshakeInitiation{}
 	if protoimpl.UnsafeEnabled {
 		mi := &file_packet_proto_msgTypes[1]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -204,13 +243,13 @@ func (x *Helo) Reset() {
 	}
 }
 
-func (x *Helo) String() string {
+func (x *HandshakeInitiation) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Helo) ProtoMessage() {}
+func (*HandshakeInitiation) ProtoMessage() {}
 
-func (x *Helo) ProtoReflect() protoreflect.Message {
+func (x *HandshakeInitiation) ProtoReflect() protoreflect.Message {
 	mi := &file_packet_proto_msgTypes[1]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -222,22 +261,52 @@ func (x *Helo) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Helo.ProtoReflect.Descriptor instead.
-func (*Helo) Descriptor() ([]byte, []int) {
+// Deprecated: Use HandshakeInitiation.ProtoReflect.Descriptor instead.
+func (*HandshakeInitiation) Descriptor() ([]byte, []int) {
 	return file_packet_proto_rawDescGZIP(), []int{1}
 }
 
-type InitiateSession struct {
+func (x *HandshakeInitiation) GetEphemeral() []byte {
+	if x != nil {
+		return x.Ephemeral
+	}
+	return nil
+}
+
+func (x *HandshakeInitiation) GetStatic() []byte {
+	if x != nil {
+		return x.Static
+	}
+	return nil
+}
+
+func (x *HandshakeInitiation) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *HandshakeInitiation) GetSender() uint32 {
+	if x != nil {
+		return x.Sender
+	}
+	return 0
+}
+
+type HandshakeResponse struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Mtu        uint32 `protobuf:"varint,1,opt,name=mtu,proto3" json:"mtu,omitempty"`
-	NetworkMtu uint32 `protobuf:"varint,2,opt,name=network_mtu,json=networkMtu,proto3" json:"network_mtu,omitempty"`
+	Ephemeral []byte `protobuf:"bytes,1,opt,name=ephemeral,proto3" json:"ephemeral,omitempty"`
+	Payload   []byte `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`    // encrypted SessionParameters
+	Sender    uint32 `protobuf:"varint,3,opt,name=sender,proto3" json:"sender,omitempty"`     // session index of the respondent
+	Receiver  uint32 `protobuf:"varint,4,opt,name=receiver,proto3" json:"receiver,omitempty"` // session index of the initiator
 }
 
-func (x *InitiateSession) Reset() {
-	*x = InitiateSession{}
+func (x *HandshakeResponse) Reset() {
+	*x = HandshakeResponse{}
 	if protoimpl.UnsafeEnabled {
 		mi := &file_packet_proto_msgTypes[2]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -245,13 +314,13 @@ func (x *InitiateSession) Reset() {
 	}
 }
 
-func (x *InitiateSession) String() string {
+func (x *HandshakeResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*InitiateSession) ProtoMessage() {}
+func (*HandshakeResponse) ProtoMessage() {}
 
-func (x *InitiateSession) ProtoReflect() protoreflect.Message {
+func (x *HandshakeResponse) ProtoReflect() protoreflect.Message {
 	mi := &file_packet_proto_msgTypes[2]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -263,35 +332,51 @@ func (x *InitiateSession) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use InitiateSession.ProtoReflect.Descriptor instead.
-func (*InitiateSession) Descriptor() ([]byte, []int) {
+// Deprecated: Use HandshakeResponse.ProtoReflect.Descriptor instead.
+func (*HandshakeResponse) Descriptor() ([]byte, []int) {
 	return file_packet_proto_rawDescGZIP(), []int{2}
 }
 
-func (x *InitiateSession) GetMtu() uint32 {
+func (x *HandshakeResponse) GetEphemeral() []byte {
 	if x != nil {
-		return x.Mtu
+		return x.Ephemeral
+	}
+	return nil
+}
+
+func (x *HandshakeResponse) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *HandshakeResponse) GetSender() uint32 {
+	if x != nil {
+		return x.Sender
 	}
 	return 0
 }
 
-func (x *InitiateSession) GetNetworkMtu() uint32 {
+func (x *HandshakeResponse) GetReceiver() uint32 {
 	if x != nil {
-		return x.NetworkMtu
+		return x.Receiver
 	}
 	return 0
 }
 
-type AckSession struct {
+type SessionParameters struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Mtu        uint32 `protobuf:"varint,1,opt,name=mtu,proto3" json:"mtu,omitempty"`
+	NetworkMtu uint32 `protobuf:"varint,2,opt,name=network_mtu,json=networkMtu,proto3" json:"network_mtu,omitempty"`
+	Timestamp  uint64 `protobuf:"varint,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // unix nanoseconds of the handshake message, used to reject replayed handshakes
 }
 
-func (x *AckSession) Reset() {
-	*x = AckSession{}
+func (x *SessionParameters) Reset() {
+	*x = SessionParameters{}
 	if protoimpl.UnsafeEnabled {
 		mi := &file_packet_proto_msgTypes[3]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -299,13 +384,13 @@ func (x *AckSession) Reset() {
 	}
 }
 
-func (x *AckSession) String() string {
+func (x *SessionParameters) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*AckSession) ProtoMessage() {}
+func (*SessionParameters) ProtoMessage() {}
 
-func (x *AckSession) ProtoReflect() protoreflect.Message {
+func (x *SessionParameters) ProtoReflect() protoreflect.Message {
 	mi := &file_packet_proto_msgTypes[3]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -317,16 +402,169 @@ func (x *AckSession) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use AckSession.ProtoReflect.Descriptor instead.
-func (*AckSession) Descriptor() ([]byte, []int) {
+// Deprecated: Use SessionParameters.ProtoReflect.Descriptor instead.
+func (*SessionParameters) Descriptor() ([]byte, []int) {
 	return file_packet_proto_rawDescGZIP(), []int{3}
 }
 
-func (x *AckSession) GetId() string {
+func (x *SessionParameters) GetMtu() uint32 {
 	if x != nil {
-		return x.Id
+		return x.Mtu
+	}
+	return 0
+}
+
+func (x *SessionParameters) GetNetworkMtu() uint32 {
+	if x != nil {
+		return x.NetworkMtu
+	}
+	return 0
+}
+
+func (x *SessionParameters) GetTimestamp() uint64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+type Transport struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Counter    uint64 `protobuf:"varint,1,opt,name=counter,proto3" json:"counter,omitempty"`      // monotonic per-session counter, used as nonce and for replay protection
+	Ciphertext []byte `protobuf:"bytes,2,opt,name=ciphertext,proto3" json:"ciphertext,omitempty"` // encrypted Packet
+	Receiver   uint32 `protobuf:"varint,3,opt,name=receiver,proto3" json:"receiver,omitempty"`    // session index of the receiver, identifies the session independent of the address
+}
+
+func (x *Transport) Reset() {
+	*x = Transport{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Transport) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Transport) ProtoMessage() {}
+
+func (x *Transport) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Transport.ProtoReflect.Descriptor instead.
+func (*Transport) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Transport) GetCounter() uint64 {
+	if x != nil {
+		return x.Counter
+	}
+	return 0
+}
+
+func (x *Transport) GetCiphertext() []byte {
+	if x != nil {
+		return x.Ciphertext
+	}
+	return nil
+}
+
+func (x *Transport) GetReceiver() uint32 {
+	if x != nil {
+		return x.Receiver
+	}
+	return 0
+}
+
+type Keepalive struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *Keepalive) Reset() {
+	*x = Keepalive{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Keepalive) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Keepalive) ProtoMessage() {}
+
+func (x *Keepalive) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Keepalive.ProtoReflect.Descriptor instead.
+func (*Keepalive) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{5}
+}
+
+type CloseSession struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *CloseSession) Reset() {
+	*x = CloseSession{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
 	}
-	return ""
+}
+
+func (x *CloseSession) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CloseSession) ProtoMessage() {}
+
+func (x *CloseSession) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CloseSession.ProtoReflect.Descriptor instead.
+func (*CloseSession) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{6}
 }
 
 type FragmentedData struct {
@@ -343,7 +581,7 @@ type FragmentedData struct {
 func (x *FragmentedData) Reset() {
 	*x = FragmentedData{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_packet_proto_msgTypes[4]
+		mi := &file_packet_proto_msgTypes[7]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -356,7 +594,7 @@ func (x *FragmentedData) String() string {
 func (*FragmentedData) ProtoMessage() {}
 
 func (x *FragmentedData) ProtoReflect() protoreflect.Message {
-	mi := &file_packet_proto_msgTypes[4]
+	mi := &file_packet_proto_msgTypes[7]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -369,7 +607,7 @@ func (x *FragmentedData) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use FragmentedData.ProtoReflect.Descriptor instead.
 func (*FragmentedData) Descriptor() ([]byte, []int) {
-	return file_packet_proto_rawDescGZIP(), []int{4}
+	return file_packet_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *FragmentedData) GetId() uint32 {
@@ -404,45 +642,82 @@ var File_packet_proto protoreflect.FileDescriptor
 
 var file_packet_proto_rawDesc = []byte{
 	0x0a, 0x0c, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x08,
-	0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x22, 0xa6, 0x02, 0x0a, 0x06, 0x50, 0x61, 0x63,
+	0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x22, 0xc9, 0x03, 0x0a, 0x06, 0x50, 0x61, 0x63,
 	0x6b, 0x65, 0x74, 0x12, 0x28, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
 	0x0e, 0x32, 0x14, 0x2e, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2e, 0x50, 0x61, 0x63,
-	0x6b, 0x65, 0x74, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x24, 0x0a,
-	0x04, 0x68, 0x65, 0x6c, 0x6f, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x69, 0x6e,
-	0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2e, 0x48, 0x65, 0x6c, 0x6f, 0x48, 0x00, 0x52, 0x04, 0x68,
-	0x65, 0x6c, 0x6f, 0x12, 0x45, 0x0a, 0x0f, 0x69, 0x6e, 0x69, 0x74, 0x69, 0x61, 0x74, 0x65, 0x53,
-	0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x69,
-	0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2e, 0x49, 0x6e, 0x69, 0x74, 0x69, 0x61, 0x74, 0x65,
-	0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x48, 0x00, 0x52, 0x0f, 0x69, 0x6e, 0x69, 0x74, 0x69,
-	0x61, 0x74, 0x65, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x36, 0x0a, 0x0a, 0x61, 0x63,
-	0x6b, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14,
-	0x2e, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2e, 0x41, 0x63, 0x6b, 0x53, 0x65, 0x73,
-	0x73, 0x69, 0x6f, 0x6e, 0x48, 0x00, 0x52, 0x0a, 0x61, 0x63, 0x6b, 0x53, 0x65, 0x73, 0x73, 0x69,
-	0x6f, 0x6e, 0x12, 0x42, 0x0a, 0x0e, 0x66, 0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x65, 0x64,
+	0x6b, 0x65, 0x74, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x51, 0x0a,
+	0x13, 0x68, 0x61, 0x6e, 0x64, 0x73, 0x68, 0x61, 0x6b, 0x65, 0x49, 0x6e, 0x69, 0x74, 0x69, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1d, 0x2e, 0x69, 0x6e, 0x74,
+	0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2e, 0x48, 0x61, 0x6e, 0x64, 0x73, 0x68, 0x61, 0x6b, 0x65, 0x49,
+	0x6e, 0x69, 0x74, 0x69, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x48, 0x00, 0x52, 0x13, 0x68, 0x61, 0x6e,
+	0x64, 0x73, 0x68, 0x61, 0x6b, 0x65, 0x49, 0x6e, 0x69, 0x74, 0x69, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x12, 0x4b, 0x0a, 0x11, 0x68, 0x61, 0x6e, 0x64, 0x73, 0x68, 0x61, 0x6b, 0x65, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x69, 0x6e,
+	0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2e, 0x48, 0x61, 0x6e, 0x64, 0x73, 0x68, 0x61, 0x6b, 0x65,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x11, 0x68, 0x61, 0x6e, 0x64,
+	0x73, 0x68, 0x61, 0x6b, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x33, 0x0a,
+	0x09, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x13, 0x2e, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2e, 0x54, 0x72, 0x61, 0x6e,
+	0x73, 0x70, 0x6f, 0x72, 0x74, 0x48, 0x00, 0x52, 0x09, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f,
+	0x72, 0x74, 0x12, 0x42, 0x0a, 0x0e, 0x66, 0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x65, 0x64,
 	0x44, 0x61, 0x74, 0x61, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x69, 0x6e, 0x74,
 	0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2e, 0x46, 0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x65, 0x64,
 	0x44, 0x61, 0x74, 0x61, 0x48, 0x00, 0x52, 0x0e, 0x66, 0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74,
-	0x65, 0x64, 0x44, 0x61, 0x74, 0x61, 0x42, 0x09, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61,
-	0x64, 0x22, 0x06, 0x0a, 0x04, 0x48, 0x65, 0x6c, 0x6f, 0x22, 0x44, 0x0a, 0x0f, 0x49, 0x6e, 0x69,
-	0x74, 0x69, 0x61, 0x74, 0x65, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x10, 0x0a, 0x03,
-	0x6d, 0x74, 0x75, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x6d, 0x74, 0x75, 0x12, 0x1f,
-	0x0a, 0x0b, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x5f, 0x6d, 0x74, 0x75, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x0d, 0x52, 0x0a, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x4d, 0x74, 0x75, 0x22,
-	0x1c, 0x0a, 0x0a, 0x41, 0x63, 0x6b, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x0e, 0x0a,
-	0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x22, 0x78, 0x0a,
-	0x0e, 0x46, 0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x65, 0x64, 0x44, 0x61, 0x74, 0x61, 0x12,
-	0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x02, 0x69, 0x64, 0x12,
-	0x1a, 0x0a, 0x08, 0x66, 0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x0d, 0x52, 0x08, 0x66, 0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x12, 0x20, 0x0a, 0x0b, 0x66,
-	0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x4d, 0x61, 0x78, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d,
-	0x52, 0x0b, 0x66, 0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x4d, 0x61, 0x78, 0x12, 0x18, 0x0a,
-	0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07,
-	0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x2a, 0x52, 0x0a, 0x0a, 0x50, 0x61, 0x63, 0x6b, 0x65,
-	0x74, 0x54, 0x79, 0x70, 0x65, 0x12, 0x08, 0x0a, 0x04, 0x48, 0x45, 0x4c, 0x4f, 0x10, 0x00, 0x12,
-	0x14, 0x0a, 0x10, 0x49, 0x4e, 0x49, 0x54, 0x49, 0x41, 0x54, 0x45, 0x5f, 0x53, 0x45, 0x53, 0x53,
-	0x49, 0x4f, 0x4e, 0x10, 0x01, 0x12, 0x0f, 0x0a, 0x0b, 0x41, 0x43, 0x4b, 0x5f, 0x53, 0x45, 0x53,
-	0x53, 0x49, 0x4f, 0x4e, 0x10, 0x02, 0x12, 0x13, 0x0a, 0x0f, 0x46, 0x52, 0x41, 0x47, 0x4d, 0x45,
-	0x4e, 0x54, 0x45, 0x44, 0x5f, 0x44, 0x41, 0x54, 0x41, 0x10, 0x03, 0x42, 0x09, 0x5a, 0x07, 0x2f,
+	0x65, 0x64, 0x44, 0x61, 0x74, 0x61, 0x12, 0x33, 0x0a, 0x09, 0x6b, 0x65, 0x65, 0x70, 0x61, 0x6c,
+	0x69, 0x76, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x69, 0x6e, 0x74, 0x65,
+	0x72, 0x6e, 0x61, 0x6c, 0x2e, 0x4b, 0x65, 0x65, 0x70, 0x61, 0x6c, 0x69, 0x76, 0x65, 0x48, 0x00,
+	0x52, 0x09, 0x6b, 0x65, 0x65, 0x70, 0x61, 0x6c, 0x69, 0x76, 0x65, 0x12, 0x3c, 0x0a, 0x0c, 0x63,
+	0x6c, 0x6f, 0x73, 0x65, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x07, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x16, 0x2e, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2e, 0x43, 0x6c, 0x6f,
+	0x73, 0x65, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x48, 0x00, 0x52, 0x0c, 0x63, 0x6c, 0x6f,
+	0x73, 0x65, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x42, 0x09, 0x0a, 0x07, 0x70, 0x61, 0x79,
+	0x6c, 0x6f, 0x61, 0x64, 0x22, 0x7d, 0x0a, 0x13, 0x48, 0x61, 0x6e, 0x64, 0x73, 0x68, 0x61, 0x6b,
+	0x65, 0x49, 0x6e, 0x69, 0x74, 0x69, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1c, 0x0a, 0x09, 0x65,
+	0x70, 0x68, 0x65, 0x6d, 0x65, 0x72, 0x61, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09,
+	0x65, 0x70, 0x68, 0x65, 0x6d, 0x65, 0x72, 0x61, 0x6c, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74, 0x61,
+	0x74, 0x69, 0x63, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x69,
+	0x63, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x0c, 0x52, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x73,
+	0x65, 0x6e, 0x64, 0x65, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x73, 0x65, 0x6e,
+	0x64, 0x65, 0x72, 0x22, 0x7f, 0x0a, 0x11, 0x48, 0x61, 0x6e, 0x64, 0x73, 0x68, 0x61, 0x6b, 0x65,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x65, 0x70, 0x68, 0x65,
+	0x6d, 0x65, 0x72, 0x61, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x65, 0x70, 0x68,
+	0x65, 0x6d, 0x65, 0x72, 0x61, 0x6c, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61,
+	0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64,
+	0x12, 0x16, 0x0a, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x63, 0x65,
+	0x69, 0x76, 0x65, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x72, 0x65, 0x63, 0x65,
+	0x69, 0x76, 0x65, 0x72, 0x22, 0x64, 0x0a, 0x11, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x50,
+	0x61, 0x72, 0x61, 0x6d, 0x65, 0x74, 0x65, 0x72, 0x73, 0x12, 0x10, 0x0a, 0x03, 0x6d, 0x74, 0x75,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x6d, 0x74, 0x75, 0x12, 0x1f, 0x0a, 0x0b, 0x6e,
+	0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x5f, 0x6d, 0x74, 0x75, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x0a, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x4d, 0x74, 0x75, 0x12, 0x1c, 0x0a, 0x09,
+	0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52,
+	0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x22, 0x61, 0x0a, 0x09, 0x54, 0x72,
+	0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x75, 0x6e, 0x74,
+	0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x65,
+	0x72, 0x12, 0x1e, 0x0a, 0x0a, 0x63, 0x69, 0x70, 0x68, 0x65, 0x72, 0x74, 0x65, 0x78, 0x74, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a, 0x63, 0x69, 0x70, 0x68, 0x65, 0x72, 0x74, 0x65, 0x78,
+	0x74, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x72, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x08, 0x72, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x72, 0x22, 0x0b, 0x0a,
+	0x09, 0x4b, 0x65, 0x65, 0x70, 0x61, 0x6c, 0x69, 0x76, 0x65, 0x22, 0x0e, 0x0a, 0x0c, 0x43, 0x6c,
+	0x6f, 0x73, 0x65, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x22, 0x78, 0x0a, 0x0e, 0x46, 0x72,
+	0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x65, 0x64, 0x44, 0x61, 0x74, 0x61, 0x12, 0x0e, 0x0a, 0x02,
+	0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x02, 0x69, 0x64, 0x12, 0x1a, 0x0a, 0x08,
+	0x66, 0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08,
+	0x66, 0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x12, 0x20, 0x0a, 0x0b, 0x66, 0x72, 0x61, 0x67,
+	0x6d, 0x65, 0x6e, 0x74, 0x4d, 0x61, 0x78, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x66,
+	0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x4d, 0x61, 0x78, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61,
+	0x79, 0x6c, 0x6f, 0x61, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x70, 0x61, 0x79,
+	0x6c, 0x6f, 0x61, 0x64, 0x2a, 0x84, 0x01, 0x0a, 0x0a, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x54,
+	0x79, 0x70, 0x65, 0x12, 0x18, 0x0a, 0x14, 0x48, 0x41, 0x4e, 0x44, 0x53, 0x48, 0x41, 0x4b, 0x45,
+	0x5f, 0x49, 0x4e, 0x49, 0x54, 0x49, 0x41, 0x54, 0x49, 0x4f, 0x4e, 0x10, 0x00, 0x12, 0x16, 0x0a,
+	0x12, 0x48, 0x41, 0x4e, 0x44, 0x53, 0x48, 0x41, 0x4b, 0x45, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x4f,
+	0x4e, 0x53, 0x45, 0x10, 0x01, 0x12, 0x0d, 0x0a, 0x09, 0x54, 0x52, 0x41, 0x4e, 0x53, 0x50, 0x4f,
+	0x52, 0x54, 0x10, 0x02, 0x12, 0x13, 0x0a, 0x0f, 0x46, 0x52, 0x41, 0x47, 0x4d, 0x45, 0x4e, 0x54,
+	0x45, 0x44, 0x5f, 0x44, 0x41, 0x54, 0x41, 0x10, 0x03, 0x12, 0x0d, 0x0a, 0x09, 0x4b, 0x45, 0x45,
+	0x50, 0x41, 0x4c, 0x49, 0x56, 0x45, 0x10, 0x04, 0x12, 0x11, 0x0a, 0x0d, 0x43, 0x4c, 0x4f, 0x53,
+	0x45, 0x5f, 0x53, 0x45, 0x53, 0x53, 0x49, 0x4f, 0x4e, 0x10, 0x05, 0x42, 0x09, 0x5a, 0x07, 0x2f,
 	0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
@@ -459,26 +734,31 @@ func file_packet_proto_rawDescGZIP() []byte {
 }
 
 var file_packet_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_packet_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_packet_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
 var file_packet_proto_goTypes = []any{
-	(PacketType)(0),         // 0: internal.PacketType
-	(*Packet)(nil),          // 1: internal.Packet
-	(*Helo)(nil),            // 2: internal.Helo
-	(*InitiateSession)(nil), // 3: internal.InitiateSession
-	(*AckSession)(nil),      // 4: internal.AckSession
-	(*FragmentedData)(nil),  // 5: internal.FragmentedData
+	(PacketType)(0),             // 0: internal.PacketType
+	(*Packet)(nil),              // 1: internal.Packet
+	(*HandshakeInitiation)(nil), // 2: internal.HandshakeInitiation
+	(*HandshakeResponse)(nil),   // 3: internal.HandshakeResponse
+	(*SessionParameters)(nil),   // 4: internal.SessionParameters
+	(*Transport)(nil),           // 5: internal.Transport
+	(*Keepalive)(nil),           // 6: internal.Keepalive
+	(*CloseSession)(nil),        // 7: internal.CloseSession
+	(*FragmentedData)(nil),      // 8: internal.FragmentedData
 }
 var file_packet_proto_depIdxs = []int32{
 	0, // 0: internal.Packet.type:type_name -> internal.PacketType
-	2, // 1: internal.Packet.helo:type_name -> internal.Helo
-	3, // 2: internal.Packet.initiateSession:type_name -> internal.InitiateSession
-	4, // 3: internal.Packet.ackSession:type_name -> internal.AckSession
-	5, // 4: internal.Packet.fragmentedData:type_name -> internal.FragmentedData
-	5, // [5:5] is the sub-list for method output_type
-	5, // [5:5] is the sub-list for method input_type
-	5, // [5:5] is the sub-list for extension type_name
-	5, // [5:5] is the sub-list for extension extendee
-	0, // [0:5] is the sub-list for field type_name
+	2, // 1: internal.Packet.handshakeInitiation:type_name -> internal.HandshakeInitiation
+	3, // 2: internal.Packet.handshakeResponse:type_name -> internal.HandshakeResponse
+	5, // 3: internal.Packet.transport:type_name -> internal.Transport
+	8, // 4: internal.Packet.fragmentedData:type_name -> internal.FragmentedData
+	6, // 5: internal.Packet.keepalive:type_name -> internal.Keepalive
+	7, // 6: internal.Packet.closeSession:type_name -> internal.CloseSession
+	7, // [7:7] is the sub-list for method output_type
+	7, // [7:7] is the sub-list for method input_type
+	7, // [7:7] is the sub-list for extension type_name
+	7, // [7:7] is the sub-list for extension extendee
+	0, // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_packet_proto_init() }
@@ -500,7 +780,7 @@ func file_packet_proto_init() {
 			}
 		}
 		file_packet_proto_msgTypes[1].Exporter = func(v any, i int) any {
-			switch v := v.(*Helo); i {
+			switch v := v.(*HandshakeInitiation); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -512,7 +792,7 @@ func file_packet_proto_init() {
 			}
 		}
 		file_packet_proto_msgTypes[2].Exporter = func(v any, i int) any {
-			switch v := v.(*InitiateSession); i {
+			switch v := v.(*HandshakeResponse); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -524,7 +804,7 @@ func file_packet_proto_init() {
 			}
 		}
 		file_packet_proto_msgTypes[3].Exporter = func(v any, i int) any {
-			switch v := v.(*AckSession); i {
+			switch v := v.(*SessionParameters); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -536,6 +816,42 @@ func file_packet_proto_init() {
 			}
 		}
 		file_packet_proto_msgTypes[4].Exporter = func(v any, i int) any {
+			switch v := v.(*Transport); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[5].Exporter = func(v any, i int) any {
+			switch v := v.(*Keepalive); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[6].Exporter = func(v any, i int) any {
+			switch v := v.(*CloseSession); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[7].Exporter = func(v any, i int) any {
 			switch v := v.(*FragmentedData); i {
 			case 0:
 				return &v.state
@@ -549,10 +865,12 @@ func file_packet_proto_init() {
 		}
 	}
 	file_packet_proto_msgTypes[0].OneofWrappers = []any{
-		(*Packet_Helo)(nil),
-		(*Packet_InitiateSession)(nil),
-		(*Packet_AckSession)(nil),
+		(*Packet_HandshakeInitiation)(nil),
+		(*Packet_HandshakeResponse)(nil),
+		(*Packet_Transport)(nil),
 		(*Packet_FragmentedData)(nil),
+		(*Packet_Keepalive)(nil),
+		(*Packet_CloseSession)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -560,7 +878,7 @@ func file_packet_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_packet_proto_rawDesc,
 			NumEnums:      1,
-			NumMessages:   5,
+			NumMessages:   8,
 			NumExtensions: 0,
 			NumServices:   0,
 		},